@@ -2,11 +2,22 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-chi/chi"
 	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/deadletter"
+	"github.com/shpeliving/calert/internal/notifier"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/queue"
 )
 
 // wrap is a middleware that wraps HTTP handlers and injects the "app" context.
@@ -17,6 +28,24 @@ func wrap(app *App, next http.HandlerFunc) http.HandlerFunc {
 	})
 }
 
+// requireToken is a middleware that rejects the requests which don't have
+// the token in the `Authorization: Bearer` header.
+func requireToken(token string) func(http.Handler) http.Handler {
+	const prefix = "Bearer "
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, prefix) ||
+				subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(token)) != 1 {
+				sendErrorResponse(w, "Unauthorized.", http.StatusUnauthorized, nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // resp is used to send uniform response structure.
 type resp struct {
 	Status  string      `json:"status"`
@@ -26,6 +55,11 @@ type resp struct {
 
 // sendResponse sends a JSON envelope to the HTTP response.
 func sendResponse(w http.ResponseWriter, data interface{}) {
+	sendResponseCode(w, data, http.StatusOK)
+}
+
+// sendResponseCode sends a JSON envelope to the HTTP response with the status code.
+func sendResponseCode(w http.ResponseWriter, data interface{}, code int) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	out, err := json.Marshal(resp{Status: "success", Data: data})
 
@@ -34,6 +68,7 @@ func sendResponse(w http.ResponseWriter, data interface{}) {
 		return
 	}
 
+	w.WriteHeader(code)
 	w.Write(out)
 }
 
@@ -101,16 +136,298 @@ func handleDispatchNotif(w http.ResponseWriter, r *http.Request) {
 
 	app.lo.WithField("receiver", roomName).Info("dispatching new alert")
 
-	// Dispatch a list of alerts via Notifier.
+	// Persist the alerts before acknowledging the request, so they're dispatched even if calert restarts.
 	// If there are a lot of alerts (>=10) to push, G-Chat API can be extremely slow to add messages
-	// to an existing thread. So it's better to enqueue it in background.
-	go func() {
-		if err := app.notifier.Dispatch(payload, roomName); err != nil {
-			app.lo.WithError(err).Error("error dispatching alerts")
+	// to an existing thread. So they're dispatched in background by the queue workers.
+	if _, err := app.queue.Enqueue(roomName, payload); err != nil {
+		// Ask Alertmanager to retry later if there are too many alerts waiting to be dispatched.
+		if errors.Is(err, queue.ErrFull) {
+			app.lo.WithField("receiver", roomName).Warn("dispatch queue is full, rejecting alerts")
 			app.metrics.Increment(`http_request_errors_total{handler="dispatch"}`)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(app.retryAfter.Seconds()))))
+			sendErrorResponse(w, "Dispatch queue is full, retry later.", http.StatusServiceUnavailable, nil)
+			return
 		}
-		app.metrics.Duration(`http_request_duration_seconds{handler="dispatch"}`, now)
-	}()
 
+		app.lo.WithError(err).Error("error queueing alerts")
+		app.metrics.Increment(`http_request_errors_total{handler="dispatch"}`)
+		sendErrorResponse(w, "Error queueing alerts.", http.StatusInternalServerError, nil)
+		return
+	}
+
+	app.metrics.Duration(`http_request_duration_seconds{handler="dispatch"}`, now)
 	sendResponse(w, "dispatched")
 }
+
+// dispatch pushes a queued payload via Notifier. It's called by the queue workers.
+// The alerts which failed with an error which may go away on its own, such as a
+// 5xx response or a timeout, are retried later by the queue until the entry runs
+// out of attempts. The alerts whose retries were abandoned on shutdown, and the
+// ones deferred by a rate limit, are kept in the queue without using up an
+// attempt. The other failures are stored as dead letters.
+func (app *App) dispatch(e *queue.Entry) queue.Outcome {
+	var (
+		now = time.Now()
+		res []notifier.Result
+		err error
+	)
+
+	// Only the providers and alerts which failed are sent again when the entry is retried.
+	if len(e.Targets) > 0 {
+		targets := make([]notifier.Target, 0, len(e.Targets))
+		for _, t := range e.Targets {
+			targets = append(targets, notifier.Target{Name: t.Name, Room: t.Room, Alerts: t.Alerts})
+		}
+		res, err = app.notifier.Resend(targets)
+	} else {
+		res, err = app.notifier.Dispatch(e.Payload, e.Room)
+	}
+	if err != nil {
+		app.lo.WithError(err).WithField("id", e.ID).Error("error dispatching alerts")
+	}
+	failed := notifier.Failed(res)
+	if len(failed) > 0 {
+		app.lo.WithField("id", e.ID).WithField("failed", len(failed)).WithField("providers", len(res)).Error("error dispatching alerts to some providers")
+	}
+	if err != nil || len(failed) > 0 {
+		app.metrics.Increment(`http_request_errors_total{handler="dispatch"}`)
+	}
+	app.metrics.Duration(`alerts_queue_latency_seconds`, e.QueuedAt)
+	app.metrics.Duration(`alerts_dispatch_duration_seconds`, now)
+
+	var (
+		retry     []queue.Target
+		attempted bool
+		// after is the longest wait asked for by the providers which deferred alerts.
+		after time.Duration
+	)
+	for _, r := range failed {
+		var perr *providers.PushError
+		if !errors.As(r.Err, &perr) {
+			continue
+		}
+
+		t := queue.Target{Name: r.Name, Room: r.Room}
+		for _, f := range perr.Failures {
+			var (
+				ok, _ = providers.Retryable(f.Err)
+				de    *providers.DeferError
+			)
+			switch {
+			case errors.As(f.Err, &de):
+				if de.After > after {
+					after = de.After
+				}
+			case providers.Stopped(f.Err):
+			case ok && e.Attempts+1 < app.maxAttempts:
+				attempted = true
+			default:
+				app.recordDeadLetter(r, f)
+				continue
+			}
+			t.Alerts = append(t.Alerts, f.Alert)
+		}
+		if len(t.Alerts) > 0 {
+			retry = append(retry, t)
+		}
+	}
+
+	switch {
+	case len(retry) > 0:
+		e.Targets = retry
+		// Alerts which failed wait for the retry delay of the queue.
+		if attempted {
+			app.lo.WithField("id", e.ID).WithField("attempt", e.Attempts+1).Warn("retrying failed alerts later")
+			e.Attempts++
+		} else {
+			e.RetryAfter = after
+		}
+		return queue.Retry
+	case err != nil || len(failed) > 0:
+		return queue.Failed
+	}
+
+	return queue.Sent
+}
+
+// recordDeadLetter stores an alert which couldn't be sent in the dead letter store.
+func (app *App) recordDeadLetter(r notifier.Result, f providers.Failure) {
+	if app.deadLetters == nil {
+		return
+	}
+
+	e := deadletter.Entry{
+		Provider: r.Provider,
+		Name:     r.Name,
+		Room:     r.Room,
+		Alert:    f.Alert,
+		Error:    f.Err.Error(),
+		Attempts: providers.Attempts(f.Err),
+	}
+	if f.Message != nil {
+		if b, err := json.Marshal(f.Message); err == nil {
+			e.Message = b
+		}
+	}
+
+	if _, err := app.deadLetters.Add(e); err != nil {
+		app.lo.WithError(err).WithField("provider", r.Name).WithField("room", r.Room).Error("error storing dead letter")
+	}
+}
+
+// redrive resends a dead letter to the provider it failed to send to. The entry
+// is claimed while it's sent, so concurrent redrives don't send it twice. It's
+// removed once it's sent, or updated with the error otherwise.
+func (app *App) redrive(id string) error {
+	e, err := app.deadLetters.Claim(id)
+	if err != nil {
+		return err
+	}
+
+	return app.resend(e)
+}
+
+// resend sends a dead letter claimed with Claim and releases it. If the provider
+// is rate limited, it waits for the token reserved for the alert.
+func (app *App) resend(e deadletter.Entry) error {
+	defer app.deadLetters.Release(e.ID)
+
+	var err error
+	for {
+		var res []notifier.Result
+		res, err = app.notifier.Redrive(e.Name, e.Room, []alertmgrtmpl.Alert{e.Alert})
+		if err == nil {
+			if failed := notifier.Failed(res); len(failed) > 0 {
+				err = failed[0].Err
+			}
+		}
+
+		var de *providers.DeferError
+		if !errors.As(err, &de) {
+			break
+		}
+		time.Sleep(de.After)
+	}
+
+	if err != nil {
+		app.metrics.Increment(fmt.Sprintf(`deadletters_redrive_errors_total{provider="%s", name="%s", room="%s"}`, e.Provider, e.Name, e.Room))
+		e.Attempts += providers.Attempts(err)
+		e.Error = err.Error()
+		e.FailedAt = time.Now()
+		if uerr := app.deadLetters.Update(e); uerr != nil {
+			app.lo.WithError(uerr).WithField("id", e.ID).Error("error updating dead letter")
+		}
+		return err
+	}
+
+	app.metrics.Increment(fmt.Sprintf(`deadletters_redriven_total{provider="%s", name="%s", room="%s"}`, e.Provider, e.Name, e.Room))
+	// The alert was sent even if the entry was removed in the meantime.
+	if err := app.deadLetters.Delete(e.ID); err != nil && !errors.Is(err, deadletter.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// redriveResult is the outcome of redriving a dead letter.
+type redriveResult struct {
+	ID    string `json:"id"`
+	Sent  bool   `json:"sent"`
+	Error string `json:"error,omitempty"`
+}
+
+// List the dead letters.
+func handleGetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	var (
+		app = r.Context().Value("app").(*App)
+	)
+	app.metrics.Increment(`http_requests_total{handler="deadletters"}`)
+
+	out, err := app.deadLetters.List()
+	if err != nil {
+		app.lo.WithError(err).Error("error listing dead letters")
+		app.metrics.Increment(`http_request_errors_total{handler="deadletters"}`)
+		sendErrorResponse(w, "Error listing dead letters.", http.StatusInternalServerError, nil)
+		return
+	}
+
+	sendResponse(w, out)
+}
+
+// Redrive a dead letter.
+func handleRetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	var (
+		app = r.Context().Value("app").(*App)
+		id  = chi.URLParam(r, "id")
+	)
+	app.metrics.Increment(`http_requests_total{handler="deadletters_retry"}`)
+
+	if err := app.redrive(id); err != nil {
+		switch {
+		case errors.Is(err, deadletter.ErrNotFound):
+			sendErrorResponse(w, "Dead letter not found.", http.StatusNotFound, nil)
+		case errors.Is(err, deadletter.ErrClaimed):
+			sendErrorResponse(w, "Dead letter is already being redriven.", http.StatusConflict, nil)
+		default:
+			app.lo.WithError(err).WithField("id", id).Error("error redriving dead letter")
+			sendErrorResponse(w, "Error redriving dead letter.", http.StatusBadGateway, redriveResult{ID: id, Error: err.Error()})
+		}
+		return
+	}
+
+	sendResponse(w, redriveResult{ID: id, Sent: true})
+}
+
+// Redrive all the dead letters, optionally filtered by the `provider`, `name` and `room` query params.
+func handleRetryDeadLetters(w http.ResponseWriter, r *http.Request) {
+	var (
+		app      = r.Context().Value("app").(*App)
+		provider = r.URL.Query().Get("provider")
+		name     = r.URL.Query().Get("name")
+		room     = r.URL.Query().Get("room")
+	)
+	app.metrics.Increment(`http_requests_total{handler="deadletters_retry_all"}`)
+
+	list, err := app.deadLetters.List()
+	if err != nil {
+		app.lo.WithError(err).Error("error listing dead letters")
+		app.metrics.Increment(`http_request_errors_total{handler="deadletters_retry_all"}`)
+		sendErrorResponse(w, "Error listing dead letters.", http.StatusInternalServerError, nil)
+		return
+	}
+
+	// Claim the entries before responding, so the IDs which are returned are only
+	// redriven by this request.
+	var (
+		claimed = make([]deadletter.Entry, 0, len(list))
+		ids     = make([]string, 0, len(list))
+	)
+	for _, e := range list {
+		if (provider != "" && e.Provider != provider) || (name != "" && e.Name != name) || (room != "" && e.Room != room) {
+			continue
+		}
+
+		c, err := app.deadLetters.Claim(e.ID)
+		if err != nil {
+			// Skip the entries which were redriven by another request in the meantime.
+			if errors.Is(err, deadletter.ErrNotFound) || errors.Is(err, deadletter.ErrClaimed) {
+				continue
+			}
+			app.lo.WithError(err).WithField("id", e.ID).Error("error claiming dead letter")
+			continue
+		}
+		claimed = append(claimed, c)
+		ids = append(ids, c.ID)
+	}
+
+	// Sending all the entries, with the retries, can take longer than the server's
+	// write timeout. So they're redriven in the background and the outcome is logged.
+	go func() {
+		for _, e := range claimed {
+			if err := app.resend(e); err != nil {
+				app.lo.WithError(err).WithField("id", e.ID).Error("error redriving dead letter")
+			}
+		}
+	}()
+
+	sendResponseCode(w, ids, http.StatusAccepted)
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/deadletter"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/notifier"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/providers/ratelimit"
+	"github.com/shpeliving/calert/internal/queue"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// testProvider sends every alert with a Retrier. The alerts fail with `err` if it's set.
+type testProvider struct {
+	name  string
+	retry *providers.Retrier
+	err   error
+	calls chan alertmgrtmpl.Alert
+}
+
+func newTestProvider(name string, policy providers.RetryPolicy, err error) *testProvider {
+	return &testProvider{
+		name:  name,
+		retry: providers.NewRetrier(policy, logrus.New(), metrics.New("calert"), "webhook", name, "prod"),
+		err:   err,
+		calls: make(chan alertmgrtmpl.Alert, 100),
+	}
+}
+
+func (p *testProvider) ID() string   { return "webhook" }
+func (p *testProvider) Name() string { return p.name }
+func (p *testProvider) Room() string { return "prod" }
+
+func (p *testProvider) Push(alerts []alertmgrtmpl.Alert) error {
+	perr := &providers.PushError{Provider: p.ID()}
+	for _, a := range alerts {
+		if err := p.retry.Do(func() error {
+			p.calls <- a
+			return p.err
+		}); err != nil {
+			perr.Add(a, nil, err)
+		}
+	}
+	return perr.OrNil()
+}
+
+func newTestApp(t *testing.T, dir string, provs ...providers.Provider) *App {
+	t.Helper()
+
+	lo := logrus.New()
+	lo.SetOutput(io.Discard)
+	m := metrics.New("calert")
+
+	n, err := notifier.Init(notifier.Opts{Providers: provs, Log: lo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := queue.New(queue.Opts{Dir: dir, Log: lo, Metrics: m})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &App{
+		lo:          lo,
+		metrics:     m,
+		notifier:    n,
+		queue:       q,
+		retryAfter:  10 * time.Second,
+		maxAttempts: 5,
+	}
+}
+
+func TestDispatchStop(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		stop = make(chan struct{})
+		// The alert fails on the first provider and waits for a long backoff.
+		failing = newTestProvider("prod_webhook", providers.RetryPolicy{MaxAttempts: 5, MinBackoff: time.Hour, MaxBackoff: time.Hour, Stop: stop},
+			&providers.StatusError{StatusCode: http.StatusServiceUnavailable})
+		ok  = newTestProvider("prod_audit", providers.RetryPolicy{Stop: stop}, nil)
+		app = newTestApp(t, dir, failing, ok)
+	)
+
+	app.queue.Start(1, app.dispatch)
+	alert := alertmgrtmpl.Alert{Status: "firing", Fingerprint: "1a956348d0570965"}
+	if _, err := app.queue.Enqueue("prod", alertmgrtmpl.Data{Alerts: alertmgrtmpl.Alerts{alert}}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-failing.calls:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the alert to be sent")
+	}
+
+	// Shut down while the alert is waiting to be retried.
+	close(stop)
+	app.queue.Close()
+
+	// The entry is kept on disk for the provider which failed, without using up an attempt.
+	q, err := queue.New(queue.Opts{Dir: dir, Log: app.lo, Metrics: app.metrics})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, q.Len())
+
+	got := make(chan queue.Entry, 1)
+	q.Start(1, func(e *queue.Entry) queue.Outcome {
+		got <- *e
+		return queue.Sent
+	})
+	select {
+	case e := <-got:
+		assert.Equal(t, 0, e.Attempts)
+		assert.Equal(t, []queue.Target{{Name: "prod_webhook", Room: "prod", Alerts: []alertmgrtmpl.Alert{alert}}}, e.Targets)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the entry to be replayed")
+	}
+	q.Close()
+}
+
+func TestDispatchDeferred(t *testing.T) {
+	prov := newTestProvider("prod_webhook", providers.RetryPolicy{}, nil)
+	rl, err := ratelimit.New(prov, ratelimit.Opts{Log: logrus.New(), Metrics: metrics.New("calert"), Rate: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newTestApp(t, t.TempDir(), rl)
+
+	// The alert over the rate is retried once its token is available, without using up an attempt.
+	alerts := alertmgrtmpl.Alerts{{Status: "firing", Fingerprint: "a"}, {Status: "firing", Fingerprint: "b"}}
+	e := &queue.Entry{ID: "1", Room: "prod", Payload: alertmgrtmpl.Data{Alerts: alerts}}
+	assert.Equal(t, queue.Retry, app.dispatch(e))
+	assert.Equal(t, 0, e.Attempts)
+	assert.InDelta(t, 100*time.Millisecond, e.RetryAfter, float64(20*time.Millisecond))
+	assert.Equal(t, []queue.Target{{Name: "prod_webhook", Room: "prod", Alerts: []alertmgrtmpl.Alert{alerts[1]}}}, e.Targets)
+
+	time.Sleep(e.RetryAfter)
+	assert.Equal(t, queue.Sent, app.dispatch(e))
+	assert.Len(t, prov.calls, 2)
+}
+
+// newAdminApp returns an app with a dead letter store and the router of the admin API.
+func newAdminApp(t *testing.T, token string, provs ...providers.Provider) (*App, http.Handler) {
+	t.Helper()
+
+	app := newTestApp(t, t.TempDir(), provs...)
+	dls, err := deadletter.New(deadletter.Opts{Dir: t.TempDir(), Log: app.lo, Metrics: app.metrics})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.deadLetters = dls
+
+	r := chi.NewRouter()
+	r.Group(adminRoutes(app, token))
+	return app, r
+}
+
+func addDeadLetter(t *testing.T, app *App, name string) deadletter.Entry {
+	t.Helper()
+
+	e, err := app.deadLetters.Add(deadletter.Entry{
+		Provider: "webhook",
+		Name:     name,
+		Room:     "prod",
+		Alert:    alertmgrtmpl.Alert{Status: "firing", Fingerprint: "1a956348d0570965"},
+		Error:    "503 Service Unavailable",
+		Attempts: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func doRequest(h http.Handler, method, url, auth string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminToken(t *testing.T) {
+	_, h := newAdminApp(t, "secret")
+
+	for _, auth := range []string{"", "secret", "Basic secret", "Bearer wrong", "Bearer "} {
+		rec := doRequest(h, http.MethodGet, "/admin/deadletters", auth)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, auth)
+	}
+
+	rec := doRequest(h, http.MethodGet, "/admin/deadletters", "Bearer secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestRetryDeadLetter(t *testing.T) {
+	var (
+		ok      = newTestProvider("prod_webhook", providers.RetryPolicy{}, nil)
+		failing = newTestProvider("prod_audit", providers.RetryPolicy{},
+			&providers.StatusError{StatusCode: http.StatusBadRequest})
+		app, h = newAdminApp(t, "", ok, failing)
+	)
+
+	rec := doRequest(h, http.MethodPost, "/admin/deadletters/0000000000000000001-000001/retry", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// An entry which is being redriven by another request is rejected.
+	e := addDeadLetter(t, app, "prod_webhook")
+	if _, err := app.deadLetters.Claim(e.ID); err != nil {
+		t.Fatal(err)
+	}
+	rec = doRequest(h, http.MethodPost, "/admin/deadletters/"+e.ID+"/retry", "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	app.deadLetters.Release(e.ID)
+
+	// The entry is removed once it's sent.
+	rec = doRequest(h, http.MethodPost, "/admin/deadletters/"+e.ID+"/retry", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"success","data":{"id":"`+e.ID+`","sent":true}}`, rec.Body.String())
+	_, err := app.deadLetters.Get(e.ID)
+	assert.ErrorIs(t, err, deadletter.ErrNotFound)
+
+	// The entry is kept with the error if the provider fails again.
+	e = addDeadLetter(t, app, "prod_audit")
+	rec = doRequest(h, http.MethodPost, "/admin/deadletters/"+e.ID+"/retry", "")
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	var res resp
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res)) {
+		assert.Equal(t, "error", res.Status)
+		assert.Contains(t, res.Data.(map[string]interface{})["error"], "400")
+	}
+	got, err := app.deadLetters.Get(e.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 6, got.Attempts)
+	}
+}
+
+func TestRetryDeadLetters(t *testing.T) {
+	var (
+		ok     = newTestProvider("prod_webhook", providers.RetryPolicy{}, nil)
+		other  = newTestProvider("prod_audit", providers.RetryPolicy{}, nil)
+		app, h = newAdminApp(t, "", ok, other)
+		a      = addDeadLetter(t, app, "prod_webhook")
+		b      = addDeadLetter(t, app, "prod_webhook")
+		c      = addDeadLetter(t, app, "prod_audit")
+	)
+
+	// The matching entries are redriven in the background and their IDs are returned.
+	rec := doRequest(h, http.MethodPost, "/admin/deadletters/retry?name=prod_webhook", "")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	var res struct {
+		Data []string `json:"data"`
+	}
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res)) {
+		assert.Equal(t, []string{a.ID, b.ID}, res.Data)
+	}
+
+	assert.Eventually(t, func() bool {
+		list, err := app.deadLetters.List()
+		return err == nil && len(list) == 1 && list[0].ID == c.ID
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, ok.calls, 2)
+	assert.Len(t, other.calls, 0)
+}
+
+func TestDispatchQueueFull(t *testing.T) {
+	app := newTestApp(t, t.TempDir())
+	q, err := queue.New(queue.Opts{Dir: t.TempDir(), MaxSize: 1, Log: app.lo, Metrics: app.metrics})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.queue = q
+
+	r := chi.NewRouter()
+	r.Post("/dispatch", wrap(app, handleDispatchNotif))
+	dispatch := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/dispatch?room_name=prod", strings.NewReader(`{"alerts":[{"status":"firing","fingerprint":"a"}]}`))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := dispatch()
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Alertmanager is asked to retry later once the queue is full.
+	rec = dispatch()
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+	assert.Equal(t, 1, q.Len())
+}
@@ -9,10 +9,35 @@ import (
 	"github.com/knadh/koanf/parsers/toml"
 	"github.com/knadh/koanf/providers/env"
 	"github.com/knadh/koanf/providers/file"
+	"github.com/shpeliving/calert/internal/deadletter"
 	"github.com/shpeliving/calert/internal/metrics"
 	"github.com/shpeliving/calert/internal/notifier"
 	prvs "github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/providers/discord"
+	"github.com/shpeliving/calert/internal/providers/email"
+	fileprov "github.com/shpeliving/calert/internal/providers/file"
 	"github.com/shpeliving/calert/internal/providers/google_chat"
+	"github.com/shpeliving/calert/internal/providers/gotify"
+	"github.com/shpeliving/calert/internal/providers/kafka"
+	"github.com/shpeliving/calert/internal/providers/matrix"
+	"github.com/shpeliving/calert/internal/providers/mattermost"
+	"github.com/shpeliving/calert/internal/providers/mqtt"
+	"github.com/shpeliving/calert/internal/providers/ms_teams"
+	"github.com/shpeliving/calert/internal/providers/nats"
+	"github.com/shpeliving/calert/internal/providers/ntfy"
+	"github.com/shpeliving/calert/internal/providers/opsgenie"
+	"github.com/shpeliving/calert/internal/providers/pagerduty"
+	"github.com/shpeliving/calert/internal/providers/pushover"
+	"github.com/shpeliving/calert/internal/providers/ratelimit"
+	"github.com/shpeliving/calert/internal/providers/rocket_chat"
+	"github.com/shpeliving/calert/internal/providers/slack"
+	"github.com/shpeliving/calert/internal/providers/syslog"
+	"github.com/shpeliving/calert/internal/providers/telegram"
+	"github.com/shpeliving/calert/internal/providers/webex"
+	"github.com/shpeliving/calert/internal/providers/webhook"
+	"github.com/shpeliving/calert/internal/providers/zulip"
+	"github.com/shpeliving/calert/internal/queue"
+	"github.com/shpeliving/calert/internal/router"
 	"github.com/sirupsen/logrus"
 	flag "github.com/spf13/pflag"
 )
@@ -77,8 +102,9 @@ func initConfig(lo *logrus.Logger, cfgDefault string, envPrefix string) (*koanf.
 	return ko, nil
 }
 
-// initProviders loads all the providers specified in the config.
-func initProviders(ko *koanf.Koanf, lo *logrus.Logger, metrics *metrics.Manager) []prvs.Provider {
+// initProviders loads all the providers specified in the config. The retries
+// in progress are abandoned once `stop` is closed.
+func initProviders(ko *koanf.Koanf, lo *logrus.Logger, metrics *metrics.Manager, stop <-chan struct{}) []prvs.Provider {
 	provs := make([]prvs.Provider, 0)
 
 	// Loop over all providers listed in config.
@@ -86,6 +112,23 @@ func initProviders(ko *koanf.Koanf, lo *logrus.Logger, metrics *metrics.Manager)
 		cfgKey := fmt.Sprintf("providers.%s", name)
 		provType := ko.String(fmt.Sprintf("%s.type", cfgKey))
 
+		// Several providers can fan out alerts for the same room by setting `room`.
+		room := ko.String(fmt.Sprintf("%s.room", cfgKey))
+		if room == "" {
+			room = name
+		}
+
+		// Retry policy for the providers which talk to an HTTP API or an SMTP server.
+		retry := prvs.RetryPolicy{
+			MaxAttempts: ko.Int(fmt.Sprintf("%s.retry_max_attempts", cfgKey)),
+			MinBackoff:  ko.Duration(fmt.Sprintf("%s.retry_min_backoff", cfgKey)),
+			MaxBackoff:  ko.Duration(fmt.Sprintf("%s.retry_max_backoff", cfgKey)),
+			Stop:        stop,
+		}
+
+		// Index of the provider initialised in this iteration.
+		idx := len(provs)
+
 		switch provType {
 		case "google_chat":
 			gchat, err := google_chat.NewGoogleChat(
@@ -94,8 +137,10 @@ func initProviders(ko *koanf.Koanf, lo *logrus.Logger, metrics *metrics.Manager)
 					Timeout:     ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
 					MaxIdleConn: ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
 					ProxyURL:    ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:       retry,
 					Endpoint:    ko.MustString(fmt.Sprintf("%s.endpoint", cfgKey)),
-					Room:        name,
+					Name:        name,
+					Room:        room,
 					Template:    ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
 					ThreadTTL:   ko.MustDuration(fmt.Sprintf("%s.thread_ttl", cfgKey)),
 					Metrics:     metrics,
@@ -109,6 +154,612 @@ func initProviders(ko *koanf.Koanf, lo *logrus.Logger, metrics *metrics.Manager)
 
 			lo.WithField("room", gchat.Room()).Info("initialised provider")
 			provs = append(provs, gchat)
+
+		case "slack":
+			sl, err := slack.NewSlack(
+				slack.SlackOpts{
+					Log:         lo,
+					Timeout:     ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn: ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:    ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:       retry,
+					Endpoint:    ko.String(fmt.Sprintf("%s.endpoint", cfgKey)),
+					APIURL:      ko.String(fmt.Sprintf("%s.api_url", cfgKey)),
+					Token:       ko.String(fmt.Sprintf("%s.token", cfgKey)),
+					Channel:     ko.String(fmt.Sprintf("%s.channel", cfgKey)),
+					Name:        name,
+					Room:        room,
+					Template:    ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					ThreadTTL:   ko.MustDuration(fmt.Sprintf("%s.thread_ttl", cfgKey)),
+					Metrics:     metrics,
+					DryRun:      ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+					Blocks:      ko.Bool(fmt.Sprintf("%s.blocks", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising slack provider")
+			}
+
+			lo.WithField("room", sl.Room()).Info("initialised provider")
+			provs = append(provs, sl)
+
+		case "ms_teams":
+			teams, err := ms_teams.NewTeams(
+				ms_teams.TeamsOpts{
+					Log:         lo,
+					Timeout:     ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn: ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:    ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:       retry,
+					Endpoint:    ko.MustString(fmt.Sprintf("%s.endpoint", cfgKey)),
+					Name:        name,
+					Room:        room,
+					Template:    ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					Metrics:     metrics,
+					DryRun:      ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising ms teams provider")
+			}
+
+			lo.WithField("room", teams.Room()).Info("initialised provider")
+			provs = append(provs, teams)
+
+		case "webhook":
+			hook, err := webhook.NewWebhook(
+				webhook.WebhookOpts{
+					Log:               lo,
+					Timeout:           ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn:       ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:          ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:             retry,
+					Endpoint:          ko.MustString(fmt.Sprintf("%s.endpoint", cfgKey)),
+					Method:            ko.String(fmt.Sprintf("%s.method", cfgKey)),
+					Format:            ko.String(fmt.Sprintf("%s.format", cfgKey)),
+					Name:              name,
+					Room:              room,
+					Template:          ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					Headers:           ko.StringMap(fmt.Sprintf("%s.headers", cfgKey)),
+					BasicAuthUsername: ko.String(fmt.Sprintf("%s.basic_auth_username", cfgKey)),
+					BasicAuthPassword: ko.String(fmt.Sprintf("%s.basic_auth_password", cfgKey)),
+					BearerToken:       ko.String(fmt.Sprintf("%s.bearer_token", cfgKey)),
+					Metrics:           metrics,
+					DryRun:            ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising webhook provider")
+			}
+
+			lo.WithField("room", hook.Room()).Info("initialised provider")
+			provs = append(provs, hook)
+
+		case "discord":
+			dc, err := discord.NewDiscord(
+				discord.DiscordOpts{
+					Log:         lo,
+					Timeout:     ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn: ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:    ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:       retry,
+					Endpoint:    ko.MustString(fmt.Sprintf("%s.endpoint", cfgKey)),
+					Name:        name,
+					Room:        room,
+					Template:    ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					ThreadTTL:   ko.MustDuration(fmt.Sprintf("%s.thread_ttl", cfgKey)),
+					Colors:      ko.StringMap(fmt.Sprintf("%s.colors", cfgKey)),
+					Metrics:     metrics,
+					DryRun:      ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising discord provider")
+			}
+
+			lo.WithField("room", dc.Room()).Info("initialised provider")
+			provs = append(provs, dc)
+
+		case "telegram":
+			tg, err := telegram.NewTelegram(
+				telegram.TelegramOpts{
+					Log:         lo,
+					Timeout:     ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn: ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:    ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:       retry,
+					APIURL:      ko.String(fmt.Sprintf("%s.api_url", cfgKey)),
+					Token:       ko.MustString(fmt.Sprintf("%s.token", cfgKey)),
+					ChatID:      ko.MustString(fmt.Sprintf("%s.chat_id", cfgKey)),
+					ParseMode:   ko.String(fmt.Sprintf("%s.parse_mode", cfgKey)),
+					Name:        name,
+					Room:        room,
+					Template:    ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					ThreadTTL:   ko.MustDuration(fmt.Sprintf("%s.thread_ttl", cfgKey)),
+					Metrics:     metrics,
+					DryRun:      ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising telegram provider")
+			}
+
+			lo.WithField("room", tg.Room()).Info("initialised provider")
+			provs = append(provs, tg)
+
+		case "mattermost":
+			mm, err := mattermost.NewMattermost(
+				mattermost.MattermostOpts{
+					Log:         lo,
+					Timeout:     ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn: ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:    ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:       retry,
+					Endpoint:    ko.MustString(fmt.Sprintf("%s.endpoint", cfgKey)),
+					Token:       ko.String(fmt.Sprintf("%s.token", cfgKey)),
+					ChannelID:   ko.String(fmt.Sprintf("%s.channel_id", cfgKey)),
+					Username:    ko.String(fmt.Sprintf("%s.username", cfgKey)),
+					IconURL:     ko.String(fmt.Sprintf("%s.icon_url", cfgKey)),
+					Name:        name,
+					Room:        room,
+					Template:    ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					ThreadTTL:   ko.MustDuration(fmt.Sprintf("%s.thread_ttl", cfgKey)),
+					Metrics:     metrics,
+					DryRun:      ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising mattermost provider")
+			}
+
+			lo.WithField("room", mm.Room()).Info("initialised provider")
+			provs = append(provs, mm)
+
+		case "rocket_chat":
+			rc, err := rocket_chat.NewRocketChat(
+				rocket_chat.RocketChatOpts{
+					Log:         lo,
+					Timeout:     ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn: ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:    ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:       retry,
+					Endpoint:    ko.MustString(fmt.Sprintf("%s.endpoint", cfgKey)),
+					Token:       ko.String(fmt.Sprintf("%s.token", cfgKey)),
+					UserID:      ko.String(fmt.Sprintf("%s.user_id", cfgKey)),
+					Channel:     ko.String(fmt.Sprintf("%s.channel", cfgKey)),
+					Alias:       ko.String(fmt.Sprintf("%s.alias", cfgKey)),
+					Avatar:      ko.String(fmt.Sprintf("%s.avatar", cfgKey)),
+					Name:        name,
+					Room:        room,
+					Template:    ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					ThreadTTL:   ko.MustDuration(fmt.Sprintf("%s.thread_ttl", cfgKey)),
+					Metrics:     metrics,
+					DryRun:      ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising rocket.chat provider")
+			}
+
+			lo.WithField("room", rc.Room()).Info("initialised provider")
+			provs = append(provs, rc)
+
+		case "email":
+			em, err := email.NewEmail(
+				email.EmailOpts{
+					Log:                lo,
+					Timeout:            ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					Retry:              retry,
+					Host:               ko.MustString(fmt.Sprintf("%s.host", cfgKey)),
+					Port:               ko.MustInt(fmt.Sprintf("%s.port", cfgKey)),
+					TLSMode:            ko.String(fmt.Sprintf("%s.tls_mode", cfgKey)),
+					InsecureSkipVerify: ko.Bool(fmt.Sprintf("%s.tls_skip_verify", cfgKey)),
+					Auth:               ko.String(fmt.Sprintf("%s.auth", cfgKey)),
+					Username:           ko.String(fmt.Sprintf("%s.username", cfgKey)),
+					Password:           ko.String(fmt.Sprintf("%s.password", cfgKey)),
+					From:               ko.MustString(fmt.Sprintf("%s.from", cfgKey)),
+					To:                 ko.MustStrings(fmt.Sprintf("%s.to", cfgKey)),
+					Name:               name,
+					Room:               room,
+					Subject:            ko.String(fmt.Sprintf("%s.subject", cfgKey)),
+					HTMLTemplate:       ko.String(fmt.Sprintf("%s.html_template", cfgKey)),
+					TextTemplate:       ko.String(fmt.Sprintf("%s.text_template", cfgKey)),
+					ThreadTTL:          ko.MustDuration(fmt.Sprintf("%s.thread_ttl", cfgKey)),
+					Metrics:            metrics,
+					DryRun:             ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising email provider")
+			}
+
+			lo.WithField("room", em.Room()).Info("initialised provider")
+			provs = append(provs, em)
+
+		case "matrix":
+			mx, err := matrix.NewMatrix(
+				matrix.MatrixOpts{
+					Log:          lo,
+					Timeout:      ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn:  ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:     ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:        retry,
+					Homeserver:   ko.MustString(fmt.Sprintf("%s.homeserver", cfgKey)),
+					AccessToken:  ko.MustString(fmt.Sprintf("%s.access_token", cfgKey)),
+					RoomID:       ko.MustString(fmt.Sprintf("%s.room_id", cfgKey)),
+					MsgType:      ko.String(fmt.Sprintf("%s.msgtype", cfgKey)),
+					Name:         name,
+					Room:         room,
+					Template:     ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					HTMLTemplate: ko.String(fmt.Sprintf("%s.html_template", cfgKey)),
+					ThreadTTL:    ko.MustDuration(fmt.Sprintf("%s.thread_ttl", cfgKey)),
+					Metrics:      metrics,
+					DryRun:       ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising matrix provider")
+			}
+
+			lo.WithField("room", mx.Room()).Info("initialised provider")
+			provs = append(provs, mx)
+
+		case "pagerduty":
+			pd, err := pagerduty.NewPagerDuty(
+				pagerduty.PagerDutyOpts{
+					Log:         lo,
+					Timeout:     ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn: ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:    ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:       retry,
+					APIURL:      ko.String(fmt.Sprintf("%s.api_url", cfgKey)),
+					RoutingKey:  ko.MustString(fmt.Sprintf("%s.routing_key", cfgKey)),
+					Name:        name,
+					Room:        room,
+					Summary:     ko.String(fmt.Sprintf("%s.summary", cfgKey)),
+					Severity:    ko.String(fmt.Sprintf("%s.severity", cfgKey)),
+					Source:      ko.String(fmt.Sprintf("%s.source", cfgKey)),
+					Details:     ko.StringMap(fmt.Sprintf("%s.details", cfgKey)),
+					Metrics:     metrics,
+					DryRun:      ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising pagerduty provider")
+			}
+
+			lo.WithField("room", pd.Room()).Info("initialised provider")
+			provs = append(provs, pd)
+
+		case "opsgenie":
+			og, err := opsgenie.NewOpsgenie(
+				opsgenie.OpsgenieOpts{
+					Log:         lo,
+					Timeout:     ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn: ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:    ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:       retry,
+					APIURL:      ko.String(fmt.Sprintf("%s.api_url", cfgKey)),
+					APIKey:      ko.MustString(fmt.Sprintf("%s.api_key", cfgKey)),
+					Name:        name,
+					Room:        room,
+					Message:     ko.String(fmt.Sprintf("%s.message", cfgKey)),
+					Template:    ko.String(fmt.Sprintf("%s.template", cfgKey)),
+					Responders:  ko.Strings(fmt.Sprintf("%s.responders", cfgKey)),
+					Tags:        ko.Strings(fmt.Sprintf("%s.tags", cfgKey)),
+					Priorities:  ko.StringMap(fmt.Sprintf("%s.priorities", cfgKey)),
+					Metrics:     metrics,
+					DryRun:      ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising opsgenie provider")
+			}
+
+			lo.WithField("room", og.Room()).Info("initialised provider")
+			provs = append(provs, og)
+
+		case "ntfy":
+			nf, err := ntfy.NewNtfy(
+				ntfy.NtfyOpts{
+					Log:         lo,
+					Timeout:     ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn: ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:    ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:       retry,
+					Server:      ko.String(fmt.Sprintf("%s.server", cfgKey)),
+					Topic:       ko.MustString(fmt.Sprintf("%s.topic", cfgKey)),
+					Token:       ko.String(fmt.Sprintf("%s.token", cfgKey)),
+					Username:    ko.String(fmt.Sprintf("%s.username", cfgKey)),
+					Password:    ko.String(fmt.Sprintf("%s.password", cfgKey)),
+					Markdown:    ko.Bool(fmt.Sprintf("%s.markdown", cfgKey)),
+					Name:        name,
+					Room:        room,
+					Title:       ko.String(fmt.Sprintf("%s.title", cfgKey)),
+					Template:    ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					ClickURL:    ko.String(fmt.Sprintf("%s.click_url", cfgKey)),
+					Priorities:  ko.IntMap(fmt.Sprintf("%s.priorities", cfgKey)),
+					Metrics:     metrics,
+					DryRun:      ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising ntfy provider")
+			}
+
+			lo.WithField("room", nf.Room()).Info("initialised provider")
+			provs = append(provs, nf)
+
+		case "gotify":
+			gt, err := gotify.NewGotify(
+				gotify.GotifyOpts{
+					Log:         lo,
+					Timeout:     ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn: ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:    ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:       retry,
+					Server:      ko.MustString(fmt.Sprintf("%s.server", cfgKey)),
+					Token:       ko.MustString(fmt.Sprintf("%s.token", cfgKey)),
+					Markdown:    ko.Bool(fmt.Sprintf("%s.markdown", cfgKey)),
+					Name:        name,
+					Room:        room,
+					Title:       ko.String(fmt.Sprintf("%s.title", cfgKey)),
+					Template:    ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					ClickURL:    ko.String(fmt.Sprintf("%s.click_url", cfgKey)),
+					Priorities:  ko.IntMap(fmt.Sprintf("%s.priorities", cfgKey)),
+					Metrics:     metrics,
+					DryRun:      ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising gotify provider")
+			}
+
+			lo.WithField("room", gt.Room()).Info("initialised provider")
+			provs = append(provs, gt)
+
+		case "pushover":
+			po, err := pushover.NewPushover(
+				pushover.PushoverOpts{
+					Log:             lo,
+					Timeout:         ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn:     ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:        ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:           retry,
+					APIURL:          ko.String(fmt.Sprintf("%s.api_url", cfgKey)),
+					Token:           ko.MustString(fmt.Sprintf("%s.token", cfgKey)),
+					UserKey:         ko.MustString(fmt.Sprintf("%s.user_key", cfgKey)),
+					Device:          ko.String(fmt.Sprintf("%s.device", cfgKey)),
+					HTML:            ko.Bool(fmt.Sprintf("%s.html", cfgKey)),
+					EmergencyRetry:  ko.Duration(fmt.Sprintf("%s.emergency_retry", cfgKey)),
+					EmergencyExpire: ko.Duration(fmt.Sprintf("%s.emergency_expire", cfgKey)),
+					Name:            name,
+					Room:            room,
+					Title:           ko.String(fmt.Sprintf("%s.title", cfgKey)),
+					Template:        ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					ClickURL:        ko.String(fmt.Sprintf("%s.click_url", cfgKey)),
+					Priorities:      ko.IntMap(fmt.Sprintf("%s.priorities", cfgKey)),
+					Metrics:         metrics,
+					DryRun:          ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising pushover provider")
+			}
+
+			lo.WithField("room", po.Room()).Info("initialised provider")
+			provs = append(provs, po)
+
+		case "zulip":
+			zl, err := zulip.NewZulip(
+				zulip.ZulipOpts{
+					Log:         lo,
+					Timeout:     ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn: ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:    ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:       retry,
+					Site:        ko.MustString(fmt.Sprintf("%s.site", cfgKey)),
+					BotEmail:    ko.MustString(fmt.Sprintf("%s.bot_email", cfgKey)),
+					APIKey:      ko.MustString(fmt.Sprintf("%s.api_key", cfgKey)),
+					Stream:      ko.MustString(fmt.Sprintf("%s.stream", cfgKey)),
+					Name:        name,
+					Room:        room,
+					Topic:       ko.String(fmt.Sprintf("%s.topic", cfgKey)),
+					Template:    ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					ThreadTTL:   ko.MustDuration(fmt.Sprintf("%s.thread_ttl", cfgKey)),
+					Metrics:     metrics,
+					DryRun:      ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising zulip provider")
+			}
+
+			lo.WithField("room", zl.Room()).Info("initialised provider")
+			provs = append(provs, zl)
+
+		case "webex":
+			wx, err := webex.NewWebex(
+				webex.WebexOpts{
+					Log:          lo,
+					Timeout:      ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					MaxIdleConn:  ko.MustInt(fmt.Sprintf("%s.max_idle_conns", cfgKey)),
+					ProxyURL:     ko.String(fmt.Sprintf("%s.proxy_url", cfgKey)),
+					Retry:        retry,
+					APIURL:       ko.String(fmt.Sprintf("%s.api_url", cfgKey)),
+					Token:        ko.MustString(fmt.Sprintf("%s.token", cfgKey)),
+					RoomID:       ko.MustString(fmt.Sprintf("%s.room_id", cfgKey)),
+					Name:         name,
+					Room:         room,
+					Template:     ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					CardTemplate: ko.String(fmt.Sprintf("%s.card_template", cfgKey)),
+					ThreadTTL:    ko.MustDuration(fmt.Sprintf("%s.thread_ttl", cfgKey)),
+					Metrics:      metrics,
+					DryRun:       ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising webex provider")
+			}
+
+			lo.WithField("room", wx.Room()).Info("initialised provider")
+			provs = append(provs, wx)
+
+		case "syslog":
+			sl, err := syslog.NewSyslog(
+				syslog.SyslogOpts{
+					Log:                lo,
+					Timeout:            ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					Network:            ko.String(fmt.Sprintf("%s.network", cfgKey)),
+					Address:            ko.String(fmt.Sprintf("%s.address", cfgKey)),
+					CAFile:             ko.String(fmt.Sprintf("%s.ca_file", cfgKey)),
+					InsecureSkipVerify: ko.Bool(fmt.Sprintf("%s.insecure_skip_verify", cfgKey)),
+					Facility:           ko.String(fmt.Sprintf("%s.facility", cfgKey)),
+					Hostname:           ko.String(fmt.Sprintf("%s.hostname", cfgKey)),
+					AppName:            ko.String(fmt.Sprintf("%s.app_name", cfgKey)),
+					EnterpriseID:       ko.Int(fmt.Sprintf("%s.enterprise_id", cfgKey)),
+					Name:               name,
+					Room:               room,
+					Template:           ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					Metrics:            metrics,
+					DryRun:             ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising syslog provider")
+			}
+
+			lo.WithField("room", sl.Room()).Info("initialised provider")
+			provs = append(provs, sl)
+
+		case "file":
+			fl, err := fileprov.NewFile(
+				fileprov.FileOpts{
+					Log:            lo,
+					Path:           ko.MustString(fmt.Sprintf("%s.path", cfgKey)),
+					IncludeRaw:     ko.Bool(fmt.Sprintf("%s.include_raw", cfgKey)),
+					MaxSize:        ko.Int64(fmt.Sprintf("%s.max_size_mb", cfgKey)) * 1024 * 1024,
+					RotateInterval: ko.Duration(fmt.Sprintf("%s.rotate_interval", cfgKey)),
+					MaxBackups:     ko.Int(fmt.Sprintf("%s.max_backups", cfgKey)),
+					Compress:       ko.Bool(fmt.Sprintf("%s.compress", cfgKey)),
+					Name:           name,
+					Room:           room,
+					Template:       ko.MustString(fmt.Sprintf("%s.template", cfgKey)),
+					Metrics:        metrics,
+					DryRun:         ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising file provider")
+			}
+
+			lo.WithField("room", fl.Room()).Info("initialised provider")
+			provs = append(provs, fl)
+
+		case "kafka":
+			kf, err := kafka.NewKafka(
+				kafka.KafkaOpts{
+					Log:                lo,
+					Timeout:            ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					Brokers:            ko.MustStrings(fmt.Sprintf("%s.brokers", cfgKey)),
+					Topic:              ko.MustString(fmt.Sprintf("%s.topic", cfgKey)),
+					Acks:               ko.String(fmt.Sprintf("%s.acks", cfgKey)),
+					Compression:        ko.String(fmt.Sprintf("%s.compression", cfgKey)),
+					BatchSize:          ko.Int(fmt.Sprintf("%s.batch_size", cfgKey)),
+					BatchBytes:         ko.Int64(fmt.Sprintf("%s.batch_bytes", cfgKey)),
+					BatchTimeout:       ko.Duration(fmt.Sprintf("%s.batch_timeout", cfgKey)),
+					SASLMechanism:      ko.String(fmt.Sprintf("%s.sasl_mechanism", cfgKey)),
+					Username:           ko.String(fmt.Sprintf("%s.username", cfgKey)),
+					Password:           ko.String(fmt.Sprintf("%s.password", cfgKey)),
+					TLS:                ko.Bool(fmt.Sprintf("%s.tls", cfgKey)),
+					CAFile:             ko.String(fmt.Sprintf("%s.ca_file", cfgKey)),
+					InsecureSkipVerify: ko.Bool(fmt.Sprintf("%s.insecure_skip_verify", cfgKey)),
+					Name:               name,
+					Room:               room,
+					Template:           ko.String(fmt.Sprintf("%s.template", cfgKey)),
+					Metrics:            metrics,
+					DryRun:             ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising kafka provider")
+			}
+
+			lo.WithField("room", kf.Room()).Info("initialised provider")
+			provs = append(provs, kf)
+
+		case "nats":
+			nt, err := nats.NewNats(
+				nats.NatsOpts{
+					Log:       lo,
+					Timeout:   ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					URL:       ko.String(fmt.Sprintf("%s.url", cfgKey)),
+					Subject:   ko.MustString(fmt.Sprintf("%s.subject", cfgKey)),
+					JetStream: ko.Bool(fmt.Sprintf("%s.jetstream", cfgKey)),
+					CredsFile: ko.String(fmt.Sprintf("%s.creds_file", cfgKey)),
+					Token:     ko.String(fmt.Sprintf("%s.token", cfgKey)),
+					Username:  ko.String(fmt.Sprintf("%s.username", cfgKey)),
+					Password:  ko.String(fmt.Sprintf("%s.password", cfgKey)),
+					CAFile:    ko.String(fmt.Sprintf("%s.ca_file", cfgKey)),
+					Name:      name,
+					Room:      room,
+					Template:  ko.String(fmt.Sprintf("%s.template", cfgKey)),
+					Metrics:   metrics,
+					DryRun:    ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising nats provider")
+			}
+
+			lo.WithField("room", nt.Room()).Info("initialised provider")
+			provs = append(provs, nt)
+
+		case "mqtt":
+			mq, err := mqtt.NewMQTT(
+				mqtt.MQTTOpts{
+					Log:                lo,
+					Timeout:            ko.MustDuration(fmt.Sprintf("%s.timeout", cfgKey)),
+					Brokers:            ko.MustStrings(fmt.Sprintf("%s.brokers", cfgKey)),
+					ClientID:           ko.String(fmt.Sprintf("%s.client_id", cfgKey)),
+					Username:           ko.String(fmt.Sprintf("%s.username", cfgKey)),
+					Password:           ko.String(fmt.Sprintf("%s.password", cfgKey)),
+					CAFile:             ko.String(fmt.Sprintf("%s.ca_file", cfgKey)),
+					InsecureSkipVerify: ko.Bool(fmt.Sprintf("%s.insecure_skip_verify", cfgKey)),
+					Topic:              ko.MustString(fmt.Sprintf("%s.topic", cfgKey)),
+					QoS:                ko.Int(fmt.Sprintf("%s.qos", cfgKey)),
+					Retain:             ko.Bool(fmt.Sprintf("%s.retain", cfgKey)),
+					Name:               name,
+					Room:               room,
+					Template:           ko.String(fmt.Sprintf("%s.template", cfgKey)),
+					Metrics:            metrics,
+					DryRun:             ko.Bool(fmt.Sprintf("%s.dry_run", cfgKey)),
+				},
+			)
+			if err != nil {
+				lo.WithError(err).Fatal("error initialising mqtt provider")
+			}
+
+			lo.WithField("room", mq.Room()).Info("initialised provider")
+			provs = append(provs, mq)
+		}
+
+		// Wrap the provider with a rate limiter if `rate_limit` is set.
+		if r := ko.Float64(fmt.Sprintf("%s.rate_limit", cfgKey)); r > 0 && len(provs) > idx {
+			rl, err := ratelimit.New(provs[idx], ratelimit.Opts{
+				Log:       lo,
+				Metrics:   metrics,
+				Rate:      r,
+				Burst:     ko.Int(fmt.Sprintf("%s.rate_burst", cfgKey)),
+				QueueSize: ko.Int(fmt.Sprintf("%s.rate_queue_size", cfgKey)),
+				Overflow:  ko.String(fmt.Sprintf("%s.rate_overflow", cfgKey)),
+			})
+			if err != nil {
+				lo.WithError(err).WithField("room", room).Fatal("error initialising rate limit")
+			}
+
+			lo.WithField("provider", name).WithField("rate", r).Info("initialised rate limit")
+			provs[idx] = rl
 		}
 	}
 
@@ -123,6 +774,7 @@ func initProviders(ko *koanf.Koanf, lo *logrus.Logger, metrics *metrics.Manager)
 func initNotifier(ko *koanf.Koanf, lo *logrus.Logger, provs []prvs.Provider) notifier.Notifier {
 	n, err := notifier.Init(notifier.Opts{
 		Providers: provs,
+		Router:    initRouter(ko, lo),
 		Log:       lo,
 	})
 	if err != nil {
@@ -132,7 +784,88 @@ func initNotifier(ko *koanf.Koanf, lo *logrus.Logger, provs []prvs.Provider) not
 	return n
 }
 
+// initQueue initializes the on-disk queue of alerts to dispatch.
+func initQueue(ko *koanf.Koanf, lo *logrus.Logger, metrics *metrics.Manager) *queue.Queue {
+	dir := ko.String("queue.dir")
+	if dir == "" {
+		dir = "queue"
+	}
+
+	// The queue is bounded unless `max_size` is explicitly set to 0.
+	maxSize := queue.DefaultMaxSize
+	if ko.Exists("queue.max_size") {
+		maxSize = ko.Int("queue.max_size")
+	}
+
+	q, err := queue.New(queue.Opts{
+		Dir:        dir,
+		MaxSize:    maxSize,
+		RetryDelay: ko.Duration("queue.retry_delay"),
+		Log:        lo,
+		Metrics:    metrics,
+	})
+	if err != nil {
+		lo.WithError(err).WithField("dir", dir).Fatal("error initialising queue")
+	}
+
+	return q
+}
+
+// initDeadLetters initializes the store for alerts which failed to send.
+// It returns nil if the store is disabled.
+func initDeadLetters(ko *koanf.Koanf, lo *logrus.Logger, metrics *metrics.Manager) *deadletter.Store {
+	if !ko.Bool("deadletters.enabled") {
+		return nil
+	}
+
+	dir := ko.String("deadletters.dir")
+	if dir == "" {
+		dir = "deadletters"
+	}
+
+	s, err := deadletter.New(deadletter.Opts{
+		Dir:        dir,
+		MaxEntries: ko.Int("deadletters.max_entries"),
+		Log:        lo,
+		Metrics:    metrics,
+	})
+	if err != nil {
+		lo.WithError(err).WithField("dir", dir).Fatal("error initialising dead letter store")
+	}
+
+	return s
+}
+
 // initMetrics initializes a Metrics manager.
 func initMetrics() *metrics.Manager {
 	return metrics.New("calert")
 }
+
+// initRouter loads the `[[routes]]` specified in the config. It returns nil
+// if there are no routes or default route.
+func initRouter(ko *koanf.Koanf, lo *logrus.Logger) *router.Router {
+	var (
+		routes      []router.Route
+		defaultRoom = ko.String("default_route.room")
+	)
+
+	for i, r := range ko.Slices("routes") {
+		rt, err := router.NewRoute(
+			r.String("room"),
+			r.Strings("matchers"),
+			r.Strings("annotation_matchers"),
+			r.Bool("continue"),
+		)
+		if err != nil {
+			lo.WithError(err).WithField("route", i).Fatal("error initialising route")
+		}
+		routes = append(routes, rt)
+	}
+
+	if len(routes) == 0 && defaultRoom == "" {
+		return nil
+	}
+
+	lo.WithField("routes", len(routes)).WithField("default_room", defaultRoom).Info("initialised routes")
+	return router.New(routes, defaultRoom)
+}
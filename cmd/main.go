@@ -1,12 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"github.com/shpeliving/calert/internal/deadletter"
 	"github.com/shpeliving/calert/internal/metrics"
 	"github.com/shpeliving/calert/internal/notifier"
+	"github.com/shpeliving/calert/internal/queue"
 
 	"github.com/sirupsen/logrus"
 )
@@ -22,6 +31,14 @@ type App struct {
 	lo       *logrus.Logger
 	metrics  *metrics.Manager
 	notifier notifier.Notifier
+	queue    *queue.Queue
+	// deadLetters is nil if the dead letter store is disabled.
+	deadLetters *deadletter.Store
+	// retryAfter is sent to Alertmanager when the dispatch queue is full.
+	retryAfter time.Duration
+	// maxAttempts is the number of times a queued payload is dispatched before the
+	// alerts which still fail are stored as dead letters.
+	maxAttempts int
 }
 
 func main() {
@@ -35,10 +52,15 @@ func main() {
 		panic(err.Error())
 	}
 
+	// stop is closed on shutdown to abandon the retries in progress.
+	stop := make(chan struct{})
+
 	var (
 		metrics  = initMetrics()
-		provs    = initProviders(ko, lo, metrics)
+		provs    = initProviders(ko, lo, metrics, stop)
 		notifier = initNotifier(ko, lo, provs)
+		queue    = initQueue(ko, lo, metrics)
+		dls      = initDeadLetters(ko, lo, metrics)
 	)
 
 	// Enable debug mode if specified.
@@ -47,13 +69,26 @@ func main() {
 	}
 
 	app := &App{
-		lo:       lo,
-		notifier: notifier,
-		metrics:  metrics,
+		lo:          lo,
+		notifier:    notifier,
+		metrics:     metrics,
+		queue:       queue,
+		deadLetters: dls,
+		retryAfter:  ko.Duration("queue.retry_after"),
+		maxAttempts: ko.Int("queue.max_attempts"),
+	}
+	if app.retryAfter <= 0 {
+		app.retryAfter = 10 * time.Second
+	}
+	if app.maxAttempts <= 0 {
+		app.maxAttempts = 5
 	}
 
 	app.lo.WithField("version", buildString).Info("booting calert")
 
+	// Start the workers which dispatch the queued alerts, including the ones replayed from disk.
+	app.queue.Start(ko.Int("queue.workers"), app.dispatch)
+
 	// Initialise HTTP Router.
 	r := chi.NewRouter()
 
@@ -69,6 +104,33 @@ func main() {
 	r.Get("/metrics", wrap(app, handleMetrics))
 	r.Post("/dispatch", wrap(app, handleDispatchNotif))
 
+	// The admin API lists the rendered messages and resends alerts, so it's only
+	// served with a token or on a separate address.
+	var admin *http.Server
+	if app.deadLetters != nil {
+		var (
+			addr  = ko.String("app.admin_address")
+			token = ko.String("app.admin_token")
+		)
+		if addr == "" && token == "" {
+			app.lo.Fatal("app.admin_address or app.admin_token is required for the dead letter admin API")
+		}
+
+		routes := adminRoutes(app, token)
+		if addr == "" {
+			r.Group(routes)
+		} else {
+			ar := chi.NewRouter()
+			routes(ar)
+			admin = &http.Server{
+				Addr:         addr,
+				ReadTimeout:  ko.MustDuration("app.server_timeout"),
+				WriteTimeout: ko.MustDuration("app.server_timeout"),
+				Handler:      ar,
+			}
+		}
+	}
+
 	// Start HTTP Server.
 	app.lo.WithField("addr", ko.MustString("app.address")).Info("starting http server")
 	srv := &http.Server{
@@ -77,7 +139,63 @@ func main() {
 		WriteTimeout: ko.MustDuration("app.server_timeout"),
 		Handler:      r,
 	}
-	if err := srv.ListenAndServe(); err != nil {
-		app.lo.WithError(err).Fatal("couldn't start server")
+	servers := []*http.Server{srv}
+	if admin != nil {
+		app.lo.WithField("addr", admin.Addr).Info("starting admin http server")
+		servers = append(servers, admin)
+	}
+	for _, s := range servers {
+		go func(s *http.Server) {
+			if err := s.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				app.lo.WithError(err).WithField("addr", s.Addr).Fatal("couldn't start server")
+			}
+		}(s)
+	}
+
+	// Wait for a signal to shut down.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	app.lo.WithField("signal", (<-sig).String()).Info("shutting down")
+
+	// Don't wait for the backoff of the messages being retried, so the shutdown isn't held up.
+	close(stop)
+
+	// Stop accepting new alerts and wait for the requests in progress to finish.
+	ctx, cancel := context.WithTimeout(context.Background(), ko.MustDuration("app.server_timeout"))
+	defer cancel()
+	for _, s := range servers {
+		if err := s.Shutdown(ctx); err != nil {
+			app.lo.WithError(err).WithField("addr", s.Addr).Error("error shutting down server")
+		}
+	}
+
+	// Wait for the workers to finish the payloads they're dispatching. The alerts
+	// whose retries were abandoned stay in the queue along with the payloads which
+	// weren't dispatched, and they're all sent on the next start.
+	app.queue.Close()
+
+	// Flush the messages buffered by the providers and close their connections.
+	for _, p := range provs {
+		c, ok := p.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil {
+			app.lo.WithError(err).WithField("provider", p.Name()).Error("error closing provider")
+		}
+	}
+	app.lo.Info("shutdown complete")
+}
+
+// adminRoutes returns a function which registers the admin API on a router.
+// Requests must have the token if it's set.
+func adminRoutes(app *App, token string) func(r chi.Router) {
+	return func(r chi.Router) {
+		if token != "" {
+			r.Use(requireToken(token))
+		}
+		r.Get("/admin/deadletters", wrap(app, handleGetDeadLetters))
+		r.Post("/admin/deadletters/retry", wrap(app, handleRetryDeadLetters))
+		r.Post("/admin/deadletters/{id}/retry", wrap(app, handleRetryDeadLetter))
 	}
 }
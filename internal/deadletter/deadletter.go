@@ -0,0 +1,329 @@
+// Package deadletter stores the alerts which couldn't be sent to a provider
+// after all the retries, so they can be inspected and redriven later. Each entry
+// is kept in its own file in the store directory.
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	entrySuffix = ".json"
+	// DefaultMaxEntries is the number of entries kept if it isn't configured.
+	DefaultMaxEntries = 1000
+)
+
+var (
+	// ErrNotFound is returned when there's no entry with the ID.
+	ErrNotFound = errors.New("dead letter not found")
+	// ErrClaimed is returned by Claim when the entry is already being redriven.
+	ErrClaimed = errors.New("dead letter is already being redriven")
+
+	reID = regexp.MustCompile(`^[0-9]+-[0-9]+$`)
+)
+
+// Entry is an alert which failed to send to a provider.
+type Entry struct {
+	ID string `json:"id"`
+	// Provider is the type of the provider and Name is its unique name,
+	// which the entry is redriven to.
+	Provider string             `json:"provider"`
+	Name     string             `json:"name"`
+	Room     string             `json:"room"`
+	Alert    alertmgrtmpl.Alert `json:"alert"`
+	// Message is the rendered message which was sent to the provider, if it could be prepared.
+	Message  json.RawMessage `json:"message,omitempty"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+// Store keeps the entries on disk, ordered by the time they were added.
+type Store struct {
+	sync.Mutex
+
+	dir        string
+	maxEntries int
+	seq        uint64
+	lo         *logrus.Logger
+	metrics    *metrics.Manager
+
+	// claimed has the IDs of the entries being redriven.
+	claimed map[string]struct{}
+}
+
+type Opts struct {
+	Dir string
+	// MaxEntries is the number of entries to keep. The oldest entries are
+	// removed once it's exceeded.
+	MaxEntries int
+	Log        *logrus.Logger
+	Metrics    *metrics.Manager
+}
+
+// New initialises a store in `opts.Dir`.
+func New(opts Opts) (*Store, error) {
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("dead letter dir is required")
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultMaxEntries
+	}
+	if err := os.MkdirAll(opts.Dir, 0750); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		dir:        opts.Dir,
+		maxEntries: opts.MaxEntries,
+		lo:         opts.Log,
+		metrics:    opts.Metrics,
+		claimed:    make(map[string]struct{}),
+	}
+
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	s.metrics.Set(`deadletters`, float64(len(ids)))
+
+	return s, nil
+}
+
+// Add stores a new entry and returns it with its ID.
+func (s *Store) Add(e Entry) (Entry, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.seq++
+	e.ID = fmt.Sprintf("%019d-%06d", time.Now().UnixNano(), s.seq%1000000)
+	if e.FailedAt.IsZero() {
+		e.FailedAt = time.Now()
+	}
+	if err := s.write(e); err != nil {
+		return Entry{}, err
+	}
+	s.metrics.Increment(fmt.Sprintf(`deadletters_total{provider="%s", name="%s", room="%s"}`, e.Provider, e.Name, e.Room))
+
+	// Remove the oldest entries over the limit. The entries being redriven are
+	// skipped, so they aren't removed underneath the redrive.
+	ids, err := s.ids()
+	if err != nil {
+		return e, err
+	}
+	n := len(ids)
+	for _, id := range ids {
+		if n <= s.maxEntries {
+			break
+		}
+		if _, ok := s.claimed[id]; ok {
+			continue
+		}
+		s.lo.WithField("id", id).Warn("dead letter store is full, removing oldest entry")
+		if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+			return e, err
+		}
+		n--
+	}
+	s.metrics.Set(`deadletters`, float64(n))
+
+	return e, nil
+}
+
+// Update overwrites an existing entry.
+func (s *Store) Update(e Entry) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, err := s.get(e.ID); err != nil {
+		return err
+	}
+	return s.write(e)
+}
+
+// Get returns the entry with the ID.
+func (s *Store) Get(id string) (Entry, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.get(id)
+}
+
+// List returns all the entries, oldest first.
+func (s *Store) List() ([]Entry, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Entry, 0, len(ids))
+	for _, id := range ids {
+		e, err := s.get(id)
+		if err != nil {
+			// The entry may have been removed in between or be corrupt.
+			s.lo.WithError(err).WithField("id", id).Error("error reading dead letter")
+			continue
+		}
+		out = append(out, e)
+	}
+
+	return out, nil
+}
+
+// Claim returns the entry with the ID and marks it as being redriven, so it
+// isn't sent twice by concurrent redrives. It returns ErrClaimed if the entry is
+// already claimed. The entry must be released with Release once it's redriven.
+func (s *Store) Claim(id string) (Entry, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.claimed[id]; ok {
+		return Entry{}, ErrClaimed
+	}
+	e, err := s.get(id)
+	if err != nil {
+		return Entry{}, err
+	}
+	s.claimed[id] = struct{}{}
+
+	return e, nil
+}
+
+// Release releases an entry claimed with Claim.
+func (s *Store) Release(id string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.claimed, id)
+}
+
+// Delete removes the entry with the ID.
+func (s *Store) Delete(id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if !reID.MatchString(id) {
+		return ErrNotFound
+	}
+	if err := os.Remove(s.path(id)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+	s.metrics.Set(`deadletters`, float64(len(ids)))
+
+	return nil
+}
+
+func (s *Store) get(id string) (Entry, error) {
+	// IDs are used as file names, so anything else is rejected.
+	if !reID.MatchString(id) {
+		return Entry{}, ErrNotFound
+	}
+
+	b, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Entry{}, ErrNotFound
+		}
+		return Entry{}, err
+	}
+
+	var e Entry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return Entry{}, fmt.Errorf("error decoding dead letter %s: %v", id, err)
+	}
+	return e, nil
+}
+
+// write writes the entry to a temporary file and renames it over the entry once
+// it's synced to disk, so a crash never leaves a partially written entry behind.
+func (s *Store) write(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(s.dir, "."+e.ID+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, s.path(e.ID)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return syncDir(s.dir)
+}
+
+// ids returns the IDs of the entries in the order they were added.
+func (s *Store) ids() ([]string, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, f := range files {
+		id := strings.TrimSuffix(f.Name(), entrySuffix)
+		if f.IsDir() || id == f.Name() || !reID.MatchString(id) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+entrySuffix)
+}
+
+// syncDir flushes the directory entry of a renamed file to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
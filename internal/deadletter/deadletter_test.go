@@ -0,0 +1,121 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(Opts{Dir: dir, MaxEntries: 2, Log: logrus.New(), Metrics: metrics.New("calert")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, fp := range []string{"a", "b", "c"} {
+		e, err := s.Add(Entry{
+			Provider: "slack",
+			Name:     "prod_slack",
+			Room:     "prod",
+			Alert:    alertmgrtmpl.Alert{Fingerprint: fp},
+			Message:  json.RawMessage(`{"text":"disk is full"}`),
+			Error:    "non ok response from slack: 503",
+			Attempts: 3,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, e.ID)
+	}
+
+	// The oldest entry is removed once the store is full.
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, list, 2) {
+		assert.Equal(t, "b", list[0].Alert.Fingerprint)
+		assert.Equal(t, "c", list[1].Alert.Fingerprint)
+		assert.Equal(t, 3, list[0].Attempts)
+		assert.JSONEq(t, `{"text":"disk is full"}`, string(list[0].Message))
+		assert.False(t, list[0].FailedAt.IsZero())
+	}
+	_, err = s.Get(ids[0])
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	e, err := s.Get(ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Attempts = 6
+	assert.NoError(t, s.Update(e))
+	e, _ = s.Get(ids[1])
+	assert.Equal(t, 6, e.Attempts)
+
+	// An entry can only be claimed by one redrive at a time.
+	e, err = s.Claim(ids[1])
+	if assert.NoError(t, err) {
+		assert.Equal(t, ids[1], e.ID)
+	}
+	_, err = s.Claim(ids[1])
+	assert.ErrorIs(t, err, ErrClaimed)
+	s.Release(ids[1])
+	_, err = s.Claim(ids[1])
+	assert.NoError(t, err)
+	s.Release(ids[1])
+
+	assert.NoError(t, s.Delete(ids[1]))
+	assert.ErrorIs(t, s.Delete(ids[1]), ErrNotFound)
+	_, err = s.Claim(ids[1])
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// IDs are file names, so paths are rejected.
+	_, err = s.Get("../deadletter.go")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Entries are kept across restarts.
+	s, err = New(Opts{Dir: dir, Log: logrus.New(), Metrics: metrics.New("calert")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, _ = s.List()
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, ids[2], list[0].ID)
+	}
+}
+
+func TestStoreEvictClaimed(t *testing.T) {
+	s, err := New(Opts{Dir: t.TempDir(), MaxEntries: 2, Log: logrus.New(), Metrics: metrics.New("calert")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, fp := range []string{"a", "b"} {
+		e, err := s.Add(Entry{Name: "prod_slack", Room: "prod", Alert: alertmgrtmpl.Alert{Fingerprint: fp}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, e.ID)
+	}
+
+	// The oldest entry which isn't being redriven is removed instead of the claimed one.
+	if _, err := s.Claim(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(Entry{Name: "prod_slack", Room: "prod", Alert: alertmgrtmpl.Alert{Fingerprint: "c"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, _ := s.List()
+	if assert.Len(t, list, 2) {
+		assert.Equal(t, "a", list[0].Alert.Fingerprint)
+		assert.Equal(t, "c", list[1].Alert.Fingerprint)
+	}
+}
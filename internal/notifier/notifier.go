@@ -1,54 +1,228 @@
 package notifier
 
 import (
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	alertmgrtmpl "github.com/prometheus/alertmanager/template"
 	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/router"
 	"github.com/sirupsen/logrus"
 )
 
 // Notifier represents an instance that pushes out notifications to
 // upstream providers.
 type Notifier struct {
-	providers map[string]providers.Provider
+	providers map[string][]providers.Provider
+	router    *router.Router
 	lo        *logrus.Logger
 }
 
 type Opts struct {
 	Providers []providers.Provider
-	Log       *logrus.Logger
+	// Router (optional) picks the rooms for a payload based on its labels.
+	Router *router.Router
+	Log    *logrus.Logger
+}
+
+// Result is the outcome of pushing alerts to one of the providers of a room.
+type Result struct {
+	// Provider is the type of the provider and Name is its unique name.
+	Provider string
+	Name     string
+	Room     string
+	Duration time.Duration
+	// Err is nil if all the alerts were sent.
+	Err error
 }
 
 // Init initialises a new instance of the Notifier.
 func Init(opts Opts) (Notifier, error) {
-	// Initialise a map with room as the key and their corresponding provider instance.
-	m := make(map[string]providers.Provider, 0)
+	// Initialise a map with room as the key and the list of providers configured for it.
+	m := make(map[string][]providers.Provider, 0)
 
 	for _, prov := range opts.Providers {
 		room := prov.Room()
-		m[room] = prov
+		m[room] = append(m[room], prov)
+	}
+
+	// Check that all the rooms referred to by the routes have providers.
+	if opts.Router != nil {
+		for _, room := range opts.Router.Rooms() {
+			if _, ok := m[room]; !ok {
+				return Notifier{}, fmt.Errorf("no provider configured for room in routes: %s", room)
+			}
+		}
 	}
 
 	return Notifier{
 		lo:        opts.Log,
 		providers: m,
+		router:    opts.Router,
 	}, nil
 }
 
-// Dispatch pushes out a notification to an upstream provider.
-func (n *Notifier) Dispatch(payload alertmgrtmpl.Data, room string) error {
+// Dispatch pushes out a notification to all the providers of the rooms picked for
+// the payload concurrently and returns the result for each of them. If there are
+// routes, each alert is routed by its own labels and annotations and `room` is used
+// if none of them match. Alerts routed to the same room are sent in one batch.
+// Otherwise, the payload is sent to `room`.
+func (n *Notifier) Dispatch(payload alertmgrtmpl.Data, room string) ([]Result, error) {
 	n.lo.WithField("payload", payload).Debug("dispatch request payload")
 
 	n.lo.WithField("count", len(payload.Alerts)).Info("dispatching alerts")
 
-	// Lookup for the provider by the room name.
-	if _, ok := n.providers[room]; !ok {
-		n.lo.WithField("room", room).Warn("no provider available for room")
-		return fmt.Errorf("no provider configured for room: %s", room)
+	var (
+		targets []target
+		errs    []error
+	)
+	for _, b := range n.route(payload.Alerts, room) {
+		// Lookup for the providers by the room name.
+		provs, ok := n.providers[b.room]
+		if !ok {
+			n.lo.WithField("room", b.room).Warn("no provider available for room")
+			errs = append(errs, fmt.Errorf("no provider configured for room: %s", b.room))
+			continue
+		}
+		for _, prov := range provs {
+			targets = append(targets, target{room: b.room, prov: prov, alerts: b.alerts})
+		}
+	}
+
+	return n.push(targets), errors.Join(errs...)
+}
+
+// Redrive pushes the alerts to the provider of `room` with the unique name `name`.
+// It's used to resend the alerts which failed to dispatch, so the other providers
+// of the room which already received them aren't sent duplicates.
+func (n *Notifier) Redrive(name, room string, alerts []alertmgrtmpl.Alert) ([]Result, error) {
+	return n.Resend([]Target{{Name: name, Room: room, Alerts: alerts}})
+}
+
+// Target is a batch of alerts for the provider of `Room` with the unique name `Name`.
+type Target struct {
+	Name   string
+	Room   string
+	Alerts []alertmgrtmpl.Alert
+}
+
+// Resend pushes the alerts of each target to its provider concurrently, like
+// Redrive. Targets whose provider isn't configured are skipped with an error.
+func (n *Notifier) Resend(targets []Target) ([]Result, error) {
+	var (
+		out  []target
+		errs []error
+	)
+	for _, t := range targets {
+		prov := n.provider(t.Name, t.Room)
+		if prov == nil {
+			errs = append(errs, fmt.Errorf("no provider %s configured for room: %s", t.Name, t.Room))
+			continue
+		}
+		out = append(out, target{room: t.Room, prov: prov, alerts: t.Alerts})
 	}
-	// Push the batch of alerts.
-	n.providers[room].Push(payload.Alerts)
 
+	return n.push(out), errors.Join(errs...)
+}
+
+// provider returns the provider of `room` with the unique name `name`, or nil.
+func (n *Notifier) provider(name, room string) providers.Provider {
+	for _, prov := range n.providers[room] {
+		if prov.Name() == name {
+			return prov
+		}
+	}
 	return nil
 }
+
+// batch is a list of alerts routed to a room.
+type batch struct {
+	room   string
+	alerts []alertmgrtmpl.Alert
+}
+
+// route groups the alerts by the rooms picked for them, in the order the rooms
+// are first picked. The alerts in each batch keep their order in the payload.
+func (n *Notifier) route(alerts []alertmgrtmpl.Alert, room string) []batch {
+	if n.router == nil {
+		return []batch{{room: room, alerts: alerts}}
+	}
+
+	var (
+		out []batch
+		idx = make(map[string]int)
+	)
+	for _, a := range alerts {
+		rooms := n.router.Match(a.Labels, a.Annotations, room)
+		n.lo.WithField("fingerprint", a.Fingerprint).WithField("rooms", rooms).Debug("routed alert")
+
+		for _, r := range rooms {
+			i, ok := idx[r]
+			if !ok {
+				i = len(out)
+				idx[r] = i
+				out = append(out, batch{room: r})
+			}
+			out[i].alerts = append(out[i].alerts, a)
+		}
+	}
+
+	return out
+}
+
+// target is a batch of alerts to push to a provider.
+type target struct {
+	room   string
+	prov   providers.Provider
+	alerts []alertmgrtmpl.Alert
+}
+
+// push pushes the alerts to all the targets concurrently, logs and returns the results.
+func (n *Notifier) push(targets []target) []Result {
+	var (
+		res = make([]Result, len(targets))
+		wg  sync.WaitGroup
+	)
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+
+			// Push the batch of alerts.
+			now := time.Now()
+			err := t.prov.Push(t.alerts)
+			res[i] = Result{
+				Provider: t.prov.ID(),
+				Name:     t.prov.Name(),
+				Room:     t.room,
+				Duration: time.Since(now),
+				Err:      err,
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	for _, r := range res {
+		l := n.lo.WithField("provider", r.Name).WithField("room", r.Room).WithField("duration", r.Duration)
+		if r.Err != nil {
+			l.WithError(r.Err).Error("error dispatching alerts to provider")
+			continue
+		}
+		l.Info("dispatched alerts to provider")
+	}
+
+	return res
+}
+
+// Failed returns the results which have an error.
+func Failed(res []Result) []Result {
+	var out []Result
+	for _, r := range res {
+		if r.Err != nil {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,160 @@
+package notifier
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/router"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct {
+	id   string
+	name string
+	room string
+	err  error
+
+	mu     sync.Mutex
+	pushed int
+	calls  int
+}
+
+func (f *fakeProvider) ID() string   { return f.id }
+func (f *fakeProvider) Name() string { return f.name }
+func (f *fakeProvider) Room() string { return f.room }
+
+func (f *fakeProvider) Push(alerts []alertmgrtmpl.Alert) error {
+	f.mu.Lock()
+	f.pushed += len(alerts)
+	f.calls++
+	f.mu.Unlock()
+	return f.err
+}
+
+func TestDispatchFanOut(t *testing.T) {
+	var (
+		gchat   = &fakeProvider{id: "google_chat", name: "prod_chat", room: "prod"}
+		pd      = &fakeProvider{id: "pagerduty", name: "prod_pagerduty", room: "prod", err: errors.New("pagerduty is down")}
+		archive = &fakeProvider{id: "file", name: "prod_archive", room: "prod"}
+		audit   = &fakeProvider{id: "file", name: "prod_audit", room: "prod"}
+		dev     = &fakeProvider{id: "google_chat", name: "dev", room: "dev"}
+	)
+
+	n, err := Init(Opts{
+		Providers: []providers.Provider{gchat, pd, archive, audit, dev},
+		Log:       logrus.New(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := alertmgrtmpl.Data{Alerts: alertmgrtmpl.Alerts{{Status: "firing"}, {Status: "firing"}}}
+
+	res, err := n.Dispatch(payload, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, res, 4) {
+		// Results are in the order of the providers.
+		assert.Equal(t, "google_chat", res[0].Provider)
+		assert.NoError(t, res[0].Err)
+		assert.Equal(t, "pagerduty", res[1].Provider)
+		assert.EqualError(t, res[1].Err, "pagerduty is down")
+		// Providers of the same type are told apart by their names.
+		assert.Equal(t, "file", res[2].Provider)
+		assert.Equal(t, "prod_archive", res[2].Name)
+		assert.Equal(t, "file", res[3].Provider)
+		assert.Equal(t, "prod_audit", res[3].Name)
+	}
+	assert.Len(t, Failed(res), 1)
+
+	assert.Equal(t, 2, gchat.pushed)
+	assert.Equal(t, 2, pd.pushed)
+	assert.Equal(t, 2, archive.pushed)
+	assert.Equal(t, 2, audit.pushed)
+	assert.Equal(t, 0, dev.pushed)
+
+	_, err = n.Dispatch(payload, "staging")
+	assert.Error(t, err)
+}
+
+func TestDispatchRoutes(t *testing.T) {
+	var (
+		db   = &fakeProvider{id: "slack", room: "db"}
+		prod = &fakeProvider{id: "google_chat", room: "prod"}
+	)
+
+	rt, err := router.NewRoute("db", []string{`team="db"`}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Init(Opts{
+		Providers: []providers.Provider{db, prod},
+		Router:    router.New([]router.Route{rt}, ""),
+		Log:       logrus.New(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each alert in the group is routed by its own labels and the alerts
+	// for the same room are pushed in one batch.
+	payload := alertmgrtmpl.Data{
+		CommonLabels: alertmgrtmpl.KV{"alertname": "HighLatency"},
+		Alerts: alertmgrtmpl.Alerts{
+			{Status: "firing", Labels: alertmgrtmpl.KV{"team": "db"}},
+			{Status: "firing", Labels: alertmgrtmpl.KV{"team": "web"}},
+			{Status: "firing", Labels: alertmgrtmpl.KV{"team": "db"}},
+		},
+	}
+	if _, err := n.Dispatch(payload, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, db.pushed)
+	assert.Equal(t, 1, db.calls)
+	// The room from the request is used if no route matches.
+	assert.Equal(t, 1, prod.pushed)
+	assert.Equal(t, 1, prod.calls)
+
+	// Routes to rooms without providers are rejected.
+	rt.Room = "staging"
+	_, err = Init(Opts{Providers: []providers.Provider{db}, Router: router.New([]router.Route{rt}, ""), Log: logrus.New()})
+	assert.Error(t, err)
+}
+
+func TestRedrive(t *testing.T) {
+	var (
+		slack = &fakeProvider{id: "slack", name: "prod_slack", room: "prod"}
+		pd    = &fakeProvider{id: "pagerduty", name: "prod_pagerduty", room: "prod"}
+		hook  = &fakeProvider{id: "webhook", name: "prod_hook", room: "prod"}
+		audit = &fakeProvider{id: "webhook", name: "prod_audit", room: "prod"}
+	)
+
+	n, err := Init(Opts{Providers: []providers.Provider{slack, pd, hook, audit}, Log: logrus.New()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the provider of the dead letter receives the alerts again,
+	// even if there are other providers of the same type in the room.
+	res, err := n.Redrive("prod_audit", "prod", []alertmgrtmpl.Alert{{Status: "firing"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, res, 1) {
+		assert.Equal(t, "prod_audit", res[0].Name)
+	}
+	assert.Equal(t, 1, audit.pushed)
+	assert.Equal(t, 0, hook.pushed)
+	assert.Equal(t, 0, slack.pushed)
+	assert.Equal(t, 0, pd.pushed)
+
+	_, err = n.Redrive("prod_audit", "dev", []alertmgrtmpl.Alert{{Status: "firing"}})
+	assert.Error(t, err)
+}
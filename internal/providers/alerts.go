@@ -1,4 +1,4 @@
-package google_chat
+package providers
 
 import (
 	"sync"
@@ -24,32 +24,64 @@ type ActiveAlerts struct {
 type AlertDetails struct {
 	StartsAt time.Time
 	UUID     uuid.UUID
+	// MessageID is the upstream ID of the first message posted for the alert
+	// (eg `ts` in Slack). Providers which thread replies by message ID store it here.
+	MessageID string
 }
 
-// add adds an alert to the active alerts map.
-func (d *ActiveAlerts) add(a alertmgrtmpl.Alert) error {
+// NewActiveAlerts initialises an empty map of active alerts.
+func NewActiveAlerts(lo *logrus.Logger, metrics *metrics.Manager) *ActiveAlerts {
+	return &ActiveAlerts{
+		lo:      lo,
+		metrics: metrics,
+		alerts:  make(map[string]AlertDetails, 0),
+	}
+}
+
+// Add adds an alert to the active alerts map.
+func (d *ActiveAlerts) Add(a alertmgrtmpl.Alert) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.add(a)
+	return err
+}
+
+// GetOrAdd returns the details of an active alert based on the fingerprint and
+// adds the alert first if it isn't active. Both happen under the same lock, so
+// concurrent pushes for a new alert get the same thread.
+func (d *ActiveAlerts) GetOrAdd(a alertmgrtmpl.Alert) (AlertDetails, error) {
 	d.Lock()
 	defer d.Unlock()
 
+	if details, ok := d.alerts[a.Fingerprint]; ok {
+		return details, nil
+	}
+	return d.add(a)
+}
+
+// add adds an alert to the map. It must be called with the lock held.
+func (d *ActiveAlerts) add(a alertmgrtmpl.Alert) (AlertDetails, error) {
 	// Create a UUID for the alert. This UUID is
 	// sent as a `threadKey` param in G-Chat API.
 	// Set UUID for the alert.
 	uid, err := uuid.NewV4()
 	if err != nil {
-		return err
+		return AlertDetails{}, err
 	}
 
 	// Add the alert metadata to the map.
-	d.alerts[a.Fingerprint] = AlertDetails{
+	details := AlertDetails{
 		UUID:     uid,
 		StartsAt: a.StartsAt,
 	}
+	d.alerts[a.Fingerprint] = details
 
-	return nil
+	return details, nil
 }
 
-// loookup retrievs the UUID for the alert based on the fingerprint.
-func (d *ActiveAlerts) loookup(fingerprint string) string {
+// Lookup retrievs the UUID for the alert based on the fingerprint.
+func (d *ActiveAlerts) Lookup(fingerprint string) string {
 	d.RLock()
 	defer d.RUnlock()
 
@@ -60,6 +92,29 @@ func (d *ActiveAlerts) loookup(fingerprint string) string {
 	return d.alerts[fingerprint].UUID.String()
 }
 
+// Get returns the details of an active alert based on the fingerprint.
+func (d *ActiveAlerts) Get(fingerprint string) (AlertDetails, bool) {
+	d.RLock()
+	defer d.RUnlock()
+
+	a, ok := d.alerts[fingerprint]
+	return a, ok
+}
+
+// SetMessageID stores the upstream message ID for an active alert.
+// It's a no-op if the alert has already been pruned.
+func (d *ActiveAlerts) SetMessageID(fingerprint, id string) {
+	d.Lock()
+	defer d.Unlock()
+
+	a, ok := d.alerts[fingerprint]
+	if !ok {
+		return
+	}
+	a.MessageID = id
+	d.alerts[fingerprint] = a
+}
+
 // Prune iterates on a list of active alerts inside the map
 // and deletes them if they exceed the specified TTL.
 func (d *ActiveAlerts) Prune(ttl time.Duration) {
@@ -81,10 +136,9 @@ func (d *ActiveAlerts) Prune(ttl time.Duration) {
 	}
 
 	d.metrics.Duration(`alerts_prune_duration_seconds`, now)
-
 }
 
-// InitPruner is used to remove active alerts in the
+// StartPruneWorker is used to remove active alerts in the
 // map once their TTL is reached. The cleanup activity happens at periodic intervals.
 // This is a blocking function so the caller must invoke as a goroutine.
 // The reason for this background worker is
@@ -100,7 +154,7 @@ func (d *ActiveAlerts) Prune(ttl time.Duration) {
 // function as a GoRoutine and check if the alert creation timestamp has crossed our specified TTL. If it has, it'll delete the alert
 // entry from the map.
 // This check happens at a periodic interval specified by `pruneInterval` by the caller.
-func (d *ActiveAlerts) startPruneWorker(pruneInterval time.Duration, ttl time.Duration) {
+func (d *ActiveAlerts) StartPruneWorker(pruneInterval time.Duration, ttl time.Duration) {
 	var (
 		evalTicker = time.NewTicker(pruneInterval).C
 	)
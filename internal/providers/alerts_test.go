@@ -0,0 +1,39 @@
+package providers
+
+import (
+	"sync"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActiveAlertsGetOrAdd(t *testing.T) {
+	var (
+		active = NewActiveAlerts(logrus.New(), metrics.New("calert"))
+		alert  = alertmgrtmpl.Alert{Fingerprint: "1a956348d0570965"}
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		uuids  = make(map[string]bool)
+	)
+
+	// Concurrent pushes for a new alert get the same thread.
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			details, err := active.GetOrAdd(alert)
+			assert.NoError(t, err)
+
+			mu.Lock()
+			uuids[details.UUID.String()] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, uuids, 1)
+	assert.True(t, uuids[active.Lookup(alert.Fingerprint)])
+}
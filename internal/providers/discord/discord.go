@@ -0,0 +1,184 @@
+package discord
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultColors maps the `severity` label of an alert to the embed colour.
+var defaultColors = map[string]int{
+	"critical": 0xE01E5A,
+	"high":     0xE01E5A,
+	"warning":  0xFFA500,
+	"info":     0x3498DB,
+}
+
+const (
+	colorResolved = 0x2EB67D
+	colorDefault  = 0x95A5A6
+)
+
+type DiscordManager struct {
+	lo           *logrus.Logger
+	metrics      *metrics.Manager
+	activeAlerts *providers.ActiveAlerts
+	endpoint     *url.URL
+	name         string
+	room         string
+	client       *http.Client
+	retry        *providers.Retrier
+	msgTmpl      *template.Template
+	colors       map[string]int
+	dryRun       bool
+}
+
+type DiscordOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	Endpoint    string
+	// Name is the unique name of the provider in the config.
+	Name      string
+	Room      string
+	Template  string
+	ThreadTTL time.Duration
+	// Colors overrides the embed colour (hex, eg `#FF0000`) for a severity.
+	Colors map[string]string
+}
+
+// NewDiscord initializes a Discord provider object.
+func NewDiscord(opts DiscordOpts) (*DiscordManager, error) {
+	colors := make(map[string]int, len(defaultColors))
+	for k, v := range defaultColors {
+		colors[k] = v
+	}
+	for k, v := range opts.Colors {
+		c, err := strconv.ParseInt(strings.TrimPrefix(v, "#"), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing color for severity %s: %v", k, err)
+		}
+		colors[k] = int(c)
+	}
+
+	// The webhook URL can have query params, such as `thread_id`, which are kept on every request.
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing endpoint: %v", err)
+	}
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/")
+
+	// Initialise a generic HTTP Client for communicating with the Discord webhook.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the template.
+	tmpl, err := providers.LoadTemplate(opts.Template, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &DiscordManager{
+		lo:           opts.Log,
+		metrics:      opts.Metrics,
+		retry:        providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "discord", opts.Name, opts.Room),
+		client:       client,
+		endpoint:     endpoint,
+		name:         opts.Name,
+		room:         opts.Room,
+		activeAlerts: providers.NewActiveAlerts(opts.Log, opts.Metrics),
+		msgTmpl:      tmpl,
+		colors:       colors,
+		dryRun:       opts.DryRun,
+	}
+	// Start a background worker to cleanup alerts based on TTL mechanism.
+	go mgr.activeAlerts.StartPruneWorker(1*time.Hour, opts.ThreadTTL)
+
+	return mgr, nil
+}
+
+// Push accepts the list of alerts and dispatches them to the Discord webhook.
+// The first notification for an alert is posted as a new message and the
+// later ones (eg when it's resolved) edit the same message.
+func (m *DiscordManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to discord")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		// If it's a new alert whose fingerprint isn't in the active alerts map, add it first.
+		details, err := m.activeAlerts.GetOrAdd(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error adding active alert")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		msg, err := m.prepareMessage(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Send message to API.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			var id string
+			err := m.retry.Do(func() (err error) {
+				id, err = m.sendMessage(msg, details.MessageID)
+				return err
+			})
+			if err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				perr.Add(a, msg, err)
+				continue
+			}
+
+			// Store the message ID so that future updates edit the same message.
+			if id != details.MessageID {
+				m.activeAlerts.SetMessageID(a.Fingerprint, id)
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *DiscordManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *DiscordManager) ID() string {
+	return "discord"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *DiscordManager) Name() string {
+	return m.name
+}
@@ -0,0 +1,117 @@
+package discord
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscordEditOnResolve(t *testing.T) {
+	type request struct {
+		method string
+		path   string
+		query  url.Values
+		msg    Message
+	}
+	var received []request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, request{method: r.Method, path: r.URL.Path, query: r.URL.Query(), msg: msg})
+
+		w.Write([]byte(`{"id":"1111"}`))
+	}))
+	defer srv.Close()
+
+	discord, err := NewDiscord(DiscordOpts{
+		Log:      logrus.New(),
+		Metrics:  metrics.New("calert"),
+		Endpoint: srv.URL + "/api/webhooks/1/token?thread_id=42",
+		Room:     "qa",
+		Template: "../../../static/message.tmpl",
+		Colors:   map[string]string{"high": "#FF0000"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "high", "alertname": "TestAlert",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"team": "qa", "dryrun": "true",
+		}),
+		Fingerprint: "1a956348d0570965",
+	}
+	resolved := alert
+	resolved.Status = "resolved"
+
+	if err := discord.Push([]alertmgrtmpl.Alert{alert, resolved}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, received, 2)
+
+	assert.Equal(t, http.MethodPost, received[0].method)
+	assert.Equal(t, "/api/webhooks/1/token", received[0].path)
+	assert.Equal(t, url.Values{"thread_id": {"42"}, "wait": {"true"}}, received[0].query)
+	embed := received[0].msg.Embeds[0]
+	assert.Equal(t, "TestAlert - Firing", embed.Title)
+	assert.Equal(t, 0xFF0000, embed.Color)
+	assert.Equal(t, "Dryrun", embed.Fields[0].Name)
+	assert.Len(t, embed.Fields, 4)
+
+	assert.Equal(t, http.MethodPatch, received[1].method)
+	assert.Equal(t, "/api/webhooks/1/token/messages/1111", received[1].path)
+	assert.Equal(t, url.Values{"thread_id": {"42"}}, received[1].query)
+	assert.Equal(t, colorResolved, received[1].msg.Embeds[0].Color)
+
+	details, _ := discord.activeAlerts.Get(alert.Fingerprint)
+	assert.Equal(t, "1111", details.MessageID)
+}
+
+func TestDiscordEmbedSize(t *testing.T) {
+	discord, err := NewDiscord(DiscordOpts{
+		Log:      logrus.New(),
+		Metrics:  metrics.New("calert"),
+		Endpoint: "http://localhost/api/webhooks/1/token",
+		Room:     "qa",
+		Template: "../../../static/message.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each annotation fits in a field, but not all of them fit in the embed.
+	annotations := alertmgrtmpl.KV{}
+	for _, k := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		annotations[k] = strings.Repeat(k, maxFieldValueSize)
+	}
+	msg, err := discord.prepareMessage(alertmgrtmpl.Alert{
+		Status:      "firing",
+		Labels:      alertmgrtmpl.KV{"alertname": "TestAlert", "severity": "high"},
+		Annotations: annotations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	embed := msg.Embeds[0]
+	assert.LessOrEqual(t, embed.size(), maxEmbedSize)
+	assert.Less(t, len(embed.Fields), len(annotations))
+	// Smaller fields which still fit are kept.
+	assert.Equal(t, "severity", embed.Fields[len(embed.Fields)-1].Name)
+}
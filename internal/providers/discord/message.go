@@ -0,0 +1,182 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+)
+
+// Limits on the embed fields enforced by Discord.
+// https://discord.com/developers/docs/resources/channel#embed-object-embed-limits
+const (
+	maxTitleSize       = 256
+	maxDescriptionSize = 4096
+	maxFields          = 25
+	maxFieldNameSize   = 256
+	maxFieldValueSize  = 1024
+	// maxEmbedSize is the limit on the title, description and fields combined.
+	maxEmbedSize = 6000
+)
+
+type EmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type Embed struct {
+	Title       string       `json:"title"`
+	Description string       `json:"description,omitempty"`
+	URL         string       `json:"url,omitempty"`
+	Color       int          `json:"color"`
+	Fields      []EmbedField `json:"fields,omitempty"`
+	Timestamp   string       `json:"timestamp,omitempty"`
+}
+
+// Message represents the payload for executing or editing a webhook message.
+// https://discord.com/developers/docs/resources/webhook#execute-webhook
+type Message struct {
+	Embeds []Embed `json:"embeds"`
+}
+
+// prepareMessage renders the alert as an embed. The user provided template is used
+// for the description, the annotations are added as fields and the colour is picked
+// based on the `severity` label.
+func (m *DiscordManager) prepareMessage(alert alertmgrtmpl.Alert) (Message, error) {
+	var to bytes.Buffer
+
+	// Render a template with alert data.
+	if err := m.msgTmpl.Execute(&to, alert); err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return Message{}, err
+	}
+
+	embed := Embed{
+		Title:       truncate(alert.Labels["alertname"]+" - "+strings.Title(alert.Status), maxTitleSize),
+		Description: truncate(to.String(), maxDescriptionSize),
+		URL:         alert.GeneratorURL,
+		Color:       m.color(alert),
+		Timestamp:   alert.StartsAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+
+	for _, p := range alert.Annotations.SortedPairs() {
+		if p.Value == "" {
+			continue
+		}
+		embed.addField(EmbedField{
+			Name:  truncate(strings.Title(p.Name), maxFieldNameSize),
+			Value: truncate(p.Value, maxFieldValueSize),
+		})
+	}
+
+	for _, p := range alert.Labels.SortedPairs() {
+		embed.addField(EmbedField{
+			Name:   truncate(p.Name, maxFieldNameSize),
+			Value:  truncate(p.Value, maxFieldValueSize),
+			Inline: true,
+		})
+	}
+
+	return Message{Embeds: []Embed{embed}}, nil
+}
+
+// addField adds a field to the embed, unless the embed already has the maximum
+// number of fields or the field would take it over the total size limit.
+func (e *Embed) addField(f EmbedField) {
+	if len(e.Fields) == maxFields || e.size()+len(f.Name)+len(f.Value) > maxEmbedSize {
+		return
+	}
+	e.Fields = append(e.Fields, f)
+}
+
+// size returns the size of the embed counted against maxEmbedSize. Discord counts
+// characters, so the size in bytes is an upper bound.
+func (e *Embed) size() int {
+	n := len(e.Title) + len(e.Description)
+	for _, f := range e.Fields {
+		n += len(f.Name) + len(f.Value)
+	}
+	return n
+}
+
+// color returns the embed colour for the alert.
+func (m *DiscordManager) color(alert alertmgrtmpl.Alert) int {
+	if alert.Status == "resolved" {
+		return colorResolved
+	}
+	if c, ok := m.colors[strings.ToLower(alert.Labels["severity"])]; ok {
+		return c
+	}
+	return colorDefault
+}
+
+// sendMessage posts a new message to the webhook or edits the existing
+// message if `msgID` is non empty. It returns the ID of the message.
+func (m *DiscordManager) sendMessage(msg Message, msgID string) (string, error) {
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+
+	// `?wait=true` makes Discord respond with the created message.
+	var (
+		method   = http.MethodPost
+		endpoint = *m.endpoint
+		params   = endpoint.Query()
+	)
+	if msgID != "" {
+		method = http.MethodPatch
+		endpoint.Path += "/messages/" + msgID
+	} else {
+		params.Set("wait", "true")
+	}
+	endpoint.RawQuery = params.Encode()
+
+	// Prepare the request.
+	req, err := http.NewRequest(method, endpoint.String(), bytes.NewBuffer(out))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Send the request.
+	m.lo.WithField("method", method).WithField("msg", msg).Debug("sending alert")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// If the original message was deleted, post a new one instead.
+	if msgID != "" && resp.StatusCode == http.StatusNotFound {
+		m.lo.WithField("message_id", msgID).Warn("original message not found, posting a new one")
+		return m.sendMessage(msg, "")
+	}
+
+	// If response is non 200, log and throw the error.
+	if resp.StatusCode != http.StatusOK {
+		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from Discord Webhook endpoint")
+		return "", providers.NewStatusError(m.ID(), resp)
+	}
+
+	var r struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return "", err
+	}
+
+	return r.ID, nil
+}
+
+// truncate trims a string to `n` bytes, ending it with an ellipsis if it's trimmed.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return providers.Truncate(s, n-len("…")) + "…"
+}
@@ -0,0 +1,248 @@
+package email
+
+import (
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"net/mail"
+	"strings"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+// TLS modes for connecting to the SMTP server.
+const (
+	TLSModeNone     = "none"
+	TLSModeStartTLS = "starttls"
+	TLSModeTLS      = "tls"
+)
+
+// Auth mechanisms supported for authenticating with the SMTP server.
+const (
+	AuthPlain = "plain"
+	AuthLogin = "login"
+)
+
+const (
+	defaultSubject = `[{{ .Status | toUpper }}] {{ .Labels.alertname }}`
+)
+
+type EmailManager struct {
+	lo           *logrus.Logger
+	metrics      *metrics.Manager
+	activeAlerts *providers.ActiveAlerts
+	addr         string
+	host         string
+	username     string
+	password     string
+	auth         string
+	tlsMode      string
+	tlsConfig    *tls.Config
+	timeout      time.Duration
+	from         *mail.Address
+	to           []string
+	name         string
+	room         string
+	retry        *providers.Retrier
+	subjectTmpl  *template.Template
+	htmlTmpl     *htmltemplate.Template
+	textTmpl     *template.Template
+	dryRun       bool
+}
+
+type EmailOpts struct {
+	Log     *logrus.Logger
+	Metrics *metrics.Manager
+	DryRun  bool
+	Timeout time.Duration
+	Retry   providers.RetryPolicy
+	Host    string
+	Port    int
+	// TLSMode is one of `none`, `starttls` or `tls` (implicit TLS). Defaults to `starttls`.
+	TLSMode            string
+	InsecureSkipVerify bool
+	// Auth is one of `plain`, `login` or empty to skip authentication.
+	Auth     string
+	Username string
+	Password string
+	From     string
+	To       []string
+	// Name is the unique name of the provider in the config.
+	Name string
+	Room string
+	// Subject is a template string for the subject of the email.
+	Subject      string
+	HTMLTemplate string
+	TextTemplate string
+	ThreadTTL    time.Duration
+}
+
+// NewEmail initializes an SMTP email provider object.
+func NewEmail(opts EmailOpts) (*EmailManager, error) {
+	if opts.TLSMode == "" {
+		opts.TLSMode = TLSModeStartTLS
+	}
+	if opts.TLSMode != TLSModeNone && opts.TLSMode != TLSModeStartTLS && opts.TLSMode != TLSModeTLS {
+		return nil, fmt.Errorf("unknown tls mode: %s", opts.TLSMode)
+	}
+	if opts.Auth != "" && opts.Auth != AuthPlain && opts.Auth != AuthLogin {
+		return nil, fmt.Errorf("unknown auth mechanism: %s", opts.Auth)
+	}
+	if opts.HTMLTemplate == "" && opts.TextTemplate == "" {
+		return nil, fmt.Errorf("at least one of html_template or text_template is required")
+	}
+	if len(opts.To) == 0 {
+		return nil, fmt.Errorf("no recipients specified")
+	}
+
+	from, err := mail.ParseAddress(opts.From)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing from address: %v", err)
+	}
+
+	if opts.Subject == "" {
+		opts.Subject = defaultSubject
+	}
+	subject, err := providers.NewTemplate("subject", opts.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing subject template: %v", err)
+	}
+
+	// Load the templates.
+	mgr := &EmailManager{
+		lo:           opts.Log,
+		metrics:      opts.Metrics,
+		retry:        providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "email", opts.Name, opts.Room),
+		activeAlerts: providers.NewActiveAlerts(opts.Log, opts.Metrics),
+		addr:         fmt.Sprintf("%s:%d", opts.Host, opts.Port),
+		host:         opts.Host,
+		username:     opts.Username,
+		password:     opts.Password,
+		auth:         opts.Auth,
+		tlsMode:      opts.TLSMode,
+		tlsConfig: &tls.Config{
+			ServerName:         opts.Host,
+			InsecureSkipVerify: opts.InsecureSkipVerify,
+		},
+		timeout:     opts.Timeout,
+		from:        from,
+		to:          opts.To,
+		name:        opts.Name,
+		room:        opts.Room,
+		subjectTmpl: subject,
+		dryRun:      opts.DryRun,
+	}
+	if opts.HTMLTemplate != "" {
+		if mgr.htmlTmpl, err = providers.LoadHTMLTemplate(opts.HTMLTemplate, nil); err != nil {
+			return nil, err
+		}
+	}
+	if opts.TextTemplate != "" {
+		if mgr.textTmpl, err = providers.LoadTemplate(opts.TextTemplate, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// Start a background worker to cleanup alerts based on TTL mechanism.
+	go mgr.activeAlerts.StartPruneWorker(1*time.Hour, opts.ThreadTTL)
+
+	return mgr, nil
+}
+
+// Push accepts the list of alerts and sends them in a single digest email.
+// Emails for the same alert are threaded using the `In-Reply-To` and `References` headers.
+func (m *EmailManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to email")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	cs := make([]content, 0, len(alerts))
+	for _, a := range alerts {
+		// If it's a new alert whose fingerprint isn't in the active alerts map, add it first.
+		details, err := m.activeAlerts.GetOrAdd(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error adding active alert")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		c, err := m.render(a, details)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+		cs = append(cs, c)
+	}
+	if len(cs) == 0 {
+		return perr.OrNil()
+	}
+
+	msg, err := m.prepareMessage(cs)
+	if err != nil {
+		m.lo.WithError(err).Error("error preparing message")
+		for _, c := range cs {
+			perr.Add(c.alert, nil, err)
+		}
+		return perr.OrNil()
+	}
+
+	now := time.Now()
+
+	for range cs {
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+	}
+
+	// Send message to API.
+	if m.dryRun {
+		m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+	} else {
+		if err := m.retry.Do(func() error { return m.sendMessage(msg) }); err != nil {
+			m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+			m.lo.WithError(err).Error("error sending message")
+			for _, c := range cs {
+				perr.Add(c.alert, string(msg.Data), err)
+			}
+			return perr.OrNil()
+		}
+
+		// Mark the threads as started so that the next emails are sent as replies.
+		for _, c := range cs {
+			if c.details.MessageID == "" {
+				m.activeAlerts.SetMessageID(c.alert.Fingerprint, msg.ID)
+			}
+		}
+	}
+
+	m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *EmailManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *EmailManager) ID() string {
+	return "email"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *EmailManager) Name() string {
+	return m.name
+}
+
+// domain returns the domain of the sender, used in the `Message-ID` header.
+func (m *EmailManager) domain() string {
+	if i := strings.LastIndex(m.from.Address, "@"); i != -1 {
+		return m.from.Address[i+1:]
+	}
+	return "calert"
+}
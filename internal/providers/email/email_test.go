@@ -0,0 +1,187 @@
+package email
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSMTP accepts connections on a local port and sends the DATA of each email on the channel.
+func fakeSMTP(t *testing.T) (int, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	out := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			r := bufio.NewReader(conn)
+			io.WriteString(conn, "220 localhost ESMTP\r\n")
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					break
+				}
+				switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+				case strings.HasPrefix(cmd, "EHLO"):
+					io.WriteString(conn, "250 localhost\r\n")
+				case cmd == "DATA":
+					io.WriteString(conn, "354 go ahead\r\n")
+					var data strings.Builder
+					for {
+						l, _ := r.ReadString('\n')
+						if l == ".\r\n" {
+							break
+						}
+						data.WriteString(l)
+					}
+					out <- data.String()
+					io.WriteString(conn, "250 ok\r\n")
+				case cmd == "QUIT":
+					io.WriteString(conn, "221 bye\r\n")
+				default:
+					io.WriteString(conn, "250 ok\r\n")
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port, out
+}
+
+func TestEmailThreading(t *testing.T) {
+	port, received := fakeSMTP(t)
+
+	em, err := NewEmail(EmailOpts{
+		Log:     logrus.New(),
+		Metrics: metrics.New("calert"),
+		Host:    "127.0.0.1",
+		Port:    port,
+		TLSMode: TLSModeNone,
+		From:    "calert <alerts@example.com>",
+		To:      []string{"oncall@example.com"},
+		Room:    "qa",
+		// Missing labels are rendered as empty strings.
+		Subject:      "[{{ .Status | toUpper }}] {{ .Labels.alertname }} {{ .Labels.team }}",
+		HTMLTemplate: "../../../static/email.html.tmpl",
+		TextTemplate: "../../../static/message.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "<i>high</i>", "alertname": "TestAlert",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"summary": "<b>disk</b> is full",
+		}),
+		Fingerprint: "1a956348d0570965",
+	}
+	resolved := alert
+	resolved.Status = "resolved"
+
+	if err := em.Push([]alertmgrtmpl.Alert{alert}); err != nil {
+		t.Fatal(err)
+	}
+	first, err := mail.ReadMessage(strings.NewReader(<-received))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uuid := em.activeAlerts.Lookup(alert.Fingerprint)
+	assert.Equal(t, "<"+uuid+"@example.com>", first.Header.Get("Message-ID"))
+	assert.Empty(t, first.Header.Get("In-Reply-To"))
+	assert.Equal(t, "[FIRING] TestAlert", first.Header.Get("Subject"))
+
+	// The alerts of a notification are sent in a single email, which replies to
+	// the thread of the resolved alert and starts the thread of the new one.
+	other := alertmgrtmpl.Alert{
+		Status:      "firing",
+		Labels:      alertmgrtmpl.KV(map[string]string{"severity": "low", "alertname": "OtherAlert"}),
+		Annotations: alertmgrtmpl.KV(map[string]string{"summary": "cpu is busy"}),
+		Fingerprint: "c0ffee00d0570965",
+	}
+	if err := em.Push([]alertmgrtmpl.Alert{resolved, other}); err != nil {
+		t.Fatal(err)
+	}
+	second, err := mail.ReadMessage(strings.NewReader(<-received))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uuid = em.activeAlerts.Lookup(other.Fingerprint)
+	assert.Equal(t, "<"+uuid+"@example.com>", second.Header.Get("Message-ID"))
+	assert.Equal(t, "[RESOLVED] TestAlert (+1 more)", second.Header.Get("Subject"))
+	assert.Equal(t, first.Header.Get("Message-ID"), second.Header.Get("In-Reply-To"))
+	assert.Equal(t, first.Header.Get("Message-ID"), second.Header.Get("References"))
+	assert.Equal(t, []string{"1a956348d0570965", "c0ffee00d0570965"}, second.Header["X-Calert-Fingerprint"])
+
+	body, _ := io.ReadAll(second.Body)
+	assert.Contains(t, string(body), "Summary: <b>disk</b> is full")
+	assert.Contains(t, string(body), "Summary: cpu is busy")
+
+	// Both threads are replied to by the next email.
+	other.Status = "resolved"
+	if err := em.Push([]alertmgrtmpl.Alert{alert, other}); err != nil {
+		t.Fatal(err)
+	}
+	third, err := mail.ReadMessage(strings.NewReader(<-received))
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := first.Header.Get("Message-ID") + " " + second.Header.Get("Message-ID")
+	assert.Equal(t, refs, third.Header.Get("In-Reply-To"))
+	assert.Equal(t, refs, third.Header.Get("References"))
+	assert.NotEqual(t, second.Header.Get("Message-ID"), third.Header.Get("Message-ID"))
+
+	// Check that both the parts are present.
+	mediaType, params, err := mime.ParseMediaType(first.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	mr := multipart.NewReader(first.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(p)
+		parts = append(parts, p.Header.Get("Content-Type")+"\n"+string(b))
+	}
+
+	assert.Len(t, parts, 2)
+	assert.Contains(t, parts[0], "text/plain")
+	assert.Contains(t, parts[0], "Summary: <b>disk</b> is full")
+	assert.Contains(t, parts[1], "text/html")
+	// Labels and annotations are escaped in the HTML part.
+	assert.Contains(t, parts[1], "&lt;b&gt;disk&lt;/b&gt; is full")
+	assert.Contains(t, parts[1], "(&lt;I&gt;HIGH&lt;/I&gt;)")
+	assert.NotContains(t, parts[1], "<I>")
+}
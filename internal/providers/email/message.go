@@ -0,0 +1,308 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+)
+
+// Message represents a rendered email.
+type Message struct {
+	// ID is the `Message-ID` of the email.
+	ID   string
+	Data []byte
+}
+
+// content is an alert with its rendered subject and bodies.
+type content struct {
+	alert   alertmgrtmpl.Alert
+	details providers.AlertDetails
+	subject string
+	html    []byte
+	text    []byte
+}
+
+// render renders the subject and body templates for an alert.
+func (m *EmailManager) render(alert alertmgrtmpl.Alert, details providers.AlertDetails) (content, error) {
+	var (
+		html, text bytes.Buffer
+		c          = content{alert: alert, details: details}
+		err        error
+	)
+
+	// Render the templates with alert data.
+	if c.subject, err = providers.Render(m.subjectTmpl, alert); err != nil {
+		m.lo.WithError(err).Error("Error parsing values in subject template")
+		return c, err
+	}
+	if m.htmlTmpl != nil {
+		if err := m.htmlTmpl.Execute(&html, alert); err != nil {
+			m.lo.WithError(err).Error("Error parsing values in html template")
+			return c, err
+		}
+	}
+	if m.textTmpl != nil {
+		if err := m.textTmpl.Execute(&text, alert); err != nil {
+			m.lo.WithError(err).Error("Error parsing values in text template")
+			return c, err
+		}
+	}
+	c.html, c.text = html.Bytes(), text.Bytes()
+
+	return c, nil
+}
+
+// prepareMessage builds a digest email with the rendered alerts, in order. The
+// subject is the one of the first alert, with the number of other alerts if
+// there are more. The email starts the thread of the alerts which don't have one
+// yet, using the UUID of the first of them in its `Message-ID`, and replies to
+// the threads of the others.
+func (m *EmailManager) prepareMessage(cs []content) (Message, error) {
+	var (
+		buf        bytes.Buffer
+		html, text [][]byte
+		refs       []string
+		// start is the first alert which doesn't have a thread yet.
+		start *content
+	)
+	for i, c := range cs {
+		html = append(html, c.html)
+		text = append(text, c.text)
+
+		if c.details.MessageID == "" {
+			if start == nil {
+				start = &cs[i]
+			}
+			continue
+		}
+		if !contains(refs, c.details.MessageID) {
+			refs = append(refs, c.details.MessageID)
+		}
+	}
+
+	msg := Message{ID: fmt.Sprintf("<%s.%d@%s>", cs[0].details.UUID, time.Now().UnixNano(), m.domain())}
+	if start != nil {
+		msg.ID = fmt.Sprintf("<%s@%s>", start.details.UUID, m.domain())
+	}
+
+	subject := cs[0].subject
+	if len(cs) > 1 {
+		subject = fmt.Sprintf("%s (+%d more)", subject, len(cs)-1)
+	}
+
+	h := textproto.MIMEHeader{}
+	h.Set("From", m.from.String())
+	h.Set("To", strings.Join(m.to, ", "))
+	h.Set("Subject", mime.QEncoding.Encode("utf-8", subject))
+	h.Set("Date", time.Now().Format(time.RFC1123Z))
+	h.Set("MIME-Version", "1.0")
+	h.Set("Message-ID", msg.ID)
+	for _, c := range cs {
+		h.Add("X-Calert-Fingerprint", c.alert.Fingerprint)
+	}
+
+	// Reply to the first emails of the threads which have already been sent.
+	if len(refs) > 0 {
+		h.Set("In-Reply-To", strings.Join(refs, " "))
+		h.Set("References", strings.Join(refs, " "))
+	}
+
+	// The alerts are separated with a rule.
+	var (
+		htmlBody = bytes.Join(html, []byte("<hr>\n"))
+		textBody = bytes.Join(text, []byte("\n---\n\n"))
+	)
+
+	switch {
+	case m.htmlTmpl != nil && m.textTmpl != nil:
+		mw := multipart.NewWriter(&buf)
+		h.Set("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+		writeHeader(&buf, h)
+
+		// Parts are ordered by preference, so the HTML part goes last.
+		for _, p := range []struct {
+			contentType string
+			body        []byte
+		}{
+			{"text/plain; charset=utf-8", textBody},
+			{"text/html; charset=utf-8", htmlBody},
+		} {
+			w, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {p.contentType},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+			if err != nil {
+				return msg, err
+			}
+			if err := writeQP(w, p.body); err != nil {
+				return msg, err
+			}
+		}
+		if err := mw.Close(); err != nil {
+			return msg, err
+		}
+
+	case m.htmlTmpl != nil:
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&buf, h)
+		if err := writeQP(&buf, htmlBody); err != nil {
+			return msg, err
+		}
+
+	default:
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&buf, h)
+		if err := writeQP(&buf, textBody); err != nil {
+			return msg, err
+		}
+	}
+
+	msg.Data = buf.Bytes()
+
+	return msg, nil
+}
+
+// sendMessage connects to the SMTP server and sends the email to all the recipients.
+func (m *EmailManager) sendMessage(msg Message) error {
+	conn, err := net.DialTimeout("tcp", m.addr, m.timeout)
+	if err != nil {
+		return err
+	}
+	if m.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(m.timeout))
+	}
+	if m.tlsMode == TLSModeTLS {
+		conn = tls.Client(conn, m.tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if m.tlsMode == TLSModeStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server doesn't support STARTTLS")
+		}
+		if err := c.StartTLS(m.tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	switch m.auth {
+	case AuthPlain:
+		err = c.Auth(smtp.PlainAuth("", m.username, m.password, m.host))
+	case AuthLogin:
+		err = c.Auth(&loginAuth{username: m.username, password: m.password, host: m.host})
+	}
+	if err != nil {
+		return err
+	}
+
+	// Send the email.
+	m.lo.WithField("addr", m.addr).WithField("message_id", msg.ID).Debug("sending alert")
+	if err := c.Mail(m.from.Address); err != nil {
+		return err
+	}
+	for _, to := range m.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	// The email is sent once the server accepts the data, so an error on QUIT
+	// is only logged to avoid sending it again on retry.
+	if err := c.Quit(); err != nil {
+		m.lo.WithError(err).Debug("error closing smtp session")
+	}
+
+	return nil
+}
+
+// loginAuth implements the LOGIN authentication mechanism which isn't
+// available in `net/smtp` but is still used by a lot of servers.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Like PlainAuth, refuse to send the credentials over an unencrypted connection.
+	if !server.TLS && a.host != "localhost" && a.host != "127.0.0.1" && a.host != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+
+	return nil, fmt.Errorf("unexpected server challenge: %s", fromServer)
+}
+
+// writeHeader writes the headers followed by a blank line.
+func writeHeader(w io.Writer, h textproto.MIMEHeader) {
+	for _, k := range []string{"From", "To", "Subject", "Date", "Message-ID", "In-Reply-To", "References",
+		"MIME-Version", "Content-Type", "Content-Transfer-Encoding", "X-Calert-Fingerprint"} {
+		for _, v := range h.Values(k) {
+			fmt.Fprintf(w, "%s: %s\r\n", k, v)
+		}
+	}
+	io.WriteString(w, "\r\n")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// writeQP writes the body with quoted-printable encoding.
+func writeQP(w io.Writer, body []byte) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write(body); err != nil {
+		return err
+	}
+	return qp.Close()
+}
@@ -0,0 +1,125 @@
+package file
+
+import (
+	"fmt"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+type FileManager struct {
+	lo         *logrus.Logger
+	metrics    *metrics.Manager
+	out        *rotatingFile
+	includeRaw bool
+	name       string
+	room       string
+	msgTmpl    *template.Template
+	dryRun     bool
+}
+
+type FileOpts struct {
+	Log     *logrus.Logger
+	Metrics *metrics.Manager
+	DryRun  bool
+	// Path is the file which the alerts are appended to.
+	Path string
+	// IncludeRaw adds the alert received from Alertmanager to each line.
+	IncludeRaw bool
+	// MaxSize (in bytes) and RotateInterval are the size and age after which
+	// the file is rotated. Zero disables either.
+	MaxSize        int64
+	RotateInterval time.Duration
+	// MaxBackups is the number of rotated files to keep. Zero keeps all.
+	MaxBackups int
+	// Compress gzips the rotated files.
+	Compress bool
+	// Name is the unique name of the provider in the config.
+	Name     string
+	Room     string
+	Template string
+}
+
+// NewFile initializes a file provider object.
+func NewFile(opts FileOpts) (*FileManager, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	// Load the template.
+	tmpl, err := providers.LoadTemplate(opts.Template, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := newRotatingFile(opts.Log, opts.Path, opts.MaxSize, opts.RotateInterval, opts.MaxBackups, opts.Compress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileManager{
+		lo:         opts.Log,
+		metrics:    opts.Metrics,
+		out:        out,
+		includeRaw: opts.IncludeRaw,
+		name:       opts.Name,
+		room:       opts.Room,
+		msgTmpl:    tmpl,
+		dryRun:     opts.DryRun,
+	}, nil
+}
+
+// Push accepts the list of alerts and appends a JSON line for each of them.
+func (m *FileManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to file")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		line, err := m.prepareLine(a, time.Now())
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Write the line to the file.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			if _, err := m.out.Write(line); err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error writing to file")
+				perr.Add(a, string(line), err)
+				continue
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *FileManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *FileManager) ID() string {
+	return "file"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *FileManager) Name() string {
+	return m.name
+}
@@ -0,0 +1,197 @@
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileRotation(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		path = filepath.Join(dir, "alerts.jsonl")
+	)
+
+	fm, err := NewFile(FileOpts{
+		Log:        logrus.New(),
+		Metrics:    metrics.New("calert"),
+		Path:       path,
+		IncludeRaw: true,
+		Compress:   true,
+		Room:       "archive",
+		Template:   "../../../static/message.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "high", "alertname": "TestAlert",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"summary": "disk is full",
+		}),
+		Fingerprint: "1a956348d0570965",
+	}
+
+	// Rotate the file every 3 lines.
+	line, err := fm.prepareLine(alert, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm.out.maxSize = int64(len(line)*3 + len(line)/2)
+
+	for i := 0; i < 4; i++ {
+		if err := fm.Push([]alertmgrtmpl.Alert{alert}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Wait for the rotated file to be compressed in the background.
+	fm.out.wg.Wait()
+
+	lines := readLines(t, path)
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "archive", lines[0].Room)
+		assert.Equal(t, "1a956348d0570965", lines[0].Fingerprint)
+		assert.Contains(t, lines[0].Message, "TestAlert")
+		if assert.NotNil(t, lines[0].Alert) {
+			assert.Equal(t, alert.Labels, lines[0].Alert.Labels)
+		}
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, "alerts-*.jsonl.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, backups, 1) {
+		f, err := os.Open(backups[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for sc := bufio.NewScanner(gz); sc.Scan(); n++ {
+		}
+		assert.Equal(t, 3, n)
+	}
+
+	// Rotate based on the age of the file.
+	fm.out.interval = time.Minute
+	fm.out.openedAt = time.Now().Add(-2 * time.Minute)
+	if err := fm.Push([]alertmgrtmpl.Alert{alert}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, readLines(t, path), 1)
+
+	fm.out.wg.Wait()
+	backups, _ = filepath.Glob(filepath.Join(dir, "alerts-*.jsonl.gz"))
+	assert.Len(t, backups, 2)
+
+	// The line is still written if the file can't be rotated, eg if it was removed.
+	os.Remove(path)
+	fm.out.openedAt = time.Now().Add(-2 * time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := fm.Push([]alertmgrtmpl.Alert{alert}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Len(t, readLines(t, path), 2)
+}
+
+func TestRotationBackups(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		path = filepath.Join(dir, "alerts.jsonl")
+		// A file of another provider in the same directory.
+		sibling = filepath.Join(dir, "alerts-critical.jsonl")
+	)
+	os.WriteFile(sibling, []byte("{}\n"), 0644)
+
+	r, err := newRotatingFile(logrus.New(), path, 0, 0, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Files rotated in the same millisecond don't overwrite each other.
+	var (
+		now   = time.Now()
+		names []string
+	)
+	for i := 0; i < 3; i++ {
+		name := r.backupName(now)
+		os.WriteFile(name, []byte("{}\n"), 0644)
+		names = append(names, name)
+	}
+	assert.NotEqual(t, names[0], names[1])
+	assert.NotEqual(t, names[1], names[2])
+
+	// A backup which is being compressed.
+	tmp := names[2] + compressSuffix + tmpSuffix
+	os.WriteFile(tmp, nil, 0644)
+
+	// Only the oldest backup is removed and the other files are left alone.
+	assert.NoError(t, r.removeOldBackups())
+	assert.NoFileExists(t, names[0])
+	assert.FileExists(t, names[1])
+	assert.FileExists(t, names[2])
+	assert.FileExists(t, tmp)
+	assert.FileExists(t, sibling)
+}
+
+func TestCompressFile(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		path = filepath.Join(dir, "alerts-20230102T030405.000.jsonl")
+	)
+	os.WriteFile(path, []byte("{}\n"), 0644)
+
+	assert.NoError(t, compressFile(path))
+	assert.NoFileExists(t, path)
+	assert.NoFileExists(t, path+compressSuffix+tmpSuffix)
+	assert.FileExists(t, path+compressSuffix)
+
+	// The partial output is removed and the original is kept if it can't be
+	// compressed, eg if it can't be read.
+	path = filepath.Join(dir, "alerts-20230102T030406.000.jsonl")
+	os.Mkdir(path, 0755)
+
+	assert.Error(t, compressFile(path))
+	assert.DirExists(t, path)
+	assert.NoFileExists(t, path+compressSuffix)
+	assert.NoFileExists(t, path+compressSuffix+tmpSuffix)
+}
+
+func readLines(t *testing.T, path string) []Line {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var out []Line
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var l Line
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, l)
+	}
+	return out
+}
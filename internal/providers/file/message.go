@@ -0,0 +1,48 @@
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+)
+
+// Line represents a line written to the file.
+type Line struct {
+	Time        time.Time           `json:"time"`
+	Room        string              `json:"room"`
+	Status      string              `json:"status"`
+	Fingerprint string              `json:"fingerprint"`
+	Message     string              `json:"message"`
+	Alert       *alertmgrtmpl.Alert `json:"alert,omitempty"`
+}
+
+// prepareLine renders the template and returns the JSON line for the alert.
+func (m *FileManager) prepareLine(alert alertmgrtmpl.Alert, ts time.Time) ([]byte, error) {
+	var to bytes.Buffer
+
+	// Render the template with alert data.
+	if err := m.msgTmpl.Execute(&to, alert); err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return nil, err
+	}
+
+	l := Line{
+		Time:        ts,
+		Room:        m.room,
+		Status:      alert.Status,
+		Fingerprint: alert.Fingerprint,
+		Message:     to.String(),
+	}
+	if m.includeRaw {
+		l.Alert = &alert
+	}
+
+	out, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, '\n'), nil
+}
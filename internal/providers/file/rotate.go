@@ -0,0 +1,311 @@
+package file
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// backupTimeFormat is the timestamp added to the name of rotated files.
+	backupTimeFormat = "20060102T150405.000"
+	compressSuffix   = ".gz"
+	// tmpSuffix is added to a file while it's being compressed.
+	tmpSuffix = ".tmp"
+)
+
+// rotatingFile is an io.Writer which appends to a file and rotates it once
+// it exceeds a size or age. Rotated files are renamed with a timestamp
+// (eg `alerts-20230102T030405.000.jsonl`) and optionally gzipped in the background.
+type rotatingFile struct {
+	sync.Mutex
+
+	lo         *logrus.Logger
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	compress   bool
+
+	f        *os.File
+	size     int64
+	openedAt time.Time
+
+	// cleanup orders compressing and removing the backups, which run in the
+	// background, and wg tracks them so Close can wait for them.
+	cleanup sync.Mutex
+	wg      sync.WaitGroup
+}
+
+func newRotatingFile(lo *logrus.Logger, path string, maxSize int64, interval time.Duration, maxBackups int, compress bool) (*rotatingFile, error) {
+	r := &rotatingFile{
+		lo:         lo,
+		path:       path,
+		maxSize:    maxSize,
+		interval:   interval,
+		maxBackups: maxBackups,
+		compress:   compress,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Write appends `p` to the file, rotating it first if it's due. A line is never
+// split across files. If the file can't be rotated, `p` is still appended to the
+// current file, so it's only dropped if the file can't be opened at all.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.due(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the file and waits for the rotated files to be compressed.
+func (r *rotatingFile) Close() error {
+	r.Lock()
+	err := r.f.Close()
+	r.Unlock()
+
+	r.wg.Wait()
+	return err
+}
+
+// due returns true if the file has to be rotated before writing `n` bytes.
+// Empty files are never rotated.
+func (r *rotatingFile) due(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.maxSize > 0 && r.size+n > r.maxSize {
+		return true
+	}
+	if r.interval > 0 && time.Since(r.openedAt) >= r.interval {
+		return true
+	}
+	return false
+}
+
+// open opens the file for appending.
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f = f
+	r.size = info.Size()
+	r.openedAt = time.Now()
+
+	return nil
+}
+
+// rotate renames the current file, opens a new one and cleans up the backups.
+// It only returns an error if there's no open file to write to afterwards. The
+// backups are compressed and cleaned up in the background, so writes aren't held
+// up, and the errors are logged since they don't affect writes.
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		r.lo.WithError(err).WithField("path", r.path).Error("error closing file before rotating")
+	}
+
+	backup := r.backupName(time.Now())
+	if err := os.Rename(r.path, backup); err != nil {
+		// Keep appending to the current file.
+		r.lo.WithError(err).WithField("path", r.path).Error("error rotating file")
+		return r.open()
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		r.cleanup.Lock()
+		defer r.cleanup.Unlock()
+
+		if r.compress {
+			if err := compressFile(backup); err != nil {
+				r.lo.WithError(err).WithField("path", backup).Error("error compressing rotated file")
+			}
+		}
+		if err := r.removeOldBackups(); err != nil {
+			r.lo.WithError(err).WithField("path", r.path).Error("error removing old rotated files")
+		}
+	}()
+
+	return nil
+}
+
+// backupName returns the name of the rotated file. If a file was already rotated
+// in the same millisecond, a sequence number is added (eg `alerts-20230102T030405.000-1.jsonl`).
+func (r *rotatingFile) backupName(t time.Time) string {
+	var (
+		ext  = filepath.Ext(r.path)
+		base = strings.TrimSuffix(r.path, ext)
+		ts   = t.UTC().Format(backupTimeFormat)
+	)
+	for seq := 0; ; seq++ {
+		name := fmt.Sprintf("%s-%s%s", base, ts, ext)
+		if seq > 0 {
+			name = fmt.Sprintf("%s-%s-%d%s", base, ts, seq, ext)
+		}
+		if !exists(name) && !exists(name+compressSuffix) {
+			return name
+		}
+	}
+}
+
+// backup is a rotated file.
+type backup struct {
+	path string
+	ts   string
+	seq  int
+}
+
+// backups returns the files rotated from the file, oldest first. Only the names
+// generated by backupName are matched, so other files in the directory which
+// share the prefix (eg `alerts-critical.jsonl`) and the files being compressed
+// are left alone.
+func (r *rotatingFile) backups() ([]backup, error) {
+	var (
+		dir  = filepath.Dir(r.path)
+		ext  = filepath.Ext(r.path)
+		base = strings.TrimSuffix(filepath.Base(r.path), ext)
+		re   = regexp.MustCompile(`^` + regexp.QuoteMeta(base) + `-(\d{8}T\d{6}\.\d{3})(?:-(\d+))?` +
+			regexp.QuoteMeta(ext) + `(?:` + regexp.QuoteMeta(compressSuffix) + `)?$`)
+	)
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []backup
+	for _, f := range files {
+		m := re.FindStringSubmatch(f.Name())
+		if f.IsDir() || m == nil {
+			continue
+		}
+		b := backup{path: filepath.Join(dir, f.Name()), ts: m[1]}
+		if m[2] != "" {
+			b.seq, _ = strconv.Atoi(m[2])
+		}
+		out = append(out, b)
+	}
+
+	// The timestamps sort lexically and the files rotated in the same
+	// millisecond are ordered by their sequence.
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ts != out[j].ts {
+			return out[i].ts < out[j].ts
+		}
+		return out[i].seq < out[j].seq
+	})
+
+	return out, nil
+}
+
+// removeOldBackups deletes the oldest rotated files over `maxBackups`.
+func (r *rotatingFile) removeOldBackups() error {
+	if r.maxBackups <= 0 {
+		return nil
+	}
+
+	files, err := r.backups()
+	if err != nil {
+		return err
+	}
+	if len(files) <= r.maxBackups {
+		return nil
+	}
+
+	for _, f := range files[:len(files)-r.maxBackups] {
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// compressFile gzips a file and removes the original. The file is compressed to
+// a temporary name which is renamed once it's complete, so a partial file is
+// never left behind as a backup.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + compressSuffix + tmpSuffix
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+compressSuffix); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Remove(path)
+}
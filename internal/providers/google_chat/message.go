@@ -2,12 +2,12 @@ package google_chat
 
 import (
 	"bytes"
-	"errors"
 	"net/http"
 	"net/url"
 	"strings"
 
 	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
 )
 
 const (
@@ -21,7 +21,6 @@ func (m *GoogleChatManager) prepareMessage(alert alertmgrtmpl.Alert) ([]ChatMess
 	var (
 		str strings.Builder
 		to  bytes.Buffer
-		msg BasicChatMessage
 	)
 
 	messages := make([]ChatMessage, 0)
@@ -35,18 +34,15 @@ func (m *GoogleChatManager) prepareMessage(alert alertmgrtmpl.Alert) ([]ChatMess
 
 	// Split the message if it exceeds the limit.
 	if (len(str.String()) + len(to.String())) >= maxMsgSize {
-		msg.Text = str.String()
-		messages = append(messages, msg)
+		messages = append(messages, &BasicChatMessage{Text: str.String()})
 		str.Reset()
 	}
 
 	// Convert the template bytes to string.
 	str.WriteString(to.String())
 	str.WriteString("\n")
-	msg.Text = str.String()
-
 	// Add the message to batch.
-	messages = append(messages, msg)
+	messages = append(messages, &BasicChatMessage{Text: str.String()})
 
 	return messages, nil
 }
@@ -86,7 +82,7 @@ func (m *GoogleChatManager) sendMessage(msg ChatMessage, threadKey string) error
 	// If response is non 200, log and throw the error.
 	if resp.StatusCode != http.StatusOK {
 		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from Google Chat Webhook endpoint")
-		return errors.New("non ok response from gchat")
+		return providers.NewStatusError(m.ID(), resp)
 	}
 
 	return nil
@@ -3,11 +3,11 @@ package google_chat
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"net/url"
 
 	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
 )
 
 // prepareMessage prepares a v2 message to be sent to google chat
@@ -83,7 +83,7 @@ func (m *GoogleChatManager) sendMessageV2(msg ChatMessage) error {
 	// If response is non 200, log and throw the error.
 	if resp.StatusCode != http.StatusOK {
 		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from Google Chat Webhook endpoint")
-		return errors.New("non ok response from gchat")
+		return providers.NewStatusError(m.ID(), resp)
 	}
 
 	return nil
@@ -0,0 +1,156 @@
+package gotify
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/providers/push"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPriority = 5
+)
+
+// defaultPriorities maps the `severity` label to Gotify priorities (0-10).
+// Android clients show priorities above 7 as high importance notifications.
+var defaultPriorities = map[string]int{
+	"critical": 10,
+	"high":     8,
+	"warning":  6,
+	"low":      3,
+	"info":     2,
+}
+
+type GotifyManager struct {
+	lo         *logrus.Logger
+	metrics    *metrics.Manager
+	endpoint   string
+	token      string
+	markdown   bool
+	name       string
+	room       string
+	client     *http.Client
+	retry      *providers.Retrier
+	tmpls      push.Templates
+	priorities map[string]int
+	dryRun     bool
+}
+
+type GotifyOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	// Server is the base URL of the Gotify server.
+	Server string
+	// Token is the application token.
+	Token    string
+	Markdown bool
+	// Name is the unique name of the provider in the config.
+	Name string
+	Room string
+	// Title and ClickURL are template strings. Template is the path of the message template.
+	Title      string
+	Template   string
+	ClickURL   string
+	Priorities map[string]int
+}
+
+// NewGotify initializes a Gotify provider object.
+func NewGotify(opts GotifyOpts) (*GotifyManager, error) {
+	if opts.Server == "" || opts.Token == "" {
+		return nil, fmt.Errorf("server and token are required")
+	}
+
+	priorities, err := push.Priorities(defaultPriorities, opts.Priorities, 0, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialise a generic HTTP Client for communicating with the Gotify server.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the templates.
+	tmpls, err := push.NewTemplates(opts.Title, opts.Template, opts.ClickURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GotifyManager{
+		lo:         opts.Log,
+		metrics:    opts.Metrics,
+		retry:      providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "gotify", opts.Name, opts.Room),
+		client:     client,
+		endpoint:   strings.TrimSuffix(opts.Server, "/") + "/message",
+		token:      opts.Token,
+		markdown:   opts.Markdown,
+		name:       opts.Name,
+		room:       opts.Room,
+		tmpls:      tmpls,
+		priorities: priorities,
+		dryRun:     opts.DryRun,
+	}, nil
+}
+
+// Push accepts the list of alerts and sends a message for each of them.
+func (m *GotifyManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to gotify")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		msg, err := m.prepareMessage(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Send message to API.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			if err := m.retry.Do(func() error { return m.sendMessage(msg) }); err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				perr.Add(a, msg, err)
+				continue
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *GotifyManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *GotifyManager) ID() string {
+	return "gotify"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *GotifyManager) Name() string {
+	return m.name
+}
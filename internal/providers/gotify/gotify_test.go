@@ -0,0 +1,67 @@
+package gotify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGotifyPush(t *testing.T) {
+	var received []map[string]interface{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/gotify/message", r.URL.Path)
+		assert.Equal(t, "app-token", r.Header.Get("X-Gotify-Key"))
+
+		var msg map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, msg)
+	}))
+	defer srv.Close()
+
+	g, err := NewGotify(GotifyOpts{
+		Log:      logrus.New(),
+		Metrics:  metrics.New("calert"),
+		Server:   srv.URL + "/gotify/",
+		Token:    "app-token",
+		Markdown: true,
+		Room:     "qa",
+		Template: "../../../static/message.tmpl",
+		ClickURL: "https://grafana.example.com/d/{{ .Labels.dashboard }}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "critical", "alertname": "TestAlert", "dashboard": "node",
+		}),
+		Annotations: alertmgrtmpl.KV{},
+		Fingerprint: "1a956348d0570965",
+	}
+
+	if err := g.Push([]alertmgrtmpl.Alert{alert}); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, received, 1) {
+		assert.Equal(t, "[FIRING] TestAlert", received[0]["title"])
+		assert.EqualValues(t, 10, received[0]["priority"])
+		assert.Equal(t, map[string]interface{}{
+			"client::display": map[string]interface{}{"contentType": "text/markdown"},
+			"client::notification": map[string]interface{}{
+				"click": map[string]interface{}{"url": "https://grafana.example.com/d/node"},
+			},
+		}, received[0]["extras"])
+	}
+}
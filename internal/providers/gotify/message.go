@@ -0,0 +1,81 @@
+package gotify
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/providers/push"
+)
+
+// Message represents the payload for creating a message.
+// https://gotify.net/api-docs#/message/createMessage
+type Message struct {
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message"`
+	Priority int                    `json:"priority"`
+	Extras   map[string]interface{} `json:"extras,omitempty"`
+}
+
+// prepareMessage renders the templates and picks the priority for the alert.
+// The click URL and content type are set using message extras.
+// https://gotify.net/docs/msgextras
+func (m *GotifyManager) prepareMessage(alert alertmgrtmpl.Alert) (Message, error) {
+	n, err := m.tmpls.Render(alert)
+	if err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return Message{}, err
+	}
+
+	msg := Message{
+		Title:    n.Title,
+		Message:  n.Message,
+		Priority: push.Priority(alert, m.priorities, defaultPriority),
+		Extras:   make(map[string]interface{}),
+	}
+
+	if m.markdown {
+		msg.Extras["client::display"] = map[string]string{"contentType": "text/markdown"}
+	}
+	if n.ClickURL != "" {
+		msg.Extras["client::notification"] = map[string]interface{}{
+			"click": map[string]string{"url": n.ClickURL},
+		}
+	}
+
+	return msg, nil
+}
+
+// sendMessage sends the message to the Gotify server.
+func (m *GotifyManager) sendMessage(msg Message) error {
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	// Prepare the request.
+	req, err := http.NewRequest("POST", m.endpoint, bytes.NewBuffer(out))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", m.token)
+
+	// Send the request.
+	m.lo.WithField("msg", msg).Debug("sending alert")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// If response is non 200, log and throw the error.
+	if resp.StatusCode != http.StatusOK {
+		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from Gotify server")
+		return providers.NewStatusError(m.ID(), resp)
+	}
+
+	return nil
+}
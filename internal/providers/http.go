@@ -0,0 +1,61 @@
+package providers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// maxErrBodySize is the number of bytes read from an upstream
+	// error response to include in the error message.
+	maxErrBodySize = 512
+)
+
+// NewHTTPClient initializes a generic HTTP Client for communicating with
+// upstream provider APIs. If `proxyURL` is non empty, all the requests are routed via the proxy.
+func NewHTTPClient(timeout time.Duration, maxIdleConn int, proxyURL string) (*http.Client, error) {
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: maxIdleConn,
+	}
+
+	// Add a proxy to make upstream requests if specified in config.
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing proxy URL: %s", err)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}, nil
+}
+
+// StatusError is returned when an upstream provider responds with an unexpected HTTP status.
+type StatusError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+	// RetryAfter is the wait asked for by the `Retry-After` header, if any.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("non ok response from %s: %d %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// NewStatusError reads a part of the response body and wraps it in a StatusError.
+func NewStatusError(provider string, resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrBodySize))
+	return &StatusError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Body:       string(b),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
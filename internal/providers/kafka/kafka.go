@@ -0,0 +1,305 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/providers/pubsub"
+	"github.com/sirupsen/logrus"
+)
+
+// SASL mechanisms for authenticating with the brokers.
+const (
+	SASLPlain       = "plain"
+	SASLScramSHA256 = "scram-sha-256"
+	SASLScramSHA512 = "scram-sha-512"
+)
+
+const (
+	defaultBatchTimeout = 100 * time.Millisecond
+)
+
+// acks maps the config values to the acknowledgements required from the brokers.
+var acks = map[string]kafkago.RequiredAcks{
+	"none": kafkago.RequireNone,
+	"one":  kafkago.RequireOne,
+	"all":  kafkago.RequireAll,
+}
+
+// compressions maps the config values to the compression codecs.
+var compressions = map[string]kafkago.Compression{
+	"gzip":   kafkago.Gzip,
+	"snappy": kafkago.Snappy,
+	"lz4":    kafkago.Lz4,
+	"zstd":   kafkago.Zstd,
+}
+
+// Producer writes messages to Kafka. It's satisfied by kafka.Writer and
+// can be replaced with a fake in tests.
+type Producer interface {
+	WriteMessages(ctx context.Context, msgs ...kafkago.Message) error
+	Close() error
+}
+
+type KafkaManager struct {
+	lo        *logrus.Logger
+	metrics   *metrics.Manager
+	producer  Producer
+	timeout   time.Duration
+	name      string
+	room      string
+	topicTmpl *template.Template
+	msgTmpl   *template.Template
+	dryRun    bool
+}
+
+type KafkaOpts struct {
+	Log     *logrus.Logger
+	Metrics *metrics.Manager
+	DryRun  bool
+	// Timeout is the time to wait for the messages of a Push to be written.
+	Timeout time.Duration
+	Brokers []string
+	// Topic is a template string which is rendered for each alert.
+	Topic string
+	// Acks is one of `none`, `one` or `all`. Defaults to `all`.
+	Acks string
+	// Compression is one of `gzip`, `snappy`, `lz4` or `zstd`. Empty disables it.
+	Compression  string
+	BatchSize    int
+	BatchBytes   int64
+	BatchTimeout time.Duration
+	// SASLMechanism is one of `plain`, `scram-sha-256` or `scram-sha-512`. Empty disables SASL.
+	SASLMechanism      string
+	Username           string
+	Password           string
+	TLS                bool
+	CAFile             string
+	InsecureSkipVerify bool
+	// Name is the unique name of the provider in the config.
+	Name string
+	Room string
+	// Template (optional) renders the `message` field of the payload.
+	Template string
+	// Producer overrides the writer created from the options, eg in tests.
+	Producer Producer
+}
+
+// NewKafka initializes a Kafka provider object.
+func NewKafka(opts KafkaOpts) (*KafkaManager, error) {
+	if opts.Topic == "" {
+		return nil, fmt.Errorf("topic is required")
+	}
+
+	// Load the templates.
+	topicTmpl, err := pubsub.NewTopicTemplate(opts.Topic)
+	if err != nil {
+		return nil, err
+	}
+	var msgTmpl *template.Template
+	if opts.Template != "" {
+		if msgTmpl, err = providers.LoadTemplate(opts.Template, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	producer := opts.Producer
+	if producer == nil {
+		if producer, err = newWriter(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return &KafkaManager{
+		lo:        opts.Log,
+		metrics:   opts.Metrics,
+		producer:  producer,
+		timeout:   opts.Timeout,
+		name:      opts.Name,
+		room:      opts.Room,
+		topicTmpl: topicTmpl,
+		msgTmpl:   msgTmpl,
+		dryRun:    opts.DryRun,
+	}, nil
+}
+
+// newWriter initializes a kafka.Writer from the options. Messages are assigned to
+// partitions by hashing the key with murmur2, like the Java client, so all the
+// messages for an alert land in the same partition in order and consumers which
+// partition by the key themselves agree with it.
+func newWriter(opts KafkaOpts) (*kafkago.Writer, error) {
+	if len(opts.Brokers) == 0 {
+		return nil, fmt.Errorf("brokers are required")
+	}
+	if opts.Acks == "" {
+		opts.Acks = "all"
+	}
+	ack, ok := acks[opts.Acks]
+	if !ok {
+		return nil, fmt.Errorf("unknown acks: %s", opts.Acks)
+	}
+	if opts.BatchTimeout == 0 {
+		opts.BatchTimeout = defaultBatchTimeout
+	}
+
+	w := &kafkago.Writer{
+		Addr:         kafkago.TCP(opts.Brokers...),
+		Balancer:     &kafkago.Murmur2Balancer{},
+		RequiredAcks: ack,
+		BatchSize:    opts.BatchSize,
+		BatchBytes:   opts.BatchBytes,
+		BatchTimeout: opts.BatchTimeout,
+		WriteTimeout: opts.Timeout,
+	}
+	if opts.Compression != "" {
+		c, ok := compressions[opts.Compression]
+		if !ok {
+			return nil, fmt.Errorf("unknown compression: %s", opts.Compression)
+		}
+		w.Compression = c
+	}
+
+	transport := &kafkago.Transport{
+		DialTimeout: opts.Timeout,
+		ClientID:    "calert",
+	}
+	if opts.SASLMechanism != "" {
+		m, err := saslMechanism(opts.SASLMechanism, opts.Username, opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		transport.SASL = m
+	}
+	if opts.TLS {
+		transport.TLS = &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+
+		if opts.CAFile != "" {
+			ca, err := os.ReadFile(opts.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("error reading ca file: %v", err)
+			}
+			transport.TLS.RootCAs = x509.NewCertPool()
+			if !transport.TLS.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("no certificates found in ca file %s", opts.CAFile)
+			}
+		}
+	}
+	w.Transport = transport
+
+	return w, nil
+}
+
+// saslMechanism returns the SASL mechanism for the config value.
+func saslMechanism(name, username, password string) (sasl.Mechanism, error) {
+	switch strings.ToLower(name) {
+	case SASLPlain:
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, username, password)
+	case SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, username, password)
+	}
+
+	return nil, fmt.Errorf("unknown sasl mechanism: %s", name)
+}
+
+// Push accepts the list of alerts and publishes them as a single batch.
+func (m *KafkaManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to kafka")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	var (
+		msgs = make([]kafkago.Message, 0, len(alerts))
+		// batch holds the alert for each message.
+		batch = make([]alertmgrtmpl.Alert, 0, len(alerts))
+	)
+	for _, a := range alerts {
+		msg, err := m.prepareMessage(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+		msgs = append(msgs, msg)
+		batch = append(batch, a)
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+	}
+	if len(msgs) == 0 {
+		return perr.OrNil()
+	}
+
+	now := time.Now()
+
+	// Send messages to the brokers.
+	if m.dryRun {
+		m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+	} else {
+		ctx := context.Background()
+		if m.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, m.timeout)
+			defer cancel()
+		}
+
+		if err := m.producer.WriteMessages(ctx, msgs...); err != nil {
+			// WriteErrors holds the error for each message. Other errors apply to all of them.
+			var werrs kafkago.WriteErrors
+			if !errors.As(err, &werrs) {
+				werrs = make(kafkago.WriteErrors, len(msgs))
+				for i := range werrs {
+					werrs[i] = err
+				}
+			}
+			failed := werrs.Count()
+			for i, werr := range werrs {
+				if werr == nil {
+					continue
+				}
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				perr.Add(batch[i], string(msgs[i].Value), werr)
+			}
+			m.lo.WithError(err).WithField("failed", failed).Error("error sending messages")
+			return perr.OrNil()
+		}
+	}
+
+	m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *KafkaManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *KafkaManager) ID() string {
+	return "kafka"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *KafkaManager) Name() string {
+	return m.name
+}
+
+// Close writes the pending messages and closes the connections to the brokers.
+func (m *KafkaManager) Close() error {
+	return m.producer.Close()
+}
@@ -0,0 +1,113 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers/pubsub"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProducer records the messages written to it.
+type fakeProducer struct {
+	msgs   []kafkago.Message
+	err    error
+	closed bool
+}
+
+func (f *fakeProducer) WriteMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.msgs = append(f.msgs, msgs...)
+	return nil
+}
+
+func (f *fakeProducer) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestKafkaPush(t *testing.T) {
+	fp := &fakeProducer{}
+
+	k, err := NewKafka(KafkaOpts{
+		Log:      logrus.New(),
+		Metrics:  metrics.New("calert"),
+		Topic:    "alerts.{{ .Labels.team }}",
+		Room:     "qa",
+		Template: "../../../static/message.tmpl",
+		Producer: fp,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "high", "alertname": "TestAlert", "team": "infra",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"summary": "disk is full",
+		}),
+		Fingerprint: "1a956348d0570965",
+	}
+	other := alert
+	other.Labels = alertmgrtmpl.KV(map[string]string{
+		"severity": "high", "alertname": "OtherAlert", "team": "db",
+	})
+	other.Fingerprint = "c0ffee"
+
+	if err := k.Push([]alertmgrtmpl.Alert{alert, other}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both alerts are written as a single batch.
+	if assert.Len(t, fp.msgs, 2) {
+		assert.Equal(t, "alerts.infra", fp.msgs[0].Topic)
+		assert.Equal(t, []byte("1a956348d0570965"), fp.msgs[0].Key)
+		assert.Equal(t, "alerts.db", fp.msgs[1].Topic)
+		assert.Equal(t, []byte("c0ffee"), fp.msgs[1].Key)
+		assert.Contains(t, fp.msgs[0].Headers, kafkago.Header{Key: "status", Value: []byte("firing")})
+
+		var p pubsub.Payload
+		if err := json.Unmarshal(fp.msgs[0].Value, &p); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "qa", p.Room)
+		assert.Equal(t, "TestAlert", p.Labels["alertname"])
+		assert.Contains(t, p.Message, "Summary: disk is full")
+	}
+
+	assert.NoError(t, k.Close())
+	assert.True(t, fp.closed)
+}
+
+func TestKafkaWriterOpts(t *testing.T) {
+	w, err := newWriter(KafkaOpts{
+		Brokers:       []string{"localhost:9092"},
+		Acks:          "one",
+		Compression:   "zstd",
+		SASLMechanism: SASLScramSHA512,
+		Username:      "calert",
+		Password:      "secret",
+		TLS:           true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, kafkago.RequireOne, w.RequiredAcks)
+	assert.Equal(t, defaultBatchTimeout, w.BatchTimeout)
+	assert.IsType(t, &kafkago.Murmur2Balancer{}, w.Balancer)
+
+	_, err = newWriter(KafkaOpts{Brokers: []string{"localhost:9092"}, Acks: "two"})
+	assert.Error(t, err)
+	_, err = newWriter(KafkaOpts{Brokers: []string{"localhost:9092"}, SASLMechanism: "gssapi"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,33 @@
+package kafka
+
+import (
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/shpeliving/calert/internal/providers/pubsub"
+)
+
+// prepareMessage renders the topic and payload for the alert. The message is
+// keyed by the fingerprint.
+func (m *KafkaManager) prepareMessage(alert alertmgrtmpl.Alert) (kafkago.Message, error) {
+	topic, err := pubsub.RenderTopic(m.topicTmpl, alert)
+	if err != nil {
+		m.lo.WithError(err).Error("Error parsing values in topic template")
+		return kafkago.Message{}, err
+	}
+
+	val, err := pubsub.NewPayload(m.room, alert, m.msgTmpl)
+	if err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return kafkago.Message{}, err
+	}
+
+	return kafkago.Message{
+		Topic: topic,
+		Key:   []byte(alert.Fingerprint),
+		Value: val,
+		Headers: []kafkago.Header{
+			{Key: "room", Value: []byte(m.room)},
+			{Key: "status", Value: []byte(alert.Status)},
+		},
+	}, nil
+}
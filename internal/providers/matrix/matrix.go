@@ -0,0 +1,183 @@
+package matrix
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMsgType = "m.notice"
+)
+
+type MatrixManager struct {
+	lo           *logrus.Logger
+	metrics      *metrics.Manager
+	activeAlerts *providers.ActiveAlerts
+	endpoint     string
+	accessToken  string
+	msgType      string
+	name         string
+	room         string
+	client       *http.Client
+	retry        *providers.Retrier
+	msgTmpl      *template.Template
+	htmlTmpl     *htmltemplate.Template
+	dryRun       bool
+}
+
+type MatrixOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	// Homeserver is the base URL of the homeserver, eg https://matrix.example.com.
+	Homeserver  string
+	AccessToken string
+	// RoomID is the ID of the room to post to, eg `!abc:example.com`.
+	RoomID string
+	// MsgType is `m.notice` (default) or `m.text`.
+	MsgType string
+	// Name is the unique name of the provider in the config.
+	Name string
+	Room string
+	// Template renders the plain text `body` and HTMLTemplate (optional)
+	// renders the `formatted_body`.
+	Template     string
+	HTMLTemplate string
+	ThreadTTL    time.Duration
+}
+
+// NewMatrix initializes a Matrix provider object.
+func NewMatrix(opts MatrixOpts) (*MatrixManager, error) {
+	if opts.Homeserver == "" || opts.AccessToken == "" || opts.RoomID == "" {
+		return nil, fmt.Errorf("homeserver, access_token and room_id are required")
+	}
+	if opts.MsgType == "" {
+		opts.MsgType = defaultMsgType
+	}
+
+	// Initialise a generic HTTP Client for communicating with the homeserver.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the templates.
+	tmpl, err := providers.LoadTemplate(opts.Template, nil)
+	if err != nil {
+		return nil, err
+	}
+	var htmlTmpl *htmltemplate.Template
+	if opts.HTMLTemplate != "" {
+		if htmlTmpl, err = providers.LoadHTMLTemplate(opts.HTMLTemplate, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	mgr := &MatrixManager{
+		lo:      opts.Log,
+		metrics: opts.Metrics,
+		retry:   providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "matrix", opts.Name, opts.Room),
+		client:  client,
+		endpoint: fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message",
+			strings.TrimSuffix(opts.Homeserver, "/"), url.PathEscape(opts.RoomID)),
+		accessToken:  opts.AccessToken,
+		msgType:      opts.MsgType,
+		name:         opts.Name,
+		room:         opts.Room,
+		activeAlerts: providers.NewActiveAlerts(opts.Log, opts.Metrics),
+		msgTmpl:      tmpl,
+		htmlTmpl:     htmlTmpl,
+		dryRun:       opts.DryRun,
+	}
+	// Start a background worker to cleanup alerts based on TTL mechanism.
+	go mgr.activeAlerts.StartPruneWorker(1*time.Hour, opts.ThreadTTL)
+
+	return mgr, nil
+}
+
+// Push accepts the list of alerts and sends them to the room. Updates for an alert
+// are posted in a thread under the first event sent for its fingerprint.
+func (m *MatrixManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to matrix")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		// If it's a new alert whose fingerprint isn't in the active alerts map, add it first.
+		details, err := m.activeAlerts.GetOrAdd(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error adding active alert")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		msg, err := m.prepareMessage(a, details.MessageID)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Send message to API.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			// The transaction ID is derived from the thread UUID so that retries are idempotent.
+			txnID := fmt.Sprintf("%s-%d", details.UUID, now.UnixNano())
+
+			var eventID string
+			err := m.retry.Do(func() (err error) {
+				eventID, err = m.sendMessage(msg, txnID)
+				return err
+			})
+			if err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				perr.Add(a, msg, err)
+				continue
+			}
+
+			// Store the ID of the first event as the thread root.
+			if details.MessageID == "" {
+				m.activeAlerts.SetMessageID(a.Fingerprint, eventID)
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *MatrixManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *MatrixManager) ID() string {
+	return "matrix"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *MatrixManager) Name() string {
+	return m.name
+}
@@ -0,0 +1,95 @@
+package matrix
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatrixThreading(t *testing.T) {
+	var (
+		received []Message
+		paths    []string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, msg)
+		paths = append(paths, r.URL.EscapedPath())
+
+		w.Write([]byte(`{"event_id":"$root"}`))
+	}))
+	defer srv.Close()
+
+	mx, err := NewMatrix(MatrixOpts{
+		Log:          logrus.New(),
+		Metrics:      metrics.New("calert"),
+		Homeserver:   srv.URL,
+		AccessToken:  "test-token",
+		RoomID:       "!room:example.com",
+		Room:         "qa",
+		Template:     "../../../static/message.tmpl",
+		HTMLTemplate: "../../../static/email.html.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "high", "alertname": "TestAlert",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"team": "qa",
+		}),
+		Fingerprint: "1a956348d0570965",
+	}
+	resolved := alert
+	resolved.Status = "resolved"
+
+	if err := mx.Push([]alertmgrtmpl.Alert{alert, resolved}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, received, 2)
+
+	uuid := mx.activeAlerts.Lookup(alert.Fingerprint)
+	assert.True(t, strings.HasPrefix(paths[0], "/_matrix/client/v3/rooms/%21room:example.com/send/m.room.message/"+uuid+"-"))
+	assert.NotEqual(t, paths[0], paths[1])
+
+	assert.Equal(t, "m.notice", received[0].MsgType)
+	assert.Equal(t, "*(HIGH) TestAlert - Firing*\nTeam: qa\n", received[0].Body)
+	assert.Equal(t, formatHTML, received[0].Format)
+	assert.Contains(t, received[0].FormattedBody, "<h3>(HIGH) TestAlert - Firing</h3>")
+	assert.Nil(t, received[0].RelatesTo)
+
+	assert.Equal(t, &RelatesTo{
+		RelType:       "m.thread",
+		EventID:       "$root",
+		IsFallingBack: true,
+		InReplyTo:     InReplyTo{EventID: "$root"},
+	}, received[1].RelatesTo)
+
+	// The alert data is escaped in the formatted body.
+	alert.Fingerprint = "2b956348d0570965"
+	alert.Labels["alertname"] = `<img src=x onerror="alert(1)">`
+	if err := mx.Push([]alertmgrtmpl.Alert{alert}); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, received[2].FormattedBody, "<Img")
+	assert.Contains(t, received[2].FormattedBody, "&lt;Img")
+}
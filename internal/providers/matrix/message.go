@@ -0,0 +1,125 @@
+package matrix
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+)
+
+const (
+	formatHTML  = "org.matrix.custom.html"
+	relThread   = "m.thread"
+	maxBodySize = 32 * 1024
+)
+
+type InReplyTo struct {
+	EventID string `json:"event_id"`
+}
+
+// RelatesTo represents a thread relation.
+// https://spec.matrix.org/v1.8/client-server-api/#threading
+type RelatesTo struct {
+	RelType       string    `json:"rel_type"`
+	EventID       string    `json:"event_id"`
+	IsFallingBack bool      `json:"is_falling_back"`
+	InReplyTo     InReplyTo `json:"m.in_reply_to"`
+}
+
+// Message represents the content of an `m.room.message` event.
+// https://spec.matrix.org/v1.8/client-server-api/#mroommessage
+type Message struct {
+	MsgType       string     `json:"msgtype"`
+	Body          string     `json:"body"`
+	Format        string     `json:"format,omitempty"`
+	FormattedBody string     `json:"formatted_body,omitempty"`
+	RelatesTo     *RelatesTo `json:"m.relates_to,omitempty"`
+}
+
+// prepareMessage renders the templates and adds a thread relation to `rootID` if it's non empty.
+func (m *MatrixManager) prepareMessage(alert alertmgrtmpl.Alert, rootID string) (Message, error) {
+	var (
+		body, html bytes.Buffer
+		msg        = Message{MsgType: m.msgType}
+	)
+
+	// Render the templates with alert data.
+	if err := m.msgTmpl.Execute(&body, alert); err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return msg, err
+	}
+	msg.Body = body.String()
+
+	if m.htmlTmpl != nil {
+		if err := m.htmlTmpl.Execute(&html, alert); err != nil {
+			m.lo.WithError(err).Error("Error parsing values in html template")
+			return msg, err
+		}
+		msg.Format = formatHTML
+		msg.FormattedBody = html.String()
+	}
+
+	// Homeservers reject events over 64 KB, so drop the formatted body for large alerts.
+	if len(msg.Body)+len(msg.FormattedBody) > maxBodySize {
+		msg.Format, msg.FormattedBody = "", ""
+		if len(msg.Body) > maxBodySize {
+			msg.Body = strings.ToValidUTF8(msg.Body[:maxBodySize], "")
+		}
+	}
+
+	if rootID != "" {
+		msg.RelatesTo = &RelatesTo{
+			RelType: relThread,
+			EventID: rootID,
+			// Clients without thread support show it as a reply to the root event.
+			IsFallingBack: true,
+			InReplyTo:     InReplyTo{EventID: rootID},
+		}
+	}
+
+	return msg, nil
+}
+
+// sendMessage sends the event to the room and returns its ID.
+func (m *MatrixManager) sendMessage(msg Message, txnID string) (string, error) {
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+
+	// Prepare the request.
+	endpoint := m.endpoint + "/" + url.PathEscape(txnID)
+	req, err := http.NewRequest("PUT", endpoint, bytes.NewBuffer(out))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.accessToken)
+
+	// Send the request.
+	m.lo.WithField("url", endpoint).WithField("msg", msg).Debug("sending alert")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// If response is non 200, log and throw the error.
+	if resp.StatusCode != http.StatusOK {
+		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from Matrix homeserver")
+		return "", providers.NewStatusError(m.ID(), resp)
+	}
+
+	var r struct {
+		EventID string `json:"event_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return "", err
+	}
+
+	return r.EventID, nil
+}
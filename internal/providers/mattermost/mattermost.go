@@ -0,0 +1,177 @@
+package mattermost
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/providers/slack_compat"
+	"github.com/sirupsen/logrus"
+)
+
+type MattermostManager struct {
+	lo           *logrus.Logger
+	metrics      *metrics.Manager
+	activeAlerts *providers.ActiveAlerts
+	token        string
+	channelID    string
+	username     string
+	iconURL      string
+	name         string
+	room         string
+	client       *slack_compat.Client
+	retry        *providers.Retrier
+	msgTmpl      *template.Template
+	dryRun       bool
+}
+
+type MattermostOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	// Endpoint is the incoming webhook URL. If Token is set, it's
+	// the base URL of the Mattermost server instead.
+	Endpoint string
+	// Token is a bot access token used to create posts via the REST API.
+	Token string
+	// ChannelID is the channel to post to. Required if Token is set.
+	ChannelID string
+	// Username and IconURL override the name and avatar of the webhook.
+	Username string
+	IconURL  string
+	// Name is the unique name of the provider in the config.
+	Name      string
+	Room      string
+	Template  string
+	ThreadTTL time.Duration
+}
+
+// NewMattermost initializes a Mattermost provider object.
+func NewMattermost(opts MattermostOpts) (*MattermostManager, error) {
+	if opts.Token != "" && opts.ChannelID == "" {
+		return nil, fmt.Errorf("channel_id is required when using a bot token")
+	}
+
+	// Initialise a generic HTTP Client for communicating with Mattermost.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the template.
+	tmpl, err := providers.LoadTemplate(opts.Template, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, header := opts.Endpoint, http.Header{}
+	if opts.Token != "" {
+		endpoint = strings.TrimSuffix(opts.Endpoint, "/") + "/api/v4/posts"
+		header.Set("Authorization", "Bearer "+opts.Token)
+	}
+
+	mgr := &MattermostManager{
+		lo:      opts.Log,
+		metrics: opts.Metrics,
+		retry:   providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "mattermost", opts.Name, opts.Room),
+		client: slack_compat.NewClient(slack_compat.ClientOpts{
+			Log:      opts.Log,
+			Client:   client,
+			Provider: "mattermost",
+			Endpoint: endpoint,
+			Header:   header,
+		}),
+		token:        opts.Token,
+		channelID:    opts.ChannelID,
+		username:     opts.Username,
+		iconURL:      opts.IconURL,
+		name:         opts.Name,
+		room:         opts.Room,
+		activeAlerts: providers.NewActiveAlerts(opts.Log, opts.Metrics),
+		msgTmpl:      tmpl,
+		dryRun:       opts.DryRun,
+	}
+	// Start a background worker to cleanup alerts based on TTL mechanism.
+	go mgr.activeAlerts.StartPruneWorker(1*time.Hour, opts.ThreadTTL)
+
+	return mgr, nil
+}
+
+// Push accepts the list of alerts and dispatches them to Mattermost.
+func (m *MattermostManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to mattermost")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		// If it's a new alert whose fingerprint isn't in the active alerts map, add it first.
+		details, err := m.activeAlerts.GetOrAdd(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error adding active alert")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		// The ID of the first post for this alert (if any) is used as the `root_id`.
+		msg, err := m.prepareMessage(a, details.MessageID)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Send message to API.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			var id string
+			err := m.retry.Do(func() (err error) {
+				id, err = m.sendMessage(msg)
+				return err
+			})
+			if err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				perr.Add(a, msg, err)
+				continue
+			}
+
+			// Store the ID of the first post so that all the future updates are threaded under it.
+			if details.MessageID == "" && id != "" {
+				m.activeAlerts.SetMessageID(a.Fingerprint, id)
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *MattermostManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *MattermostManager) ID() string {
+	return "mattermost"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *MattermostManager) Name() string {
+	return m.name
+}
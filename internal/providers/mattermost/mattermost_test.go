@@ -0,0 +1,75 @@
+package mattermost
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMattermostThreading(t *testing.T) {
+	var received []Post
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v4/posts", r.URL.Path)
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+
+		var post Post
+		if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, post)
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"post1"}`))
+	}))
+	defer srv.Close()
+
+	mm, err := NewMattermost(MattermostOpts{
+		Log:       logrus.New(),
+		Metrics:   metrics.New("calert"),
+		Endpoint:  srv.URL,
+		Token:     "test-token",
+		ChannelID: "chan1",
+		Room:      "qa",
+		Template:  "../../../static/message.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "warning", "alertname": "TestAlert",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"team": "qa",
+		}),
+		Fingerprint: "1a956348d0570965",
+	}
+	resolved := alert
+	resolved.Status = "resolved"
+
+	if err := mm.Push([]alertmgrtmpl.Alert{alert, resolved}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, received, 2)
+	assert.Equal(t, "chan1", received[0].ChannelID)
+	assert.Empty(t, received[0].RootID)
+
+	att := received[0].Props.Attachments[0]
+	assert.Equal(t, "TestAlert - Firing", att.Title)
+	assert.Equal(t, "#FFA500", att.Color)
+	assert.Equal(t, "*(WARNING) TestAlert - Firing*\nTeam: qa\n", att.Text)
+	assert.Equal(t, "severity", att.Fields[0].Title)
+
+	assert.Equal(t, "post1", received[1].RootID)
+	assert.Equal(t, "#2EB67D", received[1].Props.Attachments[0].Color)
+}
@@ -0,0 +1,59 @@
+package mattermost
+
+import (
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers/slack_compat"
+)
+
+// Post represents the payload for creating a post via the REST API. Unlike incoming
+// webhooks, it isn't Slack-compatible, so the attachments are put in its props.
+// https://api.mattermost.com/#tag/posts/operation/CreatePost
+type Post struct {
+	ChannelID string `json:"channel_id"`
+	RootID    string `json:"root_id,omitempty"`
+	Props     struct {
+		Attachments []slack_compat.Attachment `json:"attachments"`
+	} `json:"props"`
+}
+
+// prepareMessage renders the alert as an attachment. In bot token mode, it returns
+// a Post threaded under `rootID`, otherwise a Slack-compatible webhook message.
+// https://developers.mattermost.com/integrate/webhooks/incoming/
+func (m *MattermostManager) prepareMessage(alert alertmgrtmpl.Alert, rootID string) (interface{}, error) {
+	msg, err := slack_compat.Render(m.msgTmpl, alert, slack_compat.StyleAttachment)
+	if err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return nil, err
+	}
+
+	// Incoming webhooks don't return the ID of the post, so they can't be threaded.
+	if m.token == "" {
+		msg.Username = m.username
+		msg.IconURL = m.iconURL
+		return msg, nil
+	}
+
+	post := Post{
+		ChannelID: m.channelID,
+		RootID:    rootID,
+	}
+	post.Props.Attachments = msg.Attachments
+
+	return post, nil
+}
+
+// sendMessage sends the message to Mattermost. In bot token mode, it returns the ID of the post.
+func (m *MattermostManager) sendMessage(msg interface{}) (string, error) {
+	if m.token == "" {
+		return "", m.client.Post(msg, nil)
+	}
+
+	var r struct {
+		ID string `json:"id"`
+	}
+	if err := m.client.Post(msg, &r); err != nil {
+		return "", err
+	}
+
+	return r.ID, nil
+}
@@ -0,0 +1,43 @@
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers/pubsub"
+)
+
+// prepareMessage renders the topic and payload for the alert.
+func (m *MQTTManager) prepareMessage(alert alertmgrtmpl.Alert) (string, []byte, error) {
+	topic, err := pubsub.RenderTopic(m.topicTmpl, alert)
+	if err != nil {
+		m.lo.WithError(err).Error("Error parsing values in topic template")
+		return "", nil, err
+	}
+	if err := validateTopic(topic); err != nil {
+		return "", nil, err
+	}
+
+	payload, err := pubsub.NewPayload(m.room, alert, m.msgTmpl)
+	if err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return "", nil, err
+	}
+
+	return topic, payload, nil
+}
+
+// validateTopic checks that the topic has no wildcards, which aren't allowed
+// when publishing, or empty levels (eg if a label in the template is missing).
+func validateTopic(s string) error {
+	if strings.ContainsAny(s, "+#\x00") {
+		return fmt.Errorf("invalid topic: %q", s)
+	}
+	for _, l := range strings.Split(s, "/") {
+		if l == "" {
+			return fmt.Errorf("topic has empty levels: %q", s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package mqtt
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/providers/pubsub"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+)
+
+// Publisher publishes messages to the broker. It can be replaced with a fake in tests.
+type Publisher interface {
+	Publish(topic string, qos byte, retained bool, payload []byte) error
+	Close() error
+}
+
+// pahoPublisher publishes messages with a paho client and waits for them to be
+// sent (QoS 0) or acknowledged (QoS 1 and 2).
+type pahoPublisher struct {
+	client  paho.Client
+	timeout time.Duration
+}
+
+func (p *pahoPublisher) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	t := p.client.Publish(topic, qos, retained, payload)
+	if !t.WaitTimeout(p.timeout) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	return t.Error()
+}
+
+// Close waits up to the timeout for the messages in flight and disconnects.
+func (p *pahoPublisher) Close() error {
+	p.client.Disconnect(uint(p.timeout / time.Millisecond))
+	return nil
+}
+
+type MQTTManager struct {
+	lo        *logrus.Logger
+	metrics   *metrics.Manager
+	publisher Publisher
+	qos       byte
+	retain    bool
+	name      string
+	room      string
+	topicTmpl *template.Template
+	msgTmpl   *template.Template
+	dryRun    bool
+}
+
+type MQTTOpts struct {
+	Log     *logrus.Logger
+	Metrics *metrics.Manager
+	DryRun  bool
+	Timeout time.Duration
+	// Brokers is the list of broker URLs, eg `tcp://mqtt:1883` or `ssl://mqtt:8883`.
+	Brokers []string
+	// ClientID defaults to `calert-<name>-<random suffix>`, since brokers disconnect
+	// the existing client when another one connects with the same ID.
+	ClientID string
+	Username string
+	Password string
+	// CAFile and InsecureSkipVerify are used for `ssl://` brokers.
+	CAFile             string
+	InsecureSkipVerify bool
+	// Topic is a template string which is rendered for each alert.
+	Topic string
+	// QoS is the MQTT quality of service level (0, 1 or 2).
+	QoS int
+	// Retain asks the broker to keep the last message on each topic for new subscribers.
+	Retain bool
+	// Name is the unique name of the provider in the config.
+	Name string
+	Room string
+	// Template (optional) renders the `message` field of the payload.
+	Template string
+	// Publisher overrides the client created from the options, eg in tests.
+	Publisher Publisher
+}
+
+// NewMQTT initializes an MQTT provider object.
+func NewMQTT(opts MQTTOpts) (*MQTTManager, error) {
+	if opts.Topic == "" {
+		return nil, fmt.Errorf("topic is required")
+	}
+	if opts.QoS < 0 || opts.QoS > 2 {
+		return nil, fmt.Errorf("qos should be 0, 1 or 2")
+	}
+
+	// Load the templates.
+	topicTmpl, err := pubsub.NewTopicTemplate(opts.Topic)
+	if err != nil {
+		return nil, err
+	}
+	var msgTmpl *template.Template
+	if opts.Template != "" {
+		if msgTmpl, err = providers.LoadTemplate(opts.Template, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	pub := opts.Publisher
+	if pub == nil {
+		if pub, err = newPublisher(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return &MQTTManager{
+		lo:        opts.Log,
+		metrics:   opts.Metrics,
+		publisher: pub,
+		qos:       byte(opts.QoS),
+		retain:    opts.Retain,
+		name:      opts.Name,
+		room:      opts.Room,
+		topicTmpl: topicTmpl,
+		msgTmpl:   msgTmpl,
+		dryRun:    opts.DryRun,
+	}, nil
+}
+
+// newPublisher initializes a paho client. It connects in the background and keeps
+// retrying so that calert starts even if the broker is unavailable.
+func newPublisher(opts MQTTOpts) (Publisher, error) {
+	if len(opts.Brokers) == 0 {
+		return nil, fmt.Errorf("brokers are required")
+	}
+	if opts.ClientID == "" {
+		b := make([]byte, 4)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("error generating client id: %v", err)
+		}
+		opts.ClientID = fmt.Sprintf("calert-%s-%s", opts.Name, hex.EncodeToString(b))
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	o := paho.NewClientOptions().
+		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetConnectTimeout(opts.Timeout).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(paho.Client) {
+			opts.Log.WithField("room", opts.Room).Info("connected to mqtt broker")
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			opts.Log.WithError(err).WithField("room", opts.Room).Error("lost connection to mqtt broker")
+		})
+	for _, b := range opts.Brokers {
+		o.AddBroker(b)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+	if opts.CAFile != "" {
+		ca, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ca file: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in ca file %s", opts.CAFile)
+		}
+	}
+	o.SetTLSConfig(tlsConfig)
+
+	client := paho.NewClient(o)
+	client.Connect()
+
+	return &pahoPublisher{client: client, timeout: opts.Timeout}, nil
+}
+
+// Push accepts the list of alerts and publishes a message for each of them.
+func (m *MQTTManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to mqtt")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		topic, payload, err := m.prepareMessage(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Publish the message.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			m.lo.WithField("topic", topic).Debug("publishing alert")
+			if err := m.publisher.Publish(topic, m.qos, m.retain, payload); err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				perr.Add(a, string(payload), err)
+				continue
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *MQTTManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *MQTTManager) ID() string {
+	return "mqtt"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *MQTTManager) Name() string {
+	return m.name
+}
+
+// Close disconnects from the broker.
+func (m *MQTTManager) Close() error {
+	return m.publisher.Close()
+}
@@ -0,0 +1,86 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers/pubsub"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type published struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+}
+
+// fakePublisher records the messages published to it.
+type fakePublisher struct {
+	msgs   []published
+	closed bool
+}
+
+func (f *fakePublisher) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	f.msgs = append(f.msgs, published{topic, qos, retained, payload})
+	return nil
+}
+
+func (f *fakePublisher) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestMQTTPush(t *testing.T) {
+	fp := &fakePublisher{}
+
+	m, err := NewMQTT(MQTTOpts{
+		Log:       logrus.New(),
+		Metrics:   metrics.New("calert"),
+		Topic:     "factory/{{ .Labels.line }}/alerts/{{ .Labels.alertname }}",
+		QoS:       1,
+		Retain:    true,
+		Room:      "factory",
+		Template:  "../../../static/message.tmpl",
+		Publisher: fp,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "high", "alertname": "TestAlert", "line": "line1",
+		}),
+		Annotations: alertmgrtmpl.KV{},
+		Fingerprint: "1a956348d0570965",
+	}
+	// Wildcards in the topic aren't allowed, so it's skipped.
+	wildcard := alert
+	wildcard.Labels = alertmgrtmpl.KV(map[string]string{"severity": "high", "alertname": "TestAlert", "line": "#"})
+
+	assert.Error(t, m.Push([]alertmgrtmpl.Alert{alert, wildcard}))
+
+	if assert.Len(t, fp.msgs, 1) {
+		assert.Equal(t, "factory/line1/alerts/TestAlert", fp.msgs[0].topic)
+		assert.Equal(t, byte(1), fp.msgs[0].qos)
+		assert.True(t, fp.msgs[0].retained)
+
+		var p pubsub.Payload
+		if err := json.Unmarshal(fp.msgs[0].payload, &p); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "1a956348d0570965", p.Fingerprint)
+		assert.Contains(t, p.Message, "TestAlert")
+	}
+
+	assert.NoError(t, m.Close())
+	assert.True(t, fp.closed)
+
+	_, err = NewMQTT(MQTTOpts{Topic: "alerts", QoS: 3})
+	assert.Error(t, err)
+}
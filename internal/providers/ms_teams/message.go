@@ -0,0 +1,253 @@
+package ms_teams
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+)
+
+const (
+	// maxMsgSize is the maximum size of a message accepted by Teams (~28 KB)
+	// with some room left for the envelope.
+	maxMsgSize = 27 * 1024
+
+	adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+	truncatedSuffix         = "… (truncated)"
+	maxTruncateAttempts     = 10
+)
+
+// AdaptiveCard represents the top level fields of an Adaptive Card.
+// The elements are kept as raw JSON so that any element supported by
+// Teams can be used in the template.
+// https://adaptivecards.io/explorer/AdaptiveCard.html
+type AdaptiveCard struct {
+	Schema  string            `json:"$schema,omitempty"`
+	Type    string            `json:"type"`
+	Version string            `json:"version"`
+	Body    []json.RawMessage `json:"body"`
+	Actions []json.RawMessage `json:"actions,omitempty"`
+	MSTeams json.RawMessage   `json:"msteams,omitempty"`
+}
+
+type Attachment struct {
+	ContentType string       `json:"contentType"`
+	ContentURL  *string      `json:"contentUrl"`
+	Content     AdaptiveCard `json:"content"`
+}
+
+// Message represents the payload accepted by the Teams Workflows (Power Automate) webhook.
+// https://learn.microsoft.com/en-us/microsoftteams/platform/webhooks-and-connectors/how-to/connectors-using
+type Message struct {
+	Type        string       `json:"type"`
+	Attachments []Attachment `json:"attachments"`
+}
+
+// prepareMessage accepts an Alert object and renders the user provided Adaptive Card template.
+// If the rendered card exceeds the Teams size limit, the body elements are split
+// across multiple cards and oversized text elements are truncated.
+func (m *TeamsManager) prepareMessage(alert alertmgrtmpl.Alert) ([]Message, error) {
+	var (
+		to   bytes.Buffer
+		card AdaptiveCard
+	)
+
+	// Render a template with alert data.
+	err := m.msgTmpl.Execute(&to, alert)
+	if err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return nil, err
+	}
+
+	// Unmarshal the json to AdaptiveCard struct.
+	if err := json.Unmarshal(to.Bytes(), &card); err != nil {
+		m.lo.WithError(err).Error("Error unmarshalling json in adaptive card template")
+		return nil, err
+	}
+
+	messages := make([]Message, 0)
+	for _, c := range splitCard(card) {
+		messages = append(messages, newMessage(c))
+	}
+
+	return messages, nil
+}
+
+// splitCard packs the body elements of a card into one or more cards,
+// each of which is within maxMsgSize. Actions are attached to the last card.
+func splitCard(card AdaptiveCard) []AdaptiveCard {
+	if msgSize(card) <= maxMsgSize {
+		return []AdaptiveCard{card}
+	}
+
+	var (
+		cards = make([]AdaptiveCard, 0)
+		cur   = card
+		// Size of the card with an empty body. Each element adds its own size and
+		// a comma if it isn't the first one in the body.
+		base = msgSize(AdaptiveCard{Schema: card.Schema, Type: card.Type, Version: card.Version, Body: []json.RawMessage{}, MSTeams: card.MSTeams})
+		size = base
+	)
+	cur.Body = nil
+	cur.Actions = nil
+
+	for _, el := range card.Body {
+		if base+elemSize(el) > maxMsgSize {
+			el = truncateElement(el, maxMsgSize-base)
+		}
+		n := elemSize(el)
+
+		// Start a new card if this element doesn't fit in the current one.
+		if len(cur.Body) > 0 && size+1+n > maxMsgSize {
+			cards = append(cards, cur)
+			cur.Body = nil
+			size = base
+		}
+		if len(cur.Body) > 0 {
+			size++
+		}
+
+		cur.Body = append(cur.Body, el)
+		size += n
+	}
+
+	// Attach the actions to the last card only if they fit.
+	cur.Actions = card.Actions
+	if msgSize(cur) > maxMsgSize {
+		cur.Actions = nil
+	}
+	cards = append(cards, cur)
+
+	return cards
+}
+
+// truncateElement trims the longest string values of an element until it fits within `limit` bytes.
+// If that isn't possible, it's replaced with a TextBlock saying that the content was truncated.
+func truncateElement(el json.RawMessage, limit int) json.RawMessage {
+	var v interface{}
+	if err := json.Unmarshal(el, &v); err == nil {
+		for i := 0; i < maxTruncateAttempts; i++ {
+			out, err := json.Marshal(v)
+			if err != nil {
+				break
+			}
+			if len(out) <= limit {
+				return out
+			}
+			if !truncateLongest(v, len(out)-limit+len(truncatedSuffix)) {
+				break
+			}
+		}
+	}
+
+	out, _ := json.Marshal(map[string]interface{}{
+		"type": "TextBlock",
+		"text": truncatedSuffix,
+		"wrap": true,
+	})
+	return out
+}
+
+// truncateLongest finds the longest string value nested in `v` and trims `n` bytes off it.
+// It returns false if there's no string long enough to be trimmed.
+func truncateLongest(v interface{}, n int) bool {
+	var (
+		longest string
+		set     func(string)
+		walk    func(v interface{})
+	)
+
+	walk = func(v interface{}) {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for k, val := range t {
+				if s, ok := val.(string); ok && len(s) > len(longest) {
+					k := k
+					longest, set = s, func(s string) { t[k] = s }
+				}
+				walk(val)
+			}
+		case []interface{}:
+			for i, val := range t {
+				if s, ok := val.(string); ok && len(s) > len(longest) {
+					i := i
+					longest, set = s, func(s string) { t[i] = s }
+				}
+				walk(val)
+			}
+		}
+	}
+	walk(v)
+
+	if set == nil || len(longest) <= n {
+		return false
+	}
+	set(strings.ToValidUTF8(longest[:len(longest)-n], "") + truncatedSuffix)
+
+	return true
+}
+
+func newMessage(card AdaptiveCard) Message {
+	return Message{
+		Type: "message",
+		Attachments: []Attachment{
+			{
+				ContentType: adaptiveCardContentType,
+				Content:     card,
+			},
+		},
+	}
+}
+
+// msgSize returns the size of the final payload for a card.
+func msgSize(card AdaptiveCard) int {
+	out, err := json.Marshal(newMessage(card))
+	if err != nil {
+		return 0
+	}
+	return len(out)
+}
+
+// elemSize returns the size of an element in the payload. It can differ from the
+// rendered element since it's compacted and HTML characters are escaped.
+func elemSize(el json.RawMessage) int {
+	out, err := json.Marshal(el)
+	if err != nil {
+		return len(el)
+	}
+	return len(out)
+}
+
+// sendMessage pushes out a notification to the Teams Workflows webhook.
+func (m *TeamsManager) sendMessage(msg Message) error {
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	// Prepare the request.
+	req, err := http.NewRequest("POST", m.endpoint, bytes.NewBuffer(out))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Send the request.
+	m.lo.WithField("msg", msg).Debug("sending alert")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Workflows webhooks respond with `202 Accepted`.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from MS Teams Webhook endpoint")
+		return providers.NewStatusError(m.ID(), resp)
+	}
+
+	return nil
+}
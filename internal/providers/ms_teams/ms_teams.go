@@ -0,0 +1,122 @@
+package ms_teams
+
+import (
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+type TeamsManager struct {
+	lo       *logrus.Logger
+	metrics  *metrics.Manager
+	endpoint string
+	name     string
+	room     string
+	client   *http.Client
+	retry    *providers.Retrier
+	msgTmpl  *template.Template
+	dryRun   bool
+}
+
+type TeamsOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	Endpoint    string
+	// Name is the unique name of the provider in the config.
+	Name     string
+	Room     string
+	Template string
+}
+
+// NewTeams initializes a Microsoft Teams provider object.
+func NewTeams(opts TeamsOpts) (*TeamsManager, error) {
+	// Initialise a generic HTTP Client for communicating with the Teams webhook.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the template.
+	tmpl, err := providers.LoadTemplate(opts.Template, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TeamsManager{
+		lo:       opts.Log,
+		metrics:  opts.Metrics,
+		retry:    providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "ms_teams", opts.Name, opts.Room),
+		client:   client,
+		endpoint: opts.Endpoint,
+		name:     opts.Name,
+		room:     opts.Room,
+		msgTmpl:  tmpl,
+		dryRun:   opts.DryRun,
+	}, nil
+}
+
+// Push accepts the list of alerts and dispatches them to the Workflows webhook endpoint.
+func (m *TeamsManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to ms teams")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		// Prepare a list of messages to send.
+		msgs, err := m.prepareMessage(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		// Dispatch an HTTP request for each message.
+		for _, msg := range msgs {
+			now := time.Now()
+
+			m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+			// Send message to API.
+			if m.dryRun {
+				m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+			} else {
+				if err := m.retry.Do(func() error { return m.sendMessage(msg) }); err != nil {
+					m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+					m.lo.WithError(err).Error("error sending message")
+					perr.Add(a, msg, err)
+					continue
+				}
+			}
+
+			m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+		}
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *TeamsManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *TeamsManager) ID() string {
+	return "ms_teams"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *TeamsManager) Name() string {
+	return m.name
+}
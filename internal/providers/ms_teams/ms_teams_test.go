@@ -0,0 +1,118 @@
+package ms_teams
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeamsTemplate(t *testing.T) {
+	teams, err := NewTeams(TeamsOpts{
+		Log:      logrus.New(),
+		Endpoint: "http://",
+		Room:     "qa",
+		Template: "../../../static/ms_teams.tmpl",
+		DryRun:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "high", "alertname": "TestAlert",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"team": "qa", "dryrun": "true",
+		}),
+		GeneratorURL: "http://prometheus:9090/graph",
+	}
+
+	msgs, err := teams.prepareMessage(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "message", msgs[0].Type)
+	assert.Equal(t, adaptiveCardContentType, msgs[0].Attachments[0].ContentType)
+
+	card := msgs[0].Attachments[0].Content
+	assert.Equal(t, "AdaptiveCard", card.Type)
+	assert.Len(t, card.Body, 2)
+	assert.Len(t, card.Actions, 1)
+
+	var title map[string]interface{}
+	if err := json.Unmarshal(card.Body[0], &title); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "(HIGH) TestAlert - Firing", title["text"])
+
+	// Oversized alerts are split into multiple cards.
+	alert.Annotations = alertmgrtmpl.KV(map[string]string{
+		"description": strings.Repeat("a", maxMsgSize/2),
+		"summary":     strings.Repeat("b", maxMsgSize),
+	})
+
+	msgs, err = teams.prepareMessage(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, msgs, 2)
+	for _, msg := range msgs {
+		out, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.LessOrEqual(t, len(out), maxMsgSize)
+	}
+}
+
+func TestSplitCardLimit(t *testing.T) {
+	var (
+		el = func(n int) json.RawMessage {
+			return json.RawMessage(`{"type":"TextBlock","text":"` + strings.Repeat("a", n) + `"}`)
+		}
+		overhead = len(el(0))
+		base     = msgSize(AdaptiveCard{Type: "AdaptiveCard", Version: "1.5", Body: []json.RawMessage{}})
+	)
+
+	// A single element which takes up all the space left in the card isn't truncated.
+	card := AdaptiveCard{Type: "AdaptiveCard", Version: "1.5", Body: []json.RawMessage{el(maxMsgSize - base - overhead)}}
+	assert.Equal(t, maxMsgSize, msgSize(card))
+	cards := splitCard(card)
+	assert.Len(t, cards, 1)
+	assert.Equal(t, card.Body, cards[0].Body)
+
+	// Two elements and the comma between them fill the card exactly.
+	first := el(100)
+	second := el(maxMsgSize - base - len(first) - 1 - overhead)
+	card.Body = []json.RawMessage{first, second}
+	assert.Equal(t, maxMsgSize, msgSize(card))
+	assert.Len(t, splitCard(card), 1)
+
+	// A third element is moved to the next card, and the first one is exactly at the limit.
+	card.Body = append(card.Body, el(10))
+	cards = splitCard(card)
+	if assert.Len(t, cards, 2) {
+		assert.Len(t, cards[0].Body, 2)
+		assert.Equal(t, maxMsgSize, msgSize(cards[0]))
+		assert.Len(t, cards[1].Body, 1)
+	}
+
+	// One byte more moves the second element to its own card.
+	card.Body = []json.RawMessage{first, el(maxMsgSize - base - len(first) - overhead)}
+	cards = splitCard(card)
+	if assert.Len(t, cards, 2) {
+		for _, c := range cards {
+			assert.Len(t, c.Body, 1)
+			assert.LessOrEqual(t, msgSize(c), maxMsgSize)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package nats
+
+import (
+	"fmt"
+	"strings"
+
+	natsgo "github.com/nats-io/nats.go"
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers/pubsub"
+)
+
+// prepareMessage renders the subject and payload for the alert.
+func (m *NatsManager) prepareMessage(alert alertmgrtmpl.Alert) (*natsgo.Msg, error) {
+	subject, err := pubsub.RenderTopic(m.subjectTmpl, alert)
+	if err != nil {
+		m.lo.WithError(err).Error("Error parsing values in subject template")
+		return nil, err
+	}
+	if err := validateSubject(subject); err != nil {
+		return nil, err
+	}
+
+	data, err := pubsub.NewPayload(m.room, alert, m.msgTmpl)
+	if err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return nil, err
+	}
+
+	msg := natsgo.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set("Calert-Room", m.room)
+	msg.Header.Set("Calert-Status", alert.Status)
+	msg.Header.Set("Calert-Fingerprint", alert.Fingerprint)
+
+	return msg, nil
+}
+
+// validateSubject checks that the subject has no whitespace, wildcards or
+// empty tokens (eg if a label in the template is missing).
+func validateSubject(s string) error {
+	if strings.ContainsAny(s, " \t\r\n*>") {
+		return fmt.Errorf("invalid subject: %q", s)
+	}
+	for _, t := range strings.Split(s, ".") {
+		if t == "" {
+			return fmt.Errorf("subject has empty tokens: %q", s)
+		}
+	}
+	return nil
+}
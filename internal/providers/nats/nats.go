@@ -0,0 +1,232 @@
+package nats
+
+import (
+	"fmt"
+	"text/template"
+	"time"
+
+	natsgo "github.com/nats-io/nats.go"
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/providers/pubsub"
+	"github.com/sirupsen/logrus"
+)
+
+// Publisher publishes messages to NATS. It can be replaced with a fake in tests.
+type Publisher interface {
+	PublishMsg(msg *natsgo.Msg) error
+	Close() error
+}
+
+// corePublisher publishes messages with core NATS. The connection is flushed
+// after each message so that errors are returned to the caller.
+type corePublisher struct {
+	nc      *natsgo.Conn
+	timeout time.Duration
+}
+
+func (p *corePublisher) PublishMsg(msg *natsgo.Msg) error {
+	if err := p.nc.PublishMsg(msg); err != nil {
+		return err
+	}
+	return p.nc.FlushTimeout(p.timeout)
+}
+
+func (p *corePublisher) Close() error {
+	p.nc.Close()
+	return nil
+}
+
+// jsPublisher publishes messages to a JetStream stream and waits for the ack.
+type jsPublisher struct {
+	nc *natsgo.Conn
+	js natsgo.JetStreamContext
+}
+
+func (p *jsPublisher) PublishMsg(msg *natsgo.Msg) error {
+	_, err := p.js.PublishMsg(msg)
+	return err
+}
+
+func (p *jsPublisher) Close() error {
+	p.nc.Close()
+	return nil
+}
+
+type NatsManager struct {
+	lo          *logrus.Logger
+	metrics     *metrics.Manager
+	publisher   Publisher
+	name        string
+	room        string
+	subjectTmpl *template.Template
+	msgTmpl     *template.Template
+	dryRun      bool
+}
+
+type NatsOpts struct {
+	Log     *logrus.Logger
+	Metrics *metrics.Manager
+	DryRun  bool
+	Timeout time.Duration
+	// URL is a comma separated list of servers, eg `nats://nats-1:4222,nats://nats-2:4222`.
+	URL string
+	// Subject is a template string which is rendered for each alert.
+	Subject string
+	// JetStream publishes to a stream and waits for the server to persist the message.
+	JetStream bool
+	// CredsFile is the path of a user credentials file. Token, or Username and
+	// Password can be used instead.
+	CredsFile string
+	Token     string
+	Username  string
+	Password  string
+	// CAFile is used to verify the servers over TLS.
+	CAFile string
+	// Name is the unique name of the provider in the config.
+	Name string
+	Room string
+	// Template (optional) renders the `message` field of the payload.
+	Template string
+	// Publisher overrides the connection created from the options, eg in tests.
+	Publisher Publisher
+}
+
+// NewNats initializes a NATS provider object.
+func NewNats(opts NatsOpts) (*NatsManager, error) {
+	if opts.Subject == "" {
+		return nil, fmt.Errorf("subject is required")
+	}
+
+	// Load the templates.
+	subjectTmpl, err := pubsub.NewTopicTemplate(opts.Subject)
+	if err != nil {
+		return nil, err
+	}
+	var msgTmpl *template.Template
+	if opts.Template != "" {
+		if msgTmpl, err = providers.LoadTemplate(opts.Template, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	pub := opts.Publisher
+	if pub == nil {
+		if pub, err = newPublisher(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return &NatsManager{
+		lo:          opts.Log,
+		metrics:     opts.Metrics,
+		publisher:   pub,
+		name:        opts.Name,
+		room:        opts.Room,
+		subjectTmpl: subjectTmpl,
+		msgTmpl:     msgTmpl,
+		dryRun:      opts.DryRun,
+	}, nil
+}
+
+// newPublisher connects to the servers. The client reconnects in the
+// background if the connection is lost.
+func newPublisher(opts NatsOpts) (Publisher, error) {
+	if opts.URL == "" {
+		opts.URL = natsgo.DefaultURL
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = natsgo.DefaultTimeout
+	}
+
+	o := []natsgo.Option{
+		natsgo.Name(fmt.Sprintf("calert-%s", opts.Room)),
+		natsgo.Timeout(opts.Timeout),
+		natsgo.MaxReconnects(-1),
+		natsgo.RetryOnFailedConnect(true),
+	}
+	switch {
+	case opts.CredsFile != "":
+		o = append(o, natsgo.UserCredentials(opts.CredsFile))
+	case opts.Token != "":
+		o = append(o, natsgo.Token(opts.Token))
+	case opts.Username != "":
+		o = append(o, natsgo.UserInfo(opts.Username, opts.Password))
+	}
+	if opts.CAFile != "" {
+		o = append(o, natsgo.RootCAs(opts.CAFile))
+	}
+
+	nc, err := natsgo.Connect(opts.URL, o...)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to nats: %v", err)
+	}
+
+	if opts.JetStream {
+		js, err := nc.JetStream(natsgo.MaxWait(opts.Timeout))
+		if err != nil {
+			return nil, fmt.Errorf("error initialising jetstream: %v", err)
+		}
+		return &jsPublisher{nc: nc, js: js}, nil
+	}
+
+	return &corePublisher{nc: nc, timeout: opts.Timeout}, nil
+}
+
+// Push accepts the list of alerts and publishes a message for each of them.
+func (m *NatsManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to nats")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		msg, err := m.prepareMessage(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Publish the message.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			m.lo.WithField("subject", msg.Subject).Debug("publishing alert")
+			if err := m.publisher.PublishMsg(msg); err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				perr.Add(a, string(msg.Data), err)
+				continue
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *NatsManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *NatsManager) ID() string {
+	return "nats"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *NatsManager) Name() string {
+	return m.name
+}
+
+// Close closes the connection to the servers.
+func (m *NatsManager) Close() error {
+	return m.publisher.Close()
+}
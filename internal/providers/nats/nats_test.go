@@ -0,0 +1,74 @@
+package nats
+
+import (
+	"encoding/json"
+	"testing"
+
+	natsgo "github.com/nats-io/nats.go"
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers/pubsub"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePublisher records the messages published to it.
+type fakePublisher struct {
+	msgs   []*natsgo.Msg
+	closed bool
+}
+
+func (f *fakePublisher) PublishMsg(msg *natsgo.Msg) error {
+	f.msgs = append(f.msgs, msg)
+	return nil
+}
+
+func (f *fakePublisher) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestNatsPush(t *testing.T) {
+	fp := &fakePublisher{}
+
+	n, err := NewNats(NatsOpts{
+		Log:       logrus.New(),
+		Metrics:   metrics.New("calert"),
+		Subject:   "alerts.{{ .Labels.team }}.{{ .Labels.severity }}",
+		Room:      "factory",
+		Publisher: fp,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "critical", "alertname": "TestAlert", "team": "line1",
+		}),
+		Annotations: alertmgrtmpl.KV{},
+		Fingerprint: "1a956348d0570965",
+	}
+	// The subject of this alert has an empty token, so it's skipped.
+	noTeam := alert
+	noTeam.Labels = alertmgrtmpl.KV(map[string]string{"severity": "critical", "alertname": "TestAlert"})
+
+	assert.Error(t, n.Push([]alertmgrtmpl.Alert{alert, noTeam}))
+
+	if assert.Len(t, fp.msgs, 1) {
+		assert.Equal(t, "alerts.line1.critical", fp.msgs[0].Subject)
+		assert.Equal(t, "1a956348d0570965", fp.msgs[0].Header.Get("Calert-Fingerprint"))
+
+		var p pubsub.Payload
+		if err := json.Unmarshal(fp.msgs[0].Data, &p); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "factory", p.Room)
+		assert.Equal(t, "firing", p.Status)
+		assert.Empty(t, p.Message)
+	}
+
+	assert.NoError(t, n.Close())
+	assert.True(t, fp.closed)
+}
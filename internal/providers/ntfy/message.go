@@ -0,0 +1,84 @@
+package ntfy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/providers/push"
+)
+
+// Message represents the JSON payload for publishing a message.
+// https://docs.ntfy.sh/publish/#publish-as-json
+type Message struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority"`
+	Tags     []string `json:"tags,omitempty"`
+	Click    string   `json:"click,omitempty"`
+	Markdown bool     `json:"markdown,omitempty"`
+}
+
+// prepareMessage renders the templates and picks the priority for the alert.
+func (m *NtfyManager) prepareMessage(alert alertmgrtmpl.Alert) (Message, error) {
+	n, err := m.tmpls.Render(alert)
+	if err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return Message{}, err
+	}
+
+	// Tags matching an emoji short code are shown as emojis in front of the title.
+	tag := "rotating_light"
+	if alert.Status == "resolved" {
+		tag = "white_check_mark"
+	}
+
+	return Message{
+		Topic:    m.topic,
+		Title:    n.Title,
+		Message:  n.Message,
+		Priority: push.Priority(alert, m.priorities, defaultPriority),
+		Tags:     []string{tag},
+		Click:    n.ClickURL,
+		Markdown: m.markdown,
+	}, nil
+}
+
+// sendMessage publishes the message to the ntfy server.
+func (m *NtfyManager) sendMessage(msg Message) error {
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	// Prepare the request.
+	req, err := http.NewRequest("POST", m.endpoint, bytes.NewBuffer(out))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.token != "" {
+		req.Header.Set("Authorization", "Bearer "+m.token)
+	} else if m.username != "" {
+		req.SetBasicAuth(m.username, m.password)
+	}
+
+	// Send the request.
+	m.lo.WithField("msg", msg).Debug("sending alert")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// If response is non 200, log and throw the error.
+	if resp.StatusCode != http.StatusOK {
+		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from ntfy server")
+		return providers.NewStatusError(m.ID(), resp)
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package ntfy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/providers/push"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultServer   = "https://ntfy.sh"
+	defaultPriority = 3
+)
+
+// defaultPriorities maps the `severity` label to ntfy priorities (1-5).
+// https://docs.ntfy.sh/publish/#message-priority
+var defaultPriorities = map[string]int{
+	"critical": 5,
+	"high":     4,
+	"warning":  4,
+	"low":      2,
+	"info":     2,
+}
+
+type NtfyManager struct {
+	lo         *logrus.Logger
+	metrics    *metrics.Manager
+	endpoint   string
+	topic      string
+	token      string
+	username   string
+	password   string
+	markdown   bool
+	name       string
+	room       string
+	client     *http.Client
+	retry      *providers.Retrier
+	tmpls      push.Templates
+	priorities map[string]int
+	dryRun     bool
+}
+
+type NtfyOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	// Server is the base URL of the ntfy server. Defaults to https://ntfy.sh.
+	Server string
+	Topic  string
+	// Token is an access token. Username and Password can be used instead for basic auth.
+	Token    string
+	Username string
+	Password string
+	Markdown bool
+	// Name is the unique name of the provider in the config.
+	Name string
+	Room string
+	// Title and ClickURL are template strings. Template is the path of the message template.
+	Title      string
+	Template   string
+	ClickURL   string
+	Priorities map[string]int
+}
+
+// NewNtfy initializes an ntfy provider object.
+func NewNtfy(opts NtfyOpts) (*NtfyManager, error) {
+	if opts.Topic == "" {
+		return nil, fmt.Errorf("topic is required")
+	}
+	if opts.Server == "" {
+		opts.Server = defaultServer
+	}
+
+	priorities, err := push.Priorities(defaultPriorities, opts.Priorities, 1, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialise a generic HTTP Client for communicating with the ntfy server.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the templates.
+	tmpls, err := push.NewTemplates(opts.Title, opts.Template, opts.ClickURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NtfyManager{
+		lo:      opts.Log,
+		metrics: opts.Metrics,
+		retry:   providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "ntfy", opts.Name, opts.Room),
+		client:  client,
+		// Publishing as JSON is done on the root URL with the topic in the body.
+		endpoint:   strings.TrimSuffix(opts.Server, "/"),
+		topic:      opts.Topic,
+		token:      opts.Token,
+		username:   opts.Username,
+		password:   opts.Password,
+		markdown:   opts.Markdown,
+		name:       opts.Name,
+		room:       opts.Room,
+		tmpls:      tmpls,
+		priorities: priorities,
+		dryRun:     opts.DryRun,
+	}, nil
+}
+
+// Push accepts the list of alerts and publishes a notification for each of them.
+func (m *NtfyManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to ntfy")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		msg, err := m.prepareMessage(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Send message to API.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			if err := m.retry.Do(func() error { return m.sendMessage(msg) }); err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				perr.Add(a, msg, err)
+				continue
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *NtfyManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *NtfyManager) ID() string {
+	return "ntfy"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *NtfyManager) Name() string {
+	return m.name
+}
@@ -0,0 +1,83 @@
+package ntfy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNtfyPush(t *testing.T) {
+	var received []Message
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/", r.URL.Path)
+		assert.Equal(t, "Bearer tk_test", r.Header.Get("Authorization"))
+
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, msg)
+	}))
+	defer srv.Close()
+
+	n, err := NewNtfy(NtfyOpts{
+		Log:        logrus.New(),
+		Metrics:    metrics.New("calert"),
+		Server:     srv.URL,
+		Topic:      "alerts",
+		Token:      "tk_test",
+		Room:       "qa",
+		Template:   "../../../static/message.tmpl",
+		Priorities: map[string]int{"Warning": 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "critical", "alertname": "TestAlert",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"runbook_url": "https://runbooks.example.com/test",
+		}),
+		GeneratorURL: "http://prometheus:9090/graph",
+		Fingerprint:  "1a956348d0570965",
+	}
+	warning := alert
+	warning.Labels = alertmgrtmpl.KV(map[string]string{"severity": "warning", "alertname": "TestAlert"})
+	warning.Annotations = alertmgrtmpl.KV{}
+	resolved := alert
+	resolved.Status = "resolved"
+
+	if err := n.Push([]alertmgrtmpl.Alert{alert, warning, resolved}); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, received, 3) {
+		assert.Equal(t, "alerts", received[0].Topic)
+		assert.Equal(t, "[FIRING] TestAlert", received[0].Title)
+		assert.Equal(t, 5, received[0].Priority)
+		assert.Equal(t, []string{"rotating_light"}, received[0].Tags)
+		assert.Equal(t, "https://runbooks.example.com/test", received[0].Click)
+
+		// Custom priority and fallback to the generator URL.
+		assert.Equal(t, 3, received[1].Priority)
+		assert.Equal(t, "http://prometheus:9090/graph", received[1].Click)
+
+		assert.Equal(t, "[RESOLVED] TestAlert", received[2].Title)
+		assert.Equal(t, defaultPriority, received[2].Priority)
+		assert.Equal(t, []string{"white_check_mark"}, received[2].Tags)
+	}
+
+	_, err = NewNtfy(NtfyOpts{Topic: "alerts", Template: "../../../static/message.tmpl", Priorities: map[string]int{"critical": 7}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+package opsgenie
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+)
+
+// Limits on the fields enforced by Opsgenie.
+// https://docs.opsgenie.com/docs/alert-api#create-alert
+const (
+	maxMessageSize     = 130
+	maxDescriptionSize = 15000
+	maxTagSize         = 50
+	source             = "calert"
+)
+
+type Responder struct {
+	Type     string `json:"type"`
+	Name     string `json:"name,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// CreateAlert represents the payload for creating an alert.
+type CreateAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Responders  []Responder       `json:"responders,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+	Priority    string            `json:"priority"`
+	Source      string            `json:"source"`
+}
+
+// CloseAlert represents the payload for closing an alert.
+type CloseAlert struct {
+	Source string `json:"source"`
+	Note   string `json:"note,omitempty"`
+}
+
+// Request is a rendered request to the Alert API.
+type Request struct {
+	URL  string
+	Body interface{}
+}
+
+// prepareRequest maps the alert to a create request if it's firing or a close request if it's resolved.
+func (m *OpsgenieManager) prepareRequest(alert alertmgrtmpl.Alert) (Request, error) {
+	if alert.Status == "resolved" {
+		return Request{
+			URL:  fmt.Sprintf("%s/%s/close?identifierType=alias", m.endpoint, url.PathEscape(alert.Fingerprint)),
+			Body: CloseAlert{Source: source, Note: "Resolved in Alertmanager"},
+		}, nil
+	}
+
+	msg, err := providers.Render(m.msgTmpl, alert)
+	if err != nil {
+		return Request{}, err
+	}
+
+	ca := CreateAlert{
+		Message:  providers.Truncate(msg, maxMessageSize),
+		Alias:    alert.Fingerprint,
+		Details:  alert.Labels,
+		Priority: m.priority(alert),
+		Source:   source,
+	}
+
+	if m.descTmpl != nil {
+		desc, err := providers.Render(m.descTmpl, alert)
+		if err != nil {
+			return Request{}, err
+		}
+		ca.Description = providers.Truncate(desc, maxDescriptionSize)
+	}
+
+	for _, t := range m.responderTmpls {
+		r, err := providers.Render(t, alert)
+		if err != nil {
+			return Request{}, err
+		}
+		if resp, ok := parseResponder(r); ok {
+			ca.Responders = append(ca.Responders, resp)
+		}
+	}
+
+	for _, t := range m.tagTmpls {
+		tag, err := providers.Render(t, alert)
+		if err != nil {
+			return Request{}, err
+		}
+		if tag != "" {
+			ca.Tags = append(ca.Tags, providers.Truncate(tag, maxTagSize))
+		}
+	}
+
+	return Request{URL: m.endpoint, Body: ca}, nil
+}
+
+// priority returns the priority for an alert based on its `severity` label.
+func (m *OpsgenieManager) priority(alert alertmgrtmpl.Alert) string {
+	if p, ok := m.priorities[strings.ToLower(alert.Labels["severity"])]; ok {
+		return p
+	}
+	return defaultPriority
+}
+
+// sendRequest sends the request to the Alert API.
+func (m *OpsgenieManager) sendRequest(r Request) error {
+	out, err := json.Marshal(r.Body)
+	if err != nil {
+		return err
+	}
+
+	// Prepare the request.
+	req, err := http.NewRequest("POST", r.URL, bytes.NewBuffer(out))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+m.apiKey)
+
+	// Send the request.
+	m.lo.WithField("url", r.URL).WithField("body", r.Body).Debug("sending request")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Alert API processes requests asynchronously and responds with `202 Accepted`.
+	if resp.StatusCode != http.StatusAccepted {
+		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from Opsgenie API")
+		return providers.NewStatusError(m.ID(), resp)
+	}
+
+	return nil
+}
+
+// parseResponder parses a rendered responder of the form `<type>:<name>`.
+// Users are identified by their username and the rest by name.
+func parseResponder(s string) (Responder, bool) {
+	typ, name, ok := strings.Cut(s, ":")
+	if !ok || name == "" {
+		return Responder{}, false
+	}
+
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	name = strings.TrimSpace(name)
+	switch typ {
+	case "user":
+		return Responder{Type: typ, Username: name}, true
+	case "team", "escalation", "schedule":
+		return Responder{Type: typ, Name: name}, true
+	}
+
+	return Responder{}, false
+}
@@ -0,0 +1,197 @@
+package opsgenie
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAPIURL   = "https://api.opsgenie.com"
+	defaultMessage  = `{{ .Labels.alertname }}{{ if .Annotations.summary }}: {{ .Annotations.summary }}{{ end }}`
+	defaultPriority = "P3"
+)
+
+// defaultPriorities maps the `severity` label of an alert to the Opsgenie priority.
+var defaultPriorities = map[string]string{
+	"critical": "P1",
+	"high":     "P2",
+	"warning":  "P3",
+	"low":      "P4",
+	"info":     "P5",
+}
+
+var reValidPriority = regexp.MustCompile(`^P[1-5]$`)
+
+type OpsgenieManager struct {
+	lo             *logrus.Logger
+	metrics        *metrics.Manager
+	endpoint       string
+	apiKey         string
+	name           string
+	room           string
+	client         *http.Client
+	retry          *providers.Retrier
+	msgTmpl        *template.Template
+	descTmpl       *template.Template
+	responderTmpls []*template.Template
+	tagTmpls       []*template.Template
+	priorities     map[string]string
+	dryRun         bool
+}
+
+type OpsgenieOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	// APIURL is the base URL of the API. Use https://api.eu.opsgenie.com for the EU instance.
+	APIURL string
+	APIKey string
+	// Name is the unique name of the provider in the config.
+	Name string
+	Room string
+	// Message is a template string for the alert message.
+	Message string
+	// Template is the path of the template for the alert description.
+	Template string
+	// Responders are template strings which render to `<type>:<name>`, eg `team:{{ .Labels.team }}`.
+	Responders []string
+	// Tags are template strings for the tags. Empty tags are skipped.
+	Tags []string
+	// Priorities maps the `severity` label to a priority (P1-P5).
+	Priorities map[string]string
+}
+
+// NewOpsgenie initializes an Opsgenie provider object.
+func NewOpsgenie(opts OpsgenieOpts) (*OpsgenieManager, error) {
+	if opts.APIKey == "" {
+		return nil, fmt.Errorf("api_key is required")
+	}
+	if opts.APIURL == "" {
+		opts.APIURL = defaultAPIURL
+	}
+	if opts.Message == "" {
+		opts.Message = defaultMessage
+	}
+
+	priorities := make(map[string]string, len(defaultPriorities))
+	for k, v := range defaultPriorities {
+		priorities[k] = v
+	}
+	for k, v := range opts.Priorities {
+		v = strings.ToUpper(v)
+		if !reValidPriority.MatchString(v) {
+			return nil, fmt.Errorf("invalid priority %s for severity %s", v, k)
+		}
+		priorities[strings.ToLower(k)] = v
+	}
+
+	// Initialise a generic HTTP Client for communicating with the Opsgenie API.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &OpsgenieManager{
+		lo:         opts.Log,
+		metrics:    opts.Metrics,
+		retry:      providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "opsgenie", opts.Name, opts.Room),
+		client:     client,
+		endpoint:   strings.TrimSuffix(opts.APIURL, "/") + "/v2/alerts",
+		apiKey:     opts.APIKey,
+		name:       opts.Name,
+		room:       opts.Room,
+		priorities: priorities,
+		dryRun:     opts.DryRun,
+	}
+
+	// Load the templates.
+	if mgr.msgTmpl, err = providers.NewTemplate("message", opts.Message); err != nil {
+		return nil, fmt.Errorf("error parsing message template: %v", err)
+	}
+	if opts.Template != "" {
+		if mgr.descTmpl, err = providers.LoadTemplate(opts.Template, nil); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range opts.Responders {
+		t, err := providers.NewTemplate("responder", r)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing responder template: %v", err)
+		}
+		mgr.responderTmpls = append(mgr.responderTmpls, t)
+	}
+	for _, tag := range opts.Tags {
+		t, err := providers.NewTemplate("tag", tag)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing tag template: %v", err)
+		}
+		mgr.tagTmpls = append(mgr.tagTmpls, t)
+	}
+
+	return mgr, nil
+}
+
+// Push accepts the list of alerts and creates an Opsgenie alert for each firing alert
+// and closes it when it's resolved. The fingerprint is used as the `alias` to deduplicate them.
+func (m *OpsgenieManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to opsgenie")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		req, err := m.prepareRequest(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing request")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Send message to API.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			if err := m.retry.Do(func() error { return m.sendRequest(req) }); err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending request")
+				perr.Add(a, req, err)
+				continue
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *OpsgenieManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *OpsgenieManager) ID() string {
+	return "opsgenie"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *OpsgenieManager) Name() string {
+	return m.name
+}
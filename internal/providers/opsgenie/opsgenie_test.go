@@ -0,0 +1,65 @@
+package opsgenie
+
+import (
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpsgenieRequest(t *testing.T) {
+	og, err := NewOpsgenie(OpsgenieOpts{
+		Log:      logrus.New(),
+		APIKey:   "test-key",
+		Room:     "qa",
+		Template: "../../../static/message.tmpl",
+		Responders: []string{
+			"team:{{ .Labels.team }}",
+			"user:{{ .Annotations.owner }}",
+		},
+		Tags:       []string{"{{ .Labels.env }}", "{{ .Labels.missing }}"},
+		Priorities: map[string]string{"high": "p1"},
+		DryRun:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "high", "alertname": "TestAlert", "team": "infra", "env": "prod",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"summary": "disk is full",
+		}),
+		Fingerprint: "1a956348d0570965",
+	}
+
+	req, err := og.prepareRequest(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "https://api.opsgenie.com/v2/alerts", req.URL)
+	assert.Equal(t, CreateAlert{
+		Message:     "TestAlert: disk is full",
+		Alias:       "1a956348d0570965",
+		Description: "*(HIGH) TestAlert - Firing*\nSummary: disk is full",
+		Responders:  []Responder{{Type: "team", Name: "infra"}},
+		Tags:        []string{"prod"},
+		Details:     alert.Labels,
+		Priority:    "P1",
+		Source:      "calert",
+	}, req.Body)
+
+	alert.Status = "resolved"
+	req, err = og.prepareRequest(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "https://api.opsgenie.com/v2/alerts/1a956348d0570965/close?identifierType=alias", req.URL)
+	assert.Equal(t, CloseAlert{Source: "calert", Note: "Resolved in Alertmanager"}, req.Body)
+}
@@ -0,0 +1,154 @@
+package pagerduty
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+)
+
+const (
+	actionTrigger = "trigger"
+	actionResolve = "resolve"
+
+	// maxSummarySize is the maximum length of the summary accepted by PagerDuty.
+	maxSummarySize = 1024
+	fallbackSource = "calert"
+)
+
+// severities maps the commonly used `severity` label values to the
+// severities accepted by PagerDuty. Unknown values are sent as `error`.
+var severities = map[string]string{
+	"critical": "critical",
+	"error":    "error",
+	"high":     "error",
+	"warning":  "warning",
+	"warn":     "warning",
+	"info":     "info",
+	"low":      "info",
+}
+
+// Payload contains the details of a triggered alert.
+type Payload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+type Link struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+// Event represents an Events API v2 request.
+// https://developer.pagerduty.com/docs/events-api-v2/overview/
+type Event struct {
+	RoutingKey  string   `json:"routing_key"`
+	EventAction string   `json:"event_action"`
+	DedupKey    string   `json:"dedup_key"`
+	Payload     *Payload `json:"payload,omitempty"`
+	Links       []Link   `json:"links,omitempty"`
+}
+
+// prepareEvent maps the alert to a trigger or a resolve event based on its status.
+func (m *PagerDutyManager) prepareEvent(alert alertmgrtmpl.Alert) (Event, error) {
+	ev := Event{
+		RoutingKey:  m.routingKey,
+		EventAction: actionTrigger,
+		DedupKey:    alert.Fingerprint,
+	}
+
+	// Resolve events only need the dedup key.
+	if alert.Status == "resolved" {
+		ev.EventAction = actionResolve
+		return ev, nil
+	}
+
+	summary, err := providers.Render(m.summaryTmpl, alert)
+	if err != nil {
+		return ev, err
+	}
+	severity, err := providers.Render(m.severityTmpl, alert)
+	if err != nil {
+		return ev, err
+	}
+	source, err := providers.Render(m.sourceTmpl, alert)
+	if err != nil {
+		return ev, err
+	}
+
+	summary = providers.Truncate(summary, maxSummarySize)
+	if s, ok := severities[strings.ToLower(severity)]; ok {
+		severity = s
+	} else {
+		severity = "error"
+	}
+	if source == "" {
+		source = fallbackSource
+	}
+
+	details := make(map[string]interface{})
+	if len(m.detailsTmpls) == 0 {
+		details["labels"] = alert.Labels
+		details["annotations"] = alert.Annotations
+	}
+	for k, t := range m.detailsTmpls {
+		if details[k], err = providers.Render(t, alert); err != nil {
+			return ev, err
+		}
+	}
+
+	ev.Payload = &Payload{
+		Summary:       summary,
+		Source:        source,
+		Severity:      severity,
+		Timestamp:     alert.StartsAt.UTC().Format(time.RFC3339),
+		CustomDetails: details,
+	}
+
+	if alert.GeneratorURL != "" {
+		ev.Links = append(ev.Links, Link{Href: alert.GeneratorURL, Text: "Source"})
+	}
+	if u := alert.Annotations["runbook_url"]; u != "" {
+		ev.Links = append(ev.Links, Link{Href: u, Text: "Runbook"})
+	}
+
+	return ev, nil
+}
+
+// sendEvent sends the event to the Events API.
+func (m *PagerDutyManager) sendEvent(ev Event) error {
+	out, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	// Prepare the request.
+	req, err := http.NewRequest("POST", m.endpoint, bytes.NewBuffer(out))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Send the request.
+	m.lo.WithField("dedup_key", ev.DedupKey).WithField("action", ev.EventAction).Debug("sending event")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Events API responds with `202 Accepted`.
+	if resp.StatusCode != http.StatusAccepted {
+		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from PagerDuty Events API")
+		return providers.NewStatusError(m.ID(), resp)
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package pagerduty
+
+import (
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAPIURL   = "https://events.pagerduty.com/v2/enqueue"
+	defaultSummary  = `{{ .Labels.alertname }}{{ if .Annotations.summary }}: {{ .Annotations.summary }}{{ end }}`
+	defaultSeverity = `{{ .Labels.severity }}`
+	defaultSource   = `{{ .Labels.instance }}`
+)
+
+type PagerDutyManager struct {
+	lo           *logrus.Logger
+	metrics      *metrics.Manager
+	endpoint     string
+	routingKey   string
+	name         string
+	room         string
+	client       *http.Client
+	retry        *providers.Retrier
+	summaryTmpl  *template.Template
+	severityTmpl *template.Template
+	sourceTmpl   *template.Template
+	detailsTmpls map[string]*template.Template
+	dryRun       bool
+}
+
+type PagerDutyOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	// APIURL is the Events API v2 endpoint. Defaults to https://events.pagerduty.com/v2/enqueue.
+	APIURL string
+	// RoutingKey is the integration key of the service.
+	RoutingKey string
+	// Name is the unique name of the provider in the config.
+	Name string
+	Room string
+	// Summary, Severity and Source are template strings for the respective payload fields.
+	Summary  string
+	Severity string
+	Source   string
+	// Details is a map of template strings rendered into `custom_details`.
+	// If empty, all the labels and annotations are sent.
+	Details map[string]string
+}
+
+// NewPagerDuty initializes a PagerDuty Events API v2 provider object.
+func NewPagerDuty(opts PagerDutyOpts) (*PagerDutyManager, error) {
+	if opts.RoutingKey == "" {
+		return nil, fmt.Errorf("routing_key is required")
+	}
+	if opts.APIURL == "" {
+		opts.APIURL = defaultAPIURL
+	}
+	if opts.Summary == "" {
+		opts.Summary = defaultSummary
+	}
+	if opts.Severity == "" {
+		opts.Severity = defaultSeverity
+	}
+	if opts.Source == "" {
+		opts.Source = defaultSource
+	}
+
+	// Initialise a generic HTTP Client for communicating with the Events API.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &PagerDutyManager{
+		lo:           opts.Log,
+		metrics:      opts.Metrics,
+		retry:        providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "pagerduty", opts.Name, opts.Room),
+		client:       client,
+		endpoint:     opts.APIURL,
+		routingKey:   opts.RoutingKey,
+		name:         opts.Name,
+		room:         opts.Room,
+		detailsTmpls: make(map[string]*template.Template, len(opts.Details)),
+		dryRun:       opts.DryRun,
+	}
+
+	// Parse the field templates.
+	for _, t := range []struct {
+		name string
+		text string
+		tmpl **template.Template
+	}{
+		{"summary", opts.Summary, &mgr.summaryTmpl},
+		{"severity", opts.Severity, &mgr.severityTmpl},
+		{"source", opts.Source, &mgr.sourceTmpl},
+	} {
+		if *t.tmpl, err = providers.NewTemplate(t.name, t.text); err != nil {
+			return nil, fmt.Errorf("error parsing %s template: %v", t.name, err)
+		}
+	}
+	for k, v := range opts.Details {
+		if mgr.detailsTmpls[k], err = providers.NewTemplate(k, v); err != nil {
+			return nil, fmt.Errorf("error parsing details template %s: %v", k, err)
+		}
+	}
+
+	return mgr, nil
+}
+
+// Push accepts the list of alerts and sends a trigger or resolve event for each of them.
+// The fingerprint of the alert is used as the `dedup_key`, so all the events for an alert
+// update the same PagerDuty incident.
+func (m *PagerDutyManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to pagerduty")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		ev, err := m.prepareEvent(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing event")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Send message to API.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			if err := m.retry.Do(func() error { return m.sendEvent(ev) }); err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending event")
+				// The routing key isn't kept with the failed event.
+				ev.RoutingKey = ""
+				perr.Add(a, ev, err)
+				continue
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *PagerDutyManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *PagerDutyManager) ID() string {
+	return "pagerduty"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *PagerDutyManager) Name() string {
+	return m.name
+}
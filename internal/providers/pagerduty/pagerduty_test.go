@@ -0,0 +1,80 @@
+package pagerduty
+
+import (
+	"testing"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagerDutyEvent(t *testing.T) {
+	pd, err := NewPagerDuty(PagerDutyOpts{
+		Log:        logrus.New(),
+		RoutingKey: "test-key",
+		Room:       "qa",
+		Details: map[string]string{
+			"team": "{{ .Labels.team | toUpper }}",
+		},
+		DryRun: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "warn", "alertname": "TestAlert", "instance": "db-1", "team": "qa",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"summary": "disk is full", "runbook_url": "http://runbooks/disk",
+		}),
+		StartsAt:     time.Date(2022, 2, 16, 10, 40, 45, 0, time.UTC),
+		GeneratorURL: "http://prometheus:9090/graph",
+		Fingerprint:  "1a956348d0570965",
+	}
+
+	ev, err := pd.prepareEvent(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, Event{
+		RoutingKey:  "test-key",
+		EventAction: "trigger",
+		DedupKey:    "1a956348d0570965",
+		Payload: &Payload{
+			Summary:       "TestAlert: disk is full",
+			Source:        "db-1",
+			Severity:      "warning",
+			Timestamp:     "2022-02-16T10:40:45Z",
+			CustomDetails: map[string]interface{}{"team": "QA"},
+		},
+		Links: []Link{
+			{Href: "http://prometheus:9090/graph", Text: "Source"},
+			{Href: "http://runbooks/disk", Text: "Runbook"},
+		},
+	}, ev)
+
+	// Source falls back to calert if the label is missing.
+	delete(alert.Labels, "instance")
+	ev, err = pd.prepareEvent(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "calert", ev.Payload.Source)
+
+	alert.Status = "resolved"
+	ev, err = pd.prepareEvent(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, Event{
+		RoutingKey:  "test-key",
+		EventAction: "resolve",
+		DedupKey:    "1a956348d0570965",
+	}, ev)
+}
@@ -1,14 +1,71 @@
 package providers
 
 import (
+	"fmt"
+	"time"
+
 	alertmgrtmpl "github.com/prometheus/alertmanager/template"
 )
 
 type Provider interface {
-	// ID represents the name of provider.
+	// ID represents the type of provider.
 	ID() string
+	// Name returns the unique name of the provider, which is its key in the config.
+	// Several providers of the same type can be configured for a room.
+	Name() string
 	// Room returns the room name specified for the provider.
 	Room() string
 	// Push pushes the notification to upstream provider.
 	Push(alerts []alertmgrtmpl.Alert) error
 }
+
+// PushError is returned by Push if some of the messages couldn't be prepared or sent.
+type PushError struct {
+	Provider string
+	// Failed is the number of failed messages and Err is the last error.
+	Failed int
+	Err    error
+	// Failures has the alert and error for each failed message.
+	Failures []Failure
+}
+
+// Failure is an alert whose message couldn't be prepared or sent.
+type Failure struct {
+	Alert alertmgrtmpl.Alert
+	// Message is the rendered message, or nil if it couldn't be prepared.
+	Message interface{}
+	Err     error
+}
+
+// Add records a failed message.
+func (e *PushError) Add(a alertmgrtmpl.Alert, msg interface{}, err error) {
+	e.Failed++
+	e.Err = err
+	e.Failures = append(e.Failures, Failure{Alert: a, Message: msg, Err: err})
+}
+
+// OrNil returns the error if any message failed, or nil.
+func (e *PushError) OrNil() error {
+	if e.Failed == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *PushError) Error() string {
+	return fmt.Sprintf("%s: %d message(s) failed: %v", e.Provider, e.Failed, e.Err)
+}
+
+func (e *PushError) Unwrap() error {
+	return e.Err
+}
+
+// DeferError is returned for an alert which wasn't sent yet and should be pushed
+// again after `After`, eg because it's over the rate limit of the provider.
+type DeferError struct {
+	After time.Duration
+}
+
+func (e *DeferError) Error() string {
+	return fmt.Sprintf("deferred for %s", e.After)
+}
@@ -0,0 +1,77 @@
+// Package pubsub contains the helpers shared by the providers which publish
+// alerts to a message broker (Kafka, NATS and MQTT).
+package pubsub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+)
+
+// ErrEmptyTopic is returned if the topic template renders an empty string,
+// eg if the label used in it is missing.
+var ErrEmptyTopic = errors.New("topic is empty")
+
+// Payload is the JSON published for an alert.
+type Payload struct {
+	Room         string            `json:"room"`
+	Status       string            `json:"status"`
+	Fingerprint  string            `json:"fingerprint"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Message      string            `json:"message,omitempty"`
+}
+
+// NewPayload returns the JSON payload for an alert. If `tmpl` is non nil,
+// it's rendered in the `message` field.
+func NewPayload(room string, alert alertmgrtmpl.Alert, tmpl *template.Template) ([]byte, error) {
+	p := Payload{
+		Room:         room,
+		Status:       alert.Status,
+		Fingerprint:  alert.Fingerprint,
+		Labels:       alert.Labels,
+		Annotations:  alert.Annotations,
+		StartsAt:     alert.StartsAt,
+		EndsAt:       alert.EndsAt,
+		GeneratorURL: alert.GeneratorURL,
+	}
+	if tmpl != nil {
+		var to bytes.Buffer
+		if err := tmpl.Execute(&to, alert); err != nil {
+			return nil, err
+		}
+		p.Message = to.String()
+	}
+
+	return json.Marshal(p)
+}
+
+// NewTopicTemplate parses a topic (or subject) template string.
+func NewTopicTemplate(text string) (*template.Template, error) {
+	t, err := providers.NewTemplate("topic", text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing topic template: %v", err)
+	}
+	return t, nil
+}
+
+// RenderTopic renders the topic template with the alert data.
+func RenderTopic(t *template.Template, alert alertmgrtmpl.Alert) (string, error) {
+	topic, err := providers.Render(t, alert)
+	if err != nil {
+		return "", err
+	}
+	if topic == "" {
+		return "", ErrEmptyTopic
+	}
+	return topic, nil
+}
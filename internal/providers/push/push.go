@@ -0,0 +1,111 @@
+// Package push contains the helpers shared by the phone push notification
+// providers (ntfy, Gotify and Pushover).
+package push
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+)
+
+const (
+	// DefaultTitle is the default template for the notification title.
+	DefaultTitle = `[{{ .Status | toUpper }}] {{ .Labels.alertname }}`
+	// DefaultClickURL is the default template for the URL opened on tapping the
+	// notification. It prefers the `runbook_url` annotation over the Prometheus URL.
+	DefaultClickURL = `{{ if .Annotations.runbook_url }}{{ .Annotations.runbook_url }}{{ else }}{{ .GeneratorURL }}{{ end }}`
+)
+
+// Templates holds the parsed templates used to render a notification.
+type Templates struct {
+	Title    *template.Template
+	Message  *template.Template
+	ClickURL *template.Template
+}
+
+// Notification is a rendered notification.
+type Notification struct {
+	Title    string
+	Message  string
+	ClickURL string
+}
+
+// NewTemplates parses the title and click URL template strings (using the defaults
+// if they're empty) and loads the message template from `msgPath`.
+func NewTemplates(title, msgPath, clickURL string) (Templates, error) {
+	var (
+		t   Templates
+		err error
+	)
+
+	if title == "" {
+		title = DefaultTitle
+	}
+	if clickURL == "" {
+		clickURL = DefaultClickURL
+	}
+
+	if t.Title, err = providers.NewTemplate("title", title); err != nil {
+		return t, fmt.Errorf("error parsing title template: %v", err)
+	}
+	if t.ClickURL, err = providers.NewTemplate("click_url", clickURL); err != nil {
+		return t, fmt.Errorf("error parsing click_url template: %v", err)
+	}
+	if t.Message, err = providers.LoadTemplate(msgPath, nil); err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
+// Render renders all the templates with the alert data.
+func (t Templates) Render(alert alertmgrtmpl.Alert) (Notification, error) {
+	var (
+		n   Notification
+		err error
+	)
+
+	if n.Title, err = providers.Render(t.Title, alert); err != nil {
+		return n, err
+	}
+	if n.Message, err = providers.Render(t.Message, alert); err != nil {
+		return n, err
+	}
+	if n.ClickURL, err = providers.Render(t.ClickURL, alert); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// Priorities merges the user provided map of `severity` label to priority
+// over the defaults of a provider, checking that they're within [min, max].
+func Priorities(defaults, custom map[string]int, min, max int) (map[string]int, error) {
+	out := make(map[string]int, len(defaults)+len(custom))
+	for k, v := range defaults {
+		out[k] = v
+	}
+	for k, v := range custom {
+		if v < min || v > max {
+			return nil, fmt.Errorf("priority %d for severity %s is not within %d and %d", v, k, min, max)
+		}
+		out[strings.ToLower(k)] = v
+	}
+
+	return out, nil
+}
+
+// Priority returns the priority for the alert based on its `severity` label.
+// Resolved alerts are always sent with the default priority so that they don't page anyone.
+func Priority(alert alertmgrtmpl.Alert, priorities map[string]int, def int) int {
+	if alert.Status == "resolved" {
+		return def
+	}
+	if p, ok := priorities[strings.ToLower(alert.Labels["severity"])]; ok {
+		return p
+	}
+	return def
+}
@@ -0,0 +1,109 @@
+package pushover
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/providers/push"
+)
+
+// Limits on the fields enforced by Pushover.
+// https://pushover.net/api#limits
+const (
+	maxTitleSize   = 250
+	maxMessageSize = 1024
+	maxURLSize     = 512
+)
+
+// prepareMessage renders the templates and returns the form values for the Messages API.
+// https://pushover.net/api#messages
+func (m *PushoverManager) prepareMessage(alert alertmgrtmpl.Alert) (url.Values, error) {
+	n, err := m.tmpls.Render(alert)
+	if err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return nil, err
+	}
+
+	priority := push.Priority(alert, m.priorities, defaultPriority)
+
+	msg := url.Values{}
+	msg.Set("token", m.token)
+	msg.Set("user", m.userKey)
+	msg.Set("title", truncate(n.Title, maxTitleSize))
+	msg.Set("message", truncate(n.Message, maxMessageSize))
+	msg.Set("priority", strconv.Itoa(priority))
+	msg.Set("timestamp", strconv.FormatInt(alert.StartsAt.Unix(), 10))
+
+	if m.device != "" {
+		msg.Set("device", m.device)
+	}
+	if m.html {
+		msg.Set("html", "1")
+	}
+	if n.ClickURL != "" && len(n.ClickURL) <= maxURLSize {
+		msg.Set("url", n.ClickURL)
+	}
+	if priority == priorityEmergency {
+		msg.Set("retry", strconv.Itoa(int(m.emergencyRetry.Seconds())))
+		msg.Set("expire", strconv.Itoa(int(m.emergencyExpire.Seconds())))
+	}
+
+	return msg, nil
+}
+
+// sendMessage sends the notification to the Messages API.
+func (m *PushoverManager) sendMessage(msg url.Values) error {
+	// Send the request. The message isn't logged since it contains the tokens.
+	m.lo.WithField("title", msg.Get("title")).Debug("sending alert")
+	resp, err := m.client.PostForm(m.endpoint, msg)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// If response is non 200, log and throw the error.
+	if resp.StatusCode != http.StatusOK {
+		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from Pushover API")
+		return providers.NewStatusError(m.ID(), resp)
+	}
+
+	var r struct {
+		Status int      `json:"status"`
+		Errors []string `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	if r.Status != 1 {
+		return errors.New("error from pushover: " + strings.Join(r.Errors, ", "))
+	}
+
+	return nil
+}
+
+// redact returns a copy of the message without the token and user key.
+func redact(msg url.Values) url.Values {
+	out := make(url.Values, len(msg))
+	for k, v := range msg {
+		if k == "token" || k == "user" {
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// truncate trims a string to `n` characters. Pushover's limits are in characters
+// rather than bytes, unlike the ones providers.Truncate is used for.
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
@@ -0,0 +1,193 @@
+package pushover
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/providers/push"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAPIURL   = "https://api.pushover.net/1/messages.json"
+	defaultPriority = 0
+
+	// Emergency priority notifications are repeated every `emergency_retry`
+	// until they're acknowledged or `emergency_expire` is reached.
+	priorityEmergency      = 2
+	defaultEmergencyRetry  = 1 * time.Minute
+	defaultEmergencyExpire = 1 * time.Hour
+	// Limits of `retry` and `expire` accepted by the API.
+	minEmergencyRetry  = 30 * time.Second
+	maxEmergencyExpire = 3 * time.Hour
+)
+
+// defaultPriorities maps the `severity` label to Pushover priorities (-2 to 2).
+// https://pushover.net/api#priority
+var defaultPriorities = map[string]int{
+	"critical": 1,
+	"high":     1,
+	"warning":  0,
+	"low":      -1,
+	"info":     -1,
+}
+
+type PushoverManager struct {
+	lo              *logrus.Logger
+	metrics         *metrics.Manager
+	endpoint        string
+	token           string
+	userKey         string
+	device          string
+	html            bool
+	emergencyRetry  time.Duration
+	emergencyExpire time.Duration
+	name            string
+	room            string
+	client          *http.Client
+	retry           *providers.Retrier
+	tmpls           push.Templates
+	priorities      map[string]int
+	dryRun          bool
+}
+
+type PushoverOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	APIURL      string
+	// Token is the application API token and UserKey is the user or group key.
+	Token   string
+	UserKey string
+	// Device optionally limits the notification to a device of the user.
+	Device string
+	HTML   bool
+	// EmergencyRetry and EmergencyExpire are used for emergency (2) priority notifications.
+	EmergencyRetry  time.Duration
+	EmergencyExpire time.Duration
+	// Name is the unique name of the provider in the config.
+	Name string
+	Room string
+	// Title and ClickURL are template strings. Template is the path of the message template.
+	Title      string
+	Template   string
+	ClickURL   string
+	Priorities map[string]int
+}
+
+// NewPushover initializes a Pushover provider object.
+func NewPushover(opts PushoverOpts) (*PushoverManager, error) {
+	if opts.Token == "" || opts.UserKey == "" {
+		return nil, fmt.Errorf("token and user_key are required")
+	}
+	if opts.APIURL == "" {
+		opts.APIURL = defaultAPIURL
+	}
+	if opts.EmergencyRetry == 0 {
+		opts.EmergencyRetry = defaultEmergencyRetry
+	}
+	if opts.EmergencyExpire == 0 {
+		opts.EmergencyExpire = defaultEmergencyExpire
+	}
+	if opts.EmergencyRetry < minEmergencyRetry {
+		return nil, fmt.Errorf("emergency_retry must be at least %s", minEmergencyRetry)
+	}
+	if opts.EmergencyExpire < time.Second || opts.EmergencyExpire > maxEmergencyExpire {
+		return nil, fmt.Errorf("emergency_expire must be between 1s and %s", maxEmergencyExpire)
+	}
+
+	priorities, err := push.Priorities(defaultPriorities, opts.Priorities, -2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialise a generic HTTP Client for communicating with the Pushover API.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the templates.
+	tmpls, err := push.NewTemplates(opts.Title, opts.Template, opts.ClickURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PushoverManager{
+		lo:              opts.Log,
+		metrics:         opts.Metrics,
+		retry:           providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "pushover", opts.Name, opts.Room),
+		client:          client,
+		endpoint:        opts.APIURL,
+		token:           opts.Token,
+		userKey:         opts.UserKey,
+		device:          opts.Device,
+		html:            opts.HTML,
+		emergencyRetry:  opts.EmergencyRetry,
+		emergencyExpire: opts.EmergencyExpire,
+		name:            opts.Name,
+		room:            opts.Room,
+		tmpls:           tmpls,
+		priorities:      priorities,
+		dryRun:          opts.DryRun,
+	}, nil
+}
+
+// Push accepts the list of alerts and sends a notification for each of them.
+func (m *PushoverManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to pushover")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		msg, err := m.prepareMessage(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Send message to API.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			if err := m.retry.Do(func() error { return m.sendMessage(msg) }); err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				perr.Add(a, redact(msg), err)
+				continue
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *PushoverManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *PushoverManager) ID() string {
+	return "pushover"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *PushoverManager) Name() string {
+	return m.name
+}
@@ -0,0 +1,114 @@
+package pushover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushoverPush(t *testing.T) {
+	var received []url.Values
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, r.PostForm)
+
+		if r.PostForm.Get("user") != "user-key" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"user":"invalid","errors":["user identifier is invalid"],"status":0}`))
+			return
+		}
+		w.Write([]byte(`{"status":1,"request":"647d2300-702c-4b38-8b2f-d56326ae460b"}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewPushover(PushoverOpts{
+		Log:        logrus.New(),
+		Metrics:    metrics.New("calert"),
+		APIURL:     srv.URL,
+		Token:      "app-token",
+		UserKey:    "user-key",
+		Room:       "qa",
+		Template:   "../../../static/message.tmpl",
+		Priorities: map[string]int{"critical": 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "critical", "alertname": "TestAlert",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"summary": strings.Repeat("a", 2000),
+		}),
+		GeneratorURL: "http://prometheus:9090/graph",
+		Fingerprint:  "1a956348d0570965",
+	}
+	resolved := alert
+	resolved.Status = "resolved"
+
+	if err := p.Push([]alertmgrtmpl.Alert{alert, resolved}); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, received, 2) {
+		assert.Equal(t, "app-token", received[0].Get("token"))
+		assert.Equal(t, "[FIRING] TestAlert", received[0].Get("title"))
+		assert.Equal(t, "2", received[0].Get("priority"))
+		assert.Equal(t, "60", received[0].Get("retry"))
+		assert.Equal(t, "3600", received[0].Get("expire"))
+		assert.Equal(t, "http://prometheus:9090/graph", received[0].Get("url"))
+		assert.Len(t, received[0].Get("message"), maxMessageSize)
+
+		assert.Equal(t, "0", received[1].Get("priority"))
+		assert.Empty(t, received[1].Get("retry"))
+	}
+
+	// API errors are returned from sendMessage.
+	p.userKey = "invalid"
+	msg, err := p.prepareMessage(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, p.sendMessage(msg))
+}
+
+func TestPushoverEmergencyLimits(t *testing.T) {
+	opts := PushoverOpts{
+		Log:      logrus.New(),
+		Metrics:  metrics.New("calert"),
+		Token:    "app-token",
+		UserKey:  "user-key",
+		Room:     "qa",
+		Template: "../../../static/message.tmpl",
+	}
+
+	// The limits of the API are checked when the provider is initialised.
+	for _, tc := range []struct {
+		retry, expire time.Duration
+		ok            bool
+	}{
+		{30 * time.Second, 3 * time.Hour, true},
+		{10 * time.Second, time.Hour, false},
+		{time.Minute, 4 * time.Hour, false},
+		{time.Minute, -time.Hour, false},
+	} {
+		o := opts
+		o.EmergencyRetry, o.EmergencyExpire = tc.retry, tc.expire
+		_, err := NewPushover(o)
+		assert.Equal(t, tc.ok, err == nil, "retry=%s expire=%s", tc.retry, tc.expire)
+	}
+}
@@ -0,0 +1,309 @@
+// Package ratelimit wraps a provider with a token bucket which limits the rate
+// at which alerts are pushed to it. Alerts over the rate get a token reserved
+// and are returned as deferred, so the dispatch queue pushes them again once the
+// token is available instead of a worker waiting for it. Once the number of
+// deferred alerts reaches the queue size, the excess alerts are either dropped
+// or summarised in a single alert.
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// OverflowDrop drops the alerts which don't fit in the queue. They're returned
+	// as failures, so they're stored as dead letters if the store is enabled.
+	OverflowDrop = "drop"
+	// OverflowSummarise sends a single alert which summarises the alerts which
+	// don't fit in the queue.
+	OverflowSummarise = "summarise"
+
+	DefaultQueueSize = 100
+
+	// summaryPrefix is the prefix of the fingerprint of the summary alerts.
+	summaryPrefix = "ratelimit-"
+
+	// staleWait is how long the token of a deferred alert is kept after it's
+	// available. The alert is removed from the queue if it isn't pushed again in
+	// the meantime, eg because its payload was dropped.
+	staleWait = 10 * time.Minute
+)
+
+// ErrQueueFull is the error for the alerts dropped because the queue is full.
+var ErrQueueFull = errors.New("rate limit queue is full")
+
+// Provider is a rate limited provider.
+type Provider struct {
+	providers.Provider
+
+	lo        *logrus.Logger
+	metrics   *metrics.Manager
+	limiter   *rate.Limiter
+	queueSize int
+	overflow  string
+
+	mu sync.Mutex
+	// waiting has the time of the token reserved for each deferred alert, by its
+	// fingerprint.
+	waiting map[string]time.Time
+
+	// summaryMu is held while the summary is updated and sent, so it isn't
+	// resolved before it's sent.
+	summaryMu sync.Mutex
+	// summary is the last summary sent, which is resolved once the queue drains,
+	// and summarised has the number of summarised alerts for each alertname.
+	summary    *alertmgrtmpl.Alert
+	summarised map[string]int
+}
+
+type Opts struct {
+	Log     *logrus.Logger
+	Metrics *metrics.Manager
+	// Rate is the number of alerts per second and Burst is the number of alerts
+	// which can be sent at once.
+	Rate  float64
+	Burst int
+	// QueueSize is the max number of alerts waiting to be sent.
+	QueueSize int
+	// Overflow is either OverflowDrop or OverflowSummarise.
+	Overflow string
+}
+
+// New wraps the provider with a rate limiter.
+func New(prov providers.Provider, opts Opts) (*Provider, error) {
+	if opts.Rate <= 0 {
+		return nil, fmt.Errorf("rate should be greater than 0")
+	}
+	if opts.Burst < 1 {
+		opts.Burst = 1
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	switch opts.Overflow {
+	case "":
+		opts.Overflow = OverflowDrop
+	case OverflowDrop, OverflowSummarise:
+	default:
+		return nil, fmt.Errorf("unknown rate limit overflow: %s", opts.Overflow)
+	}
+
+	return &Provider{
+		Provider:  prov,
+		lo:        opts.Log,
+		metrics:   opts.Metrics,
+		limiter:   rate.NewLimiter(rate.Limit(opts.Rate), opts.Burst),
+		queueSize: opts.QueueSize,
+		overflow:  opts.Overflow,
+		waiting:   make(map[string]time.Time),
+	}, nil
+}
+
+// Push pushes the alerts which have a token to the provider one at a time. The
+// other alerts get a token reserved and are returned as failures with a
+// providers.DeferError, so they're pushed again once the token is available.
+// Deferred alerts are identified by their fingerprint.
+func (p *Provider) Push(alerts []alertmgrtmpl.Alert) error {
+	var (
+		perr     = &providers.PushError{Provider: p.ID()}
+		now      = time.Now()
+		send     []alertmgrtmpl.Alert
+		overflow []alertmgrtmpl.Alert
+	)
+
+	p.mu.Lock()
+	p.expire(now)
+	for _, a := range alerts {
+		// Alerts which were deferred use the token reserved for them.
+		if at, ok := p.waiting[a.Fingerprint]; ok {
+			if at.After(now) {
+				perr.Add(a, nil, &providers.DeferError{After: at.Sub(now)})
+				continue
+			}
+			delete(p.waiting, a.Fingerprint)
+			send = append(send, a)
+			continue
+		}
+
+		r := p.limiter.ReserveN(now, 1)
+		wait := r.DelayFrom(now)
+		switch {
+		case wait == 0:
+			send = append(send, a)
+		case len(p.waiting) < p.queueSize:
+			p.waiting[a.Fingerprint] = now.Add(wait)
+			perr.Add(a, nil, &providers.DeferError{After: wait})
+		default:
+			r.CancelAt(now)
+			overflow = append(overflow, a)
+		}
+	}
+	p.setDepth()
+	p.mu.Unlock()
+
+	for _, a := range send {
+		p.push(a, perr)
+	}
+
+	if len(overflow) > 0 {
+		p.lo.WithField("provider", p.Name()).WithField("room", p.Room()).WithField("count", len(overflow)).
+			WithField("action", p.overflow).Warn("rate limit queue is full")
+
+		if p.overflow == OverflowSummarise {
+			p.metrics.Increment(fmt.Sprintf(`rate_limit_summarised_total{provider="%s", name="%s", room="%s"}`, p.ID(), p.Name(), p.Room()))
+			p.pushSummary(overflow, perr)
+		} else {
+			for _, a := range overflow {
+				p.metrics.Increment(fmt.Sprintf(`rate_limit_dropped_total{provider="%s", name="%s", room="%s"}`, p.ID(), p.Name(), p.Room()))
+				perr.Add(a, nil, ErrQueueFull)
+			}
+		}
+	}
+
+	p.resolveSummary(perr)
+
+	return perr.OrNil()
+}
+
+// push pushes an alert to the provider and adds its failures to `perr`.
+func (p *Provider) push(a alertmgrtmpl.Alert, perr *providers.PushError) {
+	err := p.Provider.Push([]alertmgrtmpl.Alert{a})
+	if err == nil {
+		return
+	}
+
+	var e *providers.PushError
+	if !errors.As(err, &e) {
+		perr.Add(a, nil, err)
+		return
+	}
+	for _, f := range e.Failures {
+		perr.Add(f.Alert, f.Message, f.Err)
+	}
+}
+
+// expire removes the deferred alerts which weren't pushed again within staleWait
+// of their token. It must be called with the lock held.
+func (p *Provider) expire(now time.Time) {
+	for fp, at := range p.waiting {
+		if now.Sub(at) > staleWait {
+			delete(p.waiting, fp)
+		}
+	}
+}
+
+// setDepth exports the queue depth. It must be called with the lock held.
+func (p *Provider) setDepth() {
+	p.metrics.Set(fmt.Sprintf(`rate_limit_queue_depth{provider="%s", name="%s", room="%s"}`, p.ID(), p.Name(), p.Room()), float64(len(p.waiting)))
+}
+
+// pushSummary sends a summary of the alerts which didn't fit in the queue right
+// away, even though the queue is full, so they aren't lost silently. The summary
+// keeps the same fingerprint until it's resolved, so each overflow updates the
+// same incident or thread with the total number of alerts summarised.
+func (p *Provider) pushSummary(alerts []alertmgrtmpl.Alert, perr *providers.PushError) {
+	p.summaryMu.Lock()
+	defer p.summaryMu.Unlock()
+
+	if p.summary == nil {
+		s := newSummary(alerts[0], p.Name(), time.Now())
+		p.summary = &s
+		p.summarised = make(map[string]int)
+	}
+	for _, a := range alerts {
+		p.summarised[a.Labels["alertname"]]++
+	}
+	setSummary(p.summary, p.summarised)
+
+	// The summary uses a token, but doesn't wait for it.
+	p.limiter.Allow()
+	p.push(*p.summary, perr)
+}
+
+// resolveSummary sends the summary as resolved once the queue drains, so the
+// incident it opened on providers such as PagerDuty or Opsgenie is closed.
+func (p *Provider) resolveSummary(perr *providers.PushError) {
+	p.summaryMu.Lock()
+	defer p.summaryMu.Unlock()
+
+	if p.summary == nil {
+		return
+	}
+	p.mu.Lock()
+	drained := len(p.waiting) == 0
+	p.mu.Unlock()
+	if !drained {
+		return
+	}
+
+	s := *p.summary
+	s.Status = "resolved"
+	s.EndsAt = time.Now()
+	p.summary = nil
+	p.summarised = nil
+
+	p.push(s, perr)
+}
+
+// newSummary returns a copy of `a` to summarise the alerts which overflow the
+// queue, so it renders with any template. It's firing and has its own fingerprint,
+// so providers which dedupe or thread by the fingerprint (eg PagerDuty, Opsgenie)
+// don't update or resolve the incident of `a`.
+func newSummary(a alertmgrtmpl.Alert, name string, now time.Time) alertmgrtmpl.Alert {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s-%d", name, now.UnixNano())
+
+	a.Fingerprint = summaryPrefix + hex.EncodeToString(h.Sum(nil))[:16]
+	a.Status = "firing"
+	a.StartsAt = now
+	a.EndsAt = time.Time{}
+
+	return a
+}
+
+// setSummary replaces the summary and description of the summary alert with the
+// number of alerts summarised for each alertname.
+func setSummary(s *alertmgrtmpl.Alert, names map[string]int) {
+	var (
+		total  int
+		counts = make([]string, 0, len(names))
+	)
+	for name, n := range names {
+		total += n
+		if name == "" {
+			name = "unnamed"
+		}
+		counts = append(counts, fmt.Sprintf("%s (%d)", name, n))
+	}
+	sort.Strings(counts)
+
+	annotations := make(alertmgrtmpl.KV, len(s.Annotations)+2)
+	for k, v := range s.Annotations {
+		annotations[k] = v
+	}
+	annotations["summary"] = fmt.Sprintf("%d alerts were not sent individually due to rate limiting", total)
+	annotations["description"] = "Alerts: " + strings.Join(counts, ", ")
+	s.Annotations = annotations
+}
+
+// Close closes the wrapped provider, if it has a connection to close.
+func (p *Provider) Close() error {
+	if c, ok := p.Provider.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
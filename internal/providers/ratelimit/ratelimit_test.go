@@ -0,0 +1,188 @@
+package ratelimit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct {
+	pushed []alertmgrtmpl.Alert
+}
+
+func (f *fakeProvider) ID() string   { return "google_chat" }
+func (f *fakeProvider) Name() string { return "prod" }
+func (f *fakeProvider) Room() string { return "prod" }
+
+func (f *fakeProvider) Push(alerts []alertmgrtmpl.Alert) error {
+	f.pushed = append(f.pushed, alerts...)
+	return nil
+}
+
+// closingProvider has a connection to close.
+type closingProvider struct {
+	fakeProvider
+	closed bool
+}
+
+func (f *closingProvider) Close() error {
+	f.closed = true
+	return nil
+}
+
+func newAlerts(names ...string) []alertmgrtmpl.Alert {
+	var out []alertmgrtmpl.Alert
+	for i, n := range names {
+		out = append(out, alertmgrtmpl.Alert{
+			Status:      "firing",
+			Fingerprint: fmt.Sprintf("%s%d", n, i),
+			Labels:      alertmgrtmpl.KV{"alertname": n},
+			Annotations: alertmgrtmpl.KV{"summary": n + " is firing"},
+		})
+	}
+	return out
+}
+
+func TestPushRate(t *testing.T) {
+	var (
+		fake = &fakeProvider{}
+		m    = metrics.New("calert")
+	)
+	p, err := New(fake, Opts{Log: logrus.New(), Metrics: m, Rate: 10, Burst: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first alert uses the burst and the rest are deferred until their token,
+	// without waiting for it.
+	alerts := newAlerts("a", "b", "c")
+	now := time.Now()
+	err = p.Push(alerts)
+	assert.Less(t, time.Since(now), 90*time.Millisecond)
+	assert.Len(t, fake.pushed, 1)
+
+	var perr *providers.PushError
+	if assert.ErrorAs(t, err, &perr) && assert.Equal(t, 2, perr.Failed) {
+		var de *providers.DeferError
+		assert.ErrorAs(t, perr.Failures[0].Err, &de)
+		assert.InDelta(t, 100*time.Millisecond, de.After, float64(10*time.Millisecond))
+		assert.ErrorAs(t, perr.Failures[1].Err, &de)
+		assert.InDelta(t, 200*time.Millisecond, de.After, float64(10*time.Millisecond))
+	}
+
+	var buf bytes.Buffer
+	m.FlushMetrics(&buf)
+	assert.Contains(t, buf.String(), `calert_rate_limit_queue_depth{provider="google_chat", name="prod", room="prod"} 2`)
+
+	// The deferred alerts are sent with their reserved tokens once they're available.
+	time.Sleep(110 * time.Millisecond)
+	err = p.Push(alerts[1:])
+	assert.Len(t, fake.pushed, 2)
+	if assert.ErrorAs(t, err, &perr) {
+		assert.Equal(t, 1, perr.Failed)
+		assert.Equal(t, "c", perr.Failures[0].Alert.Labels["alertname"])
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, p.Push(alerts[2:]))
+	assert.Len(t, fake.pushed, 3)
+
+	buf.Reset()
+	m.FlushMetrics(&buf)
+	assert.Contains(t, buf.String(), `calert_rate_limit_queue_depth{provider="google_chat", name="prod", room="prod"} 0`)
+}
+
+func TestPushOverflow(t *testing.T) {
+	fake := &fakeProvider{}
+	p, err := New(fake, Opts{Log: logrus.New(), Metrics: metrics.New("calert"), Rate: 1, QueueSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Alerts which don't fit in the queue are dropped and returned as failures.
+	err = p.Push(newAlerts("a", "b", "c", "d", "d"))
+	assert.Len(t, fake.pushed, 1)
+	var perr *providers.PushError
+	if assert.ErrorAs(t, err, &perr) && assert.Equal(t, 4, perr.Failed) {
+		var de *providers.DeferError
+		assert.ErrorAs(t, perr.Failures[0].Err, &de)
+		assert.Equal(t, "b", perr.Failures[0].Alert.Labels["alertname"])
+		assert.True(t, errors.Is(perr.Failures[2].Err, ErrQueueFull))
+		assert.Equal(t, "d", perr.Failures[2].Alert.Labels["alertname"])
+	}
+
+	_, err = New(fake, Opts{Rate: 1, Overflow: "block"})
+	assert.Error(t, err)
+}
+
+func TestPushSummary(t *testing.T) {
+	fake := &fakeProvider{}
+	p, err := New(fake, Opts{Log: logrus.New(), Metrics: metrics.New("calert"), Rate: 20, QueueSize: 1, Overflow: OverflowSummarise})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The alerts which don't fit in the queue are summarised in a single alert.
+	alerts := newAlerts("a", "b", "c", "d", "d")
+	alerts[2].Status = "resolved"
+	alerts[2].EndsAt = time.Now()
+	assert.Error(t, p.Push(alerts))
+	if !assert.Len(t, fake.pushed, 2) {
+		return
+	}
+	s := fake.pushed[1]
+	assert.Equal(t, "c", s.Labels["alertname"])
+	assert.Equal(t, "3 alerts were not sent individually due to rate limiting", s.Annotations["summary"])
+	assert.Equal(t, "Alerts: c (1), d (2)", s.Annotations["description"])
+
+	// The summary doesn't update or resolve the incident of the first alert it summarises.
+	assert.Equal(t, "firing", s.Status)
+	assert.True(t, s.EndsAt.IsZero())
+	assert.True(t, strings.HasPrefix(s.Fingerprint, summaryPrefix))
+	assert.Equal(t, "c2", alerts[2].Fingerprint, "the original alert isn't modified")
+	assert.Equal(t, "resolved", alerts[2].Status)
+
+	// Another overflow updates the same summary.
+	assert.NoError(t, p.Push(newAlerts("e")))
+	if assert.Len(t, fake.pushed, 3) {
+		assert.Equal(t, s.Fingerprint, fake.pushed[2].Fingerprint)
+		assert.Equal(t, "Alerts: c (1), d (2), e (1)", fake.pushed[2].Annotations["description"])
+	}
+
+	// The summary is resolved once the deferred alert is sent.
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, p.Push(alerts[1:2]))
+	if assert.Len(t, fake.pushed, 5) {
+		assert.Equal(t, "b", fake.pushed[3].Labels["alertname"])
+		r := fake.pushed[4]
+		assert.Equal(t, s.Fingerprint, r.Fingerprint)
+		assert.Equal(t, "resolved", r.Status)
+		assert.False(t, r.EndsAt.IsZero())
+	}
+}
+
+func TestClose(t *testing.T) {
+	fake := &closingProvider{}
+	p, err := New(fake, Opts{Log: logrus.New(), Metrics: metrics.New("calert"), Rate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, p.Close())
+	assert.True(t, fake.closed)
+
+	// Providers without a connection are skipped.
+	p, err = New(&fakeProvider{}, Opts{Log: logrus.New(), Metrics: metrics.New("calert"), Rate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, p.Close())
+}
@@ -0,0 +1,235 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryMinBackoff  = 500 * time.Millisecond
+	DefaultRetryMaxBackoff  = 30 * time.Second
+)
+
+// RetryPolicy configures how many times a message is sent and how long
+// to wait between the attempts.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one.
+	// 1 disables retries.
+	MaxAttempts int
+	// The backoff starts at MinBackoff and doubles after every attempt up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Stop is closed on shutdown to abandon the waits between the attempts.
+	Stop <-chan struct{}
+}
+
+// Retrier retries sending a message on errors which may go away on their own:
+// 429 and 5xx responses, transient SMTP replies and network errors.
+type Retrier struct {
+	policy   RetryPolicy
+	lo       *logrus.Logger
+	metrics  *metrics.Manager
+	provider string
+	name     string
+	room     string
+
+	// sleep waits between the attempts and returns false if the retries were
+	// stopped. It's swapped in tests.
+	sleep func(time.Duration) bool
+}
+
+// NewRetrier initialises a Retrier for a provider. Zero values in the policy
+// are replaced with the defaults.
+func NewRetrier(policy RetryPolicy, lo *logrus.Logger, metrics *metrics.Manager, provider, name, room string) *Retrier {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if policy.MinBackoff <= 0 {
+		policy.MinBackoff = DefaultRetryMinBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	if policy.MaxBackoff < policy.MinBackoff {
+		policy.MaxBackoff = policy.MinBackoff
+	}
+
+	r := &Retrier{
+		policy:   policy,
+		lo:       lo,
+		metrics:  metrics,
+		provider: provider,
+		name:     name,
+		room:     room,
+	}
+	r.sleep = r.wait
+
+	return r
+}
+
+// Do calls `send` until it succeeds, returns an error which can't be retried or
+// the attempts run out. The wait between the attempts is an exponential backoff with
+// jitter, or the `Retry-After` of the response if the provider sent one, capped at
+// the max backoff. The last error is returned right away if the retries are stopped,
+// with Stopped set. Errors are returned as a RetryError with the number of attempts made.
+func (r *Retrier) Do(send func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil {
+			return nil
+		}
+
+		ok, retryAfter := Retryable(err)
+		if !ok {
+			return &RetryError{Attempts: attempt, Err: err}
+		}
+		if attempt >= r.policy.MaxAttempts {
+			r.metrics.Increment(fmt.Sprintf(`alerts_dispatch_retries_exhausted_total{provider="%s", name="%s", room="%s"}`, r.provider, r.name, r.room))
+			return &RetryError{Attempts: attempt, Err: err}
+		}
+
+		wait := retryAfter
+		if wait == 0 {
+			wait = r.backoff(attempt)
+		}
+		if wait > r.policy.MaxBackoff {
+			wait = r.policy.MaxBackoff
+		}
+
+		r.lo.WithError(err).WithField("provider", r.name).WithField("room", r.room).
+			WithField("attempt", attempt).WithField("wait", wait).Warn("retrying message")
+		r.metrics.Increment(fmt.Sprintf(`alerts_dispatch_retries_total{provider="%s", name="%s", room="%s"}`, r.provider, r.name, r.room))
+		if !r.sleep(wait) {
+			return &RetryError{Attempts: attempt, Err: err, Stopped: true}
+		}
+	}
+}
+
+// wait sleeps for `d` and returns false if the retries are stopped in the meantime.
+func (r *Retrier) wait(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-r.policy.Stop:
+		return false
+	}
+}
+
+// RetryError is returned by Retrier.Do with the number of attempts made.
+type RetryError struct {
+	Attempts int
+	Err      error
+	// Stopped is true if the retries were abandoned on shutdown.
+	Stopped bool
+}
+
+func (e *RetryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// Attempts returns the number of attempts made to send a message
+// which failed with `err`.
+func Attempts(err error) int {
+	var re *RetryError
+	if errors.As(err, &re) {
+		return re.Attempts
+	}
+	return 1
+}
+
+// Stopped returns true if the message which failed with `err` wasn't retried
+// because of a shutdown, so it should be sent again once calert restarts.
+func Stopped(err error) bool {
+	var re *RetryError
+	return errors.As(err, &re) && re.Stopped
+}
+
+// backoff returns the wait after the nth attempt. It's a random duration
+// between half and the whole of the exponential backoff.
+func (r *Retrier) backoff(attempt int) time.Duration {
+	d := r.policy.MinBackoff
+	for i := 1; i < attempt && d < r.policy.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.policy.MaxBackoff {
+		d = r.policy.MaxBackoff
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Retryable returns true if the error is a 429 or 5xx response, a transient (4xx) SMTP reply,
+// a timeout or a network error, along with the `Retry-After` of the response, if any.
+func Retryable(err error) (bool, time.Duration) {
+	var se *StatusError
+	if errors.As(err, &se) {
+		if se.StatusCode == http.StatusTooManyRequests || se.StatusCode >= 500 {
+			return true, se.RetryAfter
+		}
+		return false, 0
+	}
+
+	// SMTP servers reply with 4xx codes for transient failures, such as greylisting.
+	var te *textproto.Error
+	if errors.As(err, &te) {
+		return te.Code >= 400 && te.Code < 500, 0
+	}
+
+	// Only timeouts and errors from the connection (eg refused or reset) are retried.
+	// The HTTP client wraps every error in a `*url.Error`, including the ones which
+	// fail the same way on each attempt, such as invalid URLs or TLS certificates.
+	var (
+		ne net.Error
+		de *net.DNSError
+		oe *net.OpError
+	)
+	switch {
+	case errors.As(err, &ne) && ne.Timeout():
+		return true, 0
+	case errors.As(err, &de):
+		return de.IsTemporary, 0
+	case errors.As(err, &oe):
+		return true, 0
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		return true, 0
+	}
+
+	return false, 0
+}
+
+// parseRetryAfter parses the `Retry-After` header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
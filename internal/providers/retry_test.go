@@ -0,0 +1,147 @@
+package providers
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRetrier(policy RetryPolicy) (*Retrier, *[]time.Duration) {
+	var waits []time.Duration
+	r := NewRetrier(policy, logrus.New(), metrics.New("calert"), "webhook", "qa", "qa")
+	r.sleep = func(d time.Duration) bool {
+		waits = append(waits, d)
+		return true
+	}
+	return r, &waits
+}
+
+func TestRetrierDo(t *testing.T) {
+	// Retryable errors are retried until the send succeeds.
+	r, waits := newTestRetrier(RetryPolicy{MaxAttempts: 5, MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+	calls := 0
+	err := r.Do(func() error {
+		calls++
+		if calls < 4 {
+			return &StatusError{StatusCode: http.StatusBadGateway}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, calls)
+	if assert.Len(t, *waits, 3) {
+		// Exponential backoff with jitter between half and the whole of the backoff.
+		for i, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+			assert.GreaterOrEqual(t, (*waits)[i], max/2)
+			assert.LessOrEqual(t, (*waits)[i], max)
+		}
+	}
+
+	// Errors which can't be retried are returned right away.
+	r, waits = newTestRetrier(RetryPolicy{MaxAttempts: 5})
+	calls = 0
+	err = r.Do(func() error {
+		calls++
+		return &StatusError{StatusCode: http.StatusBadRequest}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 1, Attempts(err))
+	assert.Empty(t, *waits)
+
+	// The last error is returned once the attempts run out.
+	r, waits = newTestRetrier(RetryPolicy{MaxAttempts: 3, MinBackoff: time.Second, MaxBackoff: 10 * time.Second})
+	calls = 0
+	err = r.Do(func() error {
+		calls++
+		return &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 5 * time.Second}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 3, Attempts(err))
+	// Retry-After is honoured instead of the backoff.
+	assert.Equal(t, []time.Duration{5 * time.Second, 5 * time.Second}, *waits)
+
+	// Retry-After is capped at the max backoff.
+	r, waits = newTestRetrier(RetryPolicy{MaxAttempts: 3, MaxBackoff: time.Second})
+	calls = 0
+	r.Do(func() error {
+		calls++
+		return &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute}
+	})
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []time.Duration{time.Second, time.Second}, *waits)
+}
+
+func TestRetrierStop(t *testing.T) {
+	stop := make(chan struct{})
+	r := NewRetrier(RetryPolicy{MaxAttempts: 5, MinBackoff: time.Hour, MaxBackoff: time.Hour, Stop: stop},
+		logrus.New(), metrics.New("calert"), "webhook", "qa", "qa")
+
+	calls := 0
+	done := make(chan error)
+	go func() {
+		done <- r.Do(func() error {
+			calls++
+			return &StatusError{StatusCode: http.StatusBadGateway}
+		})
+	}()
+	close(stop)
+
+	select {
+	case err := <-done:
+		// The last error is returned without waiting for the backoff.
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, 1, Attempts(err))
+		assert.True(t, Stopped(err))
+	case <-time.After(5 * time.Second):
+		t.Fatal("retries weren't stopped")
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		err error
+		ok  bool
+	}{
+		{&StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{&StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&StatusError{StatusCode: http.StatusNotFound}, false},
+		{&PushError{Err: &StatusError{StatusCode: http.StatusInternalServerError}}, true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{&url.Error{Op: "Post", Err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}}, true},
+		{&url.Error{Op: "Post", Err: context.DeadlineExceeded}, true},
+		{&url.Error{Op: "Post", Err: io.EOF}, true},
+		{&url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}}, false},
+		{&url.Error{Op: "Post", Err: x509.UnknownAuthorityError{}}, false},
+		{&url.Error{Op: "Post", Err: errors.New("unsupported protocol scheme")}, false},
+		{&textproto.Error{Code: 451, Msg: "greylisted, try again later"}, true},
+		{&textproto.Error{Code: 550, Msg: "mailbox unavailable"}, false},
+		{errors.New("error from slack: invalid_auth"), false},
+	} {
+		ok, _ := Retryable(tc.err)
+		assert.Equal(t, tc.ok, ok, tc.err.Error())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+}
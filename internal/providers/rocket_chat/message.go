@@ -0,0 +1,53 @@
+package rocket_chat
+
+import (
+	"errors"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers/slack_compat"
+)
+
+// Message represents the payload accepted by both incoming webhooks and the
+// `chat.postMessage` method. `channel` and `tmid` are only used by the latter.
+// https://developer.rocket.chat/reference/api/rest-api/endpoints/messaging/chat-endpoints/postmessage
+type Message = slack_compat.Message
+
+type postMessageResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+	Message struct {
+		ID string `json:"_id"`
+	} `json:"message"`
+}
+
+// prepareMessage renders the alert as an attachment, threaded under `tmid` in token mode.
+func (m *RocketChatManager) prepareMessage(alert alertmgrtmpl.Alert, tmid string) (Message, error) {
+	msg, err := slack_compat.Render(m.msgTmpl, alert, slack_compat.StyleAttachment)
+	if err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return Message{}, err
+	}
+	msg.Alias = m.alias
+	msg.Avatar = m.avatar
+
+	// Incoming webhooks don't return the ID of the message, so they can't be threaded.
+	if m.token != "" {
+		msg.Channel = m.channel
+		msg.TMID = tmid
+	}
+
+	return msg, nil
+}
+
+// sendMessage sends the message to Rocket.Chat. In token mode, it returns the ID of the message.
+func (m *RocketChatManager) sendMessage(msg Message) (string, error) {
+	var r postMessageResponse
+	if err := m.client.Post(msg, &r); err != nil {
+		return "", err
+	}
+	if !r.Success {
+		return "", errors.New("error from rocket.chat: " + r.Error)
+	}
+
+	return r.Message.ID, nil
+}
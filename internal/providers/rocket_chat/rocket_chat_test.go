@@ -0,0 +1,66 @@
+package rocket_chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRocketChatThreading(t *testing.T) {
+	var received []Message
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/chat.postMessage", r.URL.Path)
+		assert.Equal(t, "test-token", r.Header.Get("X-Auth-Token"))
+		assert.Equal(t, "user1", r.Header.Get("X-User-Id"))
+
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, msg)
+
+		w.Write([]byte(`{"success":true,"message":{"_id":"msg1"}}`))
+	}))
+	defer srv.Close()
+
+	rc, err := NewRocketChat(RocketChatOpts{
+		Log:      logrus.New(),
+		Metrics:  metrics.New("calert"),
+		Endpoint: srv.URL,
+		Token:    "test-token",
+		UserID:   "user1",
+		Channel:  "#alerts",
+		Room:     "qa",
+		Template: "../../../static/message.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "critical", "alertname": "TestAlert",
+		}),
+		Fingerprint: "1a956348d0570965",
+	}
+	resolved := alert
+	resolved.Status = "resolved"
+
+	if err := rc.Push([]alertmgrtmpl.Alert{alert, resolved}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, received, 2)
+	assert.Equal(t, "#alerts", received[0].Channel)
+	assert.Empty(t, received[0].TMID)
+	assert.Equal(t, "#E01E5A", received[0].Attachments[0].Color)
+	assert.Equal(t, "msg1", received[1].TMID)
+}
@@ -0,0 +1,60 @@
+package slack
+
+import (
+	"errors"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers/slack_compat"
+)
+
+// Message represents the payload accepted by both incoming webhooks
+// and the `chat.postMessage` method.
+type Message = slack_compat.Message
+
+// postMessageResponse represents the response of `chat.postMessage`.
+type postMessageResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	TS    string `json:"ts"`
+}
+
+// prepareMessage accepts an Alert object and templates out with the user provided template.
+// If `blocks` is enabled, the template is expected to render a JSON object with
+// `text` and `blocks` (Block Kit) fields.
+func (m *SlackManager) prepareMessage(alert alertmgrtmpl.Alert, threadTS string) (Message, error) {
+	style := slack_compat.StyleText
+	if m.blocks {
+		style = slack_compat.StyleBlocks
+	}
+
+	msg, err := slack_compat.Render(m.msgTmpl, alert, style)
+	if err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return msg, err
+	}
+
+	msg.Channel = m.channel
+	msg.ThreadTS = threadTS
+
+	return msg, nil
+}
+
+// sendMessage pushes out a notification to Slack. In bot token mode,
+// it returns the `ts` of the posted message.
+func (m *SlackManager) sendMessage(msg Message) (string, error) {
+	// Incoming webhooks respond with a plain `ok` and don't return the message `ts`.
+	if m.token == "" {
+		return "", m.client.Post(msg, nil)
+	}
+
+	// Web API responds with 200 even for failures, so check the `ok` field.
+	var r postMessageResponse
+	if err := m.client.Post(msg, &r); err != nil {
+		return "", err
+	}
+	if !r.OK {
+		return "", errors.New("error from slack: " + r.Error)
+	}
+
+	return r.TS, nil
+}
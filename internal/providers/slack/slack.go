@@ -0,0 +1,185 @@
+package slack
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/shpeliving/calert/internal/providers/slack_compat"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultAPIURL is the Web API used when a bot token is configured.
+	defaultAPIURL = "https://slack.com/api"
+)
+
+type SlackManager struct {
+	lo           *logrus.Logger
+	metrics      *metrics.Manager
+	activeAlerts *providers.ActiveAlerts
+	token        string
+	channel      string
+	name         string
+	room         string
+	client       *slack_compat.Client
+	retry        *providers.Retrier
+	msgTmpl      *template.Template
+	dryRun       bool
+	blocks       bool
+}
+
+type SlackOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	// Endpoint is the incoming webhook URL. It's ignored if Token is set.
+	Endpoint string
+	// Token is a bot token used to post messages with `chat.postMessage`.
+	Token string
+	// APIURL is the Web API used with Token. Defaults to https://slack.com/api.
+	APIURL string
+	// Channel is the channel ID to post to. Required if Token is set.
+	Channel string
+	// Name is the unique name of the provider in the config.
+	Name      string
+	Room      string
+	Template  string
+	ThreadTTL time.Duration
+	Blocks    bool
+}
+
+// NewSlack initializes a Slack provider object.
+func NewSlack(opts SlackOpts) (*SlackManager, error) {
+	if opts.Token == "" && opts.Endpoint == "" {
+		return nil, fmt.Errorf("either endpoint or token is required")
+	}
+	if opts.Token != "" && opts.Channel == "" {
+		return nil, fmt.Errorf("channel is required when using a bot token")
+	}
+
+	// Initialise a generic HTTP Client for communicating with the Slack APIs.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the template.
+	tmpl, err := providers.LoadTemplate(opts.Template, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, header := opts.Endpoint, http.Header{}
+	if opts.Token != "" {
+		if opts.APIURL == "" {
+			opts.APIURL = defaultAPIURL
+		}
+		endpoint = strings.TrimSuffix(opts.APIURL, "/") + "/chat.postMessage"
+		header.Set("Authorization", "Bearer "+opts.Token)
+	}
+
+	mgr := &SlackManager{
+		lo:      opts.Log,
+		metrics: opts.Metrics,
+		retry:   providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "slack", opts.Name, opts.Room),
+		client: slack_compat.NewClient(slack_compat.ClientOpts{
+			Log:      opts.Log,
+			Client:   client,
+			Provider: "slack",
+			Endpoint: endpoint,
+			Header:   header,
+		}),
+		token:        opts.Token,
+		channel:      opts.Channel,
+		name:         opts.Name,
+		room:         opts.Room,
+		activeAlerts: providers.NewActiveAlerts(opts.Log, opts.Metrics),
+		msgTmpl:      tmpl,
+		dryRun:       opts.DryRun,
+		blocks:       opts.Blocks,
+	}
+	// Start a background worker to cleanup alerts based on TTL mechanism.
+	go mgr.activeAlerts.StartPruneWorker(1*time.Hour, opts.ThreadTTL)
+
+	return mgr, nil
+}
+
+// Push accepts the list of alerts and dispatches them to Slack.
+func (m *SlackManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to slack")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		// If it's a new alert whose fingerprint isn't in the active alerts map, add it first.
+		details, err := m.activeAlerts.GetOrAdd(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error adding active alert")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		// The `ts` of the first message for this alert (if any) is used as the thread parent.
+		msg, err := m.prepareMessage(a, details.MessageID)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Send message to API.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			var ts string
+			err := m.retry.Do(func() (err error) {
+				ts, err = m.sendMessage(msg)
+				return err
+			})
+			if err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				perr.Add(a, msg, err)
+				continue
+			}
+
+			// Store the `ts` of the first message so that all the future updates are threaded under it.
+			if details.MessageID == "" && ts != "" {
+				m.activeAlerts.SetMessageID(a.Fingerprint, ts)
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *SlackManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *SlackManager) ID() string {
+	return "slack"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *SlackManager) Name() string {
+	return m.name
+}
@@ -0,0 +1,105 @@
+package slack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+var testAlert = alertmgrtmpl.Alert{
+	Status: "firing",
+	Labels: alertmgrtmpl.KV(map[string]string{
+		"severity": "high", "alertname": "TestAlert",
+	}),
+	Annotations: alertmgrtmpl.KV(map[string]string{
+		"team": "qa", "dryrun": "true",
+	}),
+	Fingerprint: "1a956348d0570965",
+}
+
+func TestSlackTemplate(t *testing.T) {
+	opts := SlackOpts{
+		Log:      logrus.New(),
+		Endpoint: "http://",
+		Room:     "qa",
+		Template: "../../../static/message.tmpl",
+		DryRun:   true,
+	}
+
+	slack, err := NewSlack(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := slack.prepareMessage(testAlert, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "*(HIGH) TestAlert - Firing*\nDryrun: true\nTeam: qa\n", msg.Text)
+	assert.Empty(t, msg.Blocks)
+
+	// Block Kit template.
+	opts.Template = "../../../static/slack_blocks.tmpl"
+	opts.Blocks = true
+	slack, err = NewSlack(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = slack.prepareMessage(testAlert, "1503435956.000247")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "(HIGH) TestAlert - Firing", msg.Text)
+	assert.Len(t, msg.Blocks, 2)
+	assert.Equal(t, "1503435956.000247", msg.ThreadTS)
+}
+
+func TestSlackThreading(t *testing.T) {
+	var received []Message
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat.postMessage", r.URL.Path)
+		assert.Equal(t, "Bearer xoxb-test", r.Header.Get("Authorization"))
+
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, msg)
+
+		w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1503435956.000247"}`))
+	}))
+	defer srv.Close()
+
+	slack, err := NewSlack(SlackOpts{
+		Log:      logrus.New(),
+		Metrics:  metrics.New("calert"),
+		Token:    "xoxb-test",
+		APIURL:   srv.URL,
+		Channel:  "C123",
+		Room:     "qa",
+		Template: "../../../static/message.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved := testAlert
+	resolved.Status = "resolved"
+
+	if err := slack.Push([]alertmgrtmpl.Alert{testAlert, resolved}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, received, 2)
+	assert.Equal(t, "C123", received[0].Channel)
+	assert.Empty(t, received[0].ThreadTS)
+	assert.Equal(t, "1503435956.000247", received[1].ThreadTS)
+}
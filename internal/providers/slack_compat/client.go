@@ -0,0 +1,79 @@
+package slack_compat
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+// Client posts messages to a Slack-compatible endpoint.
+type Client struct {
+	lo       *logrus.Logger
+	client   *http.Client
+	provider string
+	endpoint string
+	header   http.Header
+}
+
+type ClientOpts struct {
+	Log    *logrus.Logger
+	Client *http.Client
+	// Provider is the ID of the provider, used in the errors.
+	Provider string
+	Endpoint string
+	// Header is added to every request, eg for authentication.
+	Header http.Header
+}
+
+// NewClient initializes a client for posting messages to `opts.Endpoint`.
+func NewClient(opts ClientOpts) *Client {
+	return &Client{
+		lo:       opts.Log,
+		client:   opts.Client,
+		provider: opts.Provider,
+		endpoint: opts.Endpoint,
+		header:   opts.Header,
+	}
+}
+
+// Post sends the payload as JSON and decodes the response into `out`, unless
+// it's nil. Responses other than `200 OK` and `201 Created` are returned as a
+// providers.StatusError.
+func (c *Client) Post(payload interface{}, out interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	// Prepare the request.
+	req, err := http.NewRequest("POST", c.endpoint, bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	// Send the request.
+	c.lo.WithField("msg", payload).Debug("sending alert")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// REST APIs may respond with `201 Created` and webhooks respond with `200 OK`.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		c.lo.WithField("status", resp.StatusCode).WithField("provider", c.provider).Error("Non OK HTTP Response received from endpoint")
+		return providers.NewStatusError(c.provider, resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,79 @@
+package slack_compat
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+)
+
+const (
+	// maxTextSize is the maximum length of the `text` field accepted by Slack.
+	maxTextSize = 40000
+)
+
+// Style is how the rendered template is put in the message.
+type Style int
+
+const (
+	// StyleText uses the rendered template as the `text` of the message.
+	StyleText Style = iota
+	// StyleBlocks expects the template to render a JSON object with `text`
+	// and `blocks` (Slack Block Kit) fields.
+	StyleBlocks
+	// StyleAttachment puts the rendered template in a colour-coded attachment.
+	StyleAttachment
+)
+
+// Message represents the Slack-compatible payload. The fields which
+// are only used by some of the providers are left empty by the others.
+// https://api.slack.com/methods/chat.postMessage
+type Message struct {
+	Channel     string            `json:"channel,omitempty"`
+	Text        string            `json:"text,omitempty"`
+	Blocks      []json.RawMessage `json:"blocks,omitempty"`
+	Attachments []Attachment      `json:"attachments,omitempty"`
+	// ThreadTS is the parent message in Slack.
+	ThreadTS string `json:"thread_ts,omitempty"`
+	// TMID is the parent message in Rocket.Chat.
+	TMID string `json:"tmid,omitempty"`
+	// Username and IconURL override the sender of Mattermost webhooks.
+	Username string `json:"username,omitempty"`
+	IconURL  string `json:"icon_url,omitempty"`
+	// Alias and Avatar override the sender in Rocket.Chat.
+	Alias  string `json:"alias,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+// Render renders the template with the alert data into a message as per `style`.
+func Render(tmpl *template.Template, alert alertmgrtmpl.Alert, style Style) (Message, error) {
+	var (
+		to  bytes.Buffer
+		msg Message
+	)
+
+	// Render a template with alert data.
+	if err := tmpl.Execute(&to, alert); err != nil {
+		return msg, err
+	}
+
+	switch style {
+	case StyleBlocks:
+		if err := json.Unmarshal(to.Bytes(), &msg); err != nil {
+			return msg, err
+		}
+	case StyleAttachment:
+		msg.Attachments = []Attachment{NewAttachment(alert, to.String())}
+	default:
+		msg.Text = to.String()
+	}
+
+	// Slack truncates messages beyond the limit, so trim them here to keep the payload small.
+	if len(msg.Text) > maxTextSize {
+		msg.Text = strings.ToValidUTF8(msg.Text[:maxTextSize], "")
+	}
+
+	return msg, nil
+}
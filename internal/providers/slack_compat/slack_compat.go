@@ -0,0 +1,81 @@
+// Package slack_compat contains the Slack-compatible message payload, along with
+// rendering it from a template and posting it, shared by the Slack, Mattermost and
+// Rocket.Chat providers. The payload is accepted by all of them with small
+// differences, such as the field used for threading.
+package slack_compat
+
+import (
+	"strings"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+)
+
+// Colours used for the attachment based on the alert's `severity` label.
+var severityColors = map[string]string{
+	"critical": "#E01E5A",
+	"high":     "#E01E5A",
+	"warning":  "#FFA500",
+	"info":     "#3498DB",
+}
+
+const (
+	colorResolved = "#2EB67D"
+	colorDefault  = "#95A5A6"
+)
+
+// Field is a short key/value pair shown in a table inside the attachment.
+type Field struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// Attachment represents a Slack-style (legacy) message attachment.
+// https://developers.mattermost.com/integrate/reference/message-attachments/
+// https://developer.rocket.chat/reference/api/rest-api/endpoints/messaging/chat-endpoints/postmessage#attachments-detail
+type Attachment struct {
+	Fallback  string  `json:"fallback"`
+	Color     string  `json:"color"`
+	Title     string  `json:"title"`
+	TitleLink string  `json:"title_link,omitempty"`
+	Text      string  `json:"text"`
+	Fields    []Field `json:"fields,omitempty"`
+}
+
+// NewAttachment builds a colour-coded attachment for an alert. `text` is the rendered
+// template and the labels of the alert are added as short fields.
+func NewAttachment(alert alertmgrtmpl.Alert, text string) Attachment {
+	title := alert.Labels["alertname"] + " - " + strings.Title(alert.Status)
+
+	att := Attachment{
+		Fallback:  title,
+		Color:     Color(alert),
+		Title:     title,
+		TitleLink: alert.GeneratorURL,
+		Text:      text,
+	}
+
+	for _, p := range alert.Labels.SortedPairs() {
+		if p.Name == "alertname" {
+			continue
+		}
+		att.Fields = append(att.Fields, Field{
+			Title: p.Name,
+			Value: p.Value,
+			Short: true,
+		})
+	}
+
+	return att
+}
+
+// Color returns the attachment colour for an alert.
+func Color(alert alertmgrtmpl.Alert) string {
+	if alert.Status == "resolved" {
+		return colorResolved
+	}
+	if c, ok := severityColors[strings.ToLower(alert.Labels["severity"])]; ok {
+		return c
+	}
+	return colorDefault
+}
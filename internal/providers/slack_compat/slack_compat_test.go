@@ -0,0 +1,52 @@
+package slack_compat
+
+import (
+	"strings"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	tmpl, err := providers.NewTemplate("message", "{{ .Labels.alertname }}: {{ .Annotations.summary }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status:       "firing",
+		Labels:       alertmgrtmpl.KV{"alertname": "TestAlert", "severity": "warning"},
+		Annotations:  alertmgrtmpl.KV{"summary": "disk is full"},
+		GeneratorURL: "http://prometheus:9090/graph",
+	}
+
+	msg, err := Render(tmpl, alert, StyleText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "TestAlert: disk is full", msg.Text)
+	assert.Empty(t, msg.Attachments)
+
+	msg, err = Render(tmpl, alert, StyleAttachment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, msg.Text)
+	if assert.Len(t, msg.Attachments, 1) {
+		att := msg.Attachments[0]
+		assert.Equal(t, "TestAlert - Firing", att.Title)
+		assert.Equal(t, "#FFA500", att.Color)
+		assert.Equal(t, "TestAlert: disk is full", att.Text)
+		assert.Equal(t, []Field{{Title: "severity", Value: "warning", Short: true}}, att.Fields)
+	}
+
+	// Text over the limit is truncated.
+	alert.Annotations = alertmgrtmpl.KV{"summary": strings.Repeat("a", maxTextSize)}
+	msg, err = Render(tmpl, alert, StyleText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, msg.Text, maxTextSize)
+}
@@ -0,0 +1,81 @@
+package syslog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+)
+
+// maxJournalFieldSize is the max length of a journal field name.
+const maxJournalFieldSize = 64
+
+// prepareJournalMessage formats a message in the journald native protocol, with
+// the alert status, fingerprint and labels as separate fields so they can be
+// matched with `journalctl`, eg `journalctl ALERT_LABEL_ALERTNAME=HighLatency`.
+// https://systemd.io/JOURNAL_NATIVE_PROTOCOL/
+func (m *SyslogManager) prepareJournalMessage(alert alertmgrtmpl.Alert) ([]byte, error) {
+	var (
+		b   bytes.Buffer
+		msg bytes.Buffer
+	)
+
+	// Render the template with alert data.
+	if err := m.msgTmpl.Execute(&msg, alert); err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return nil, err
+	}
+
+	journalField(&b, "MESSAGE", strings.TrimSpace(msg.String()))
+	journalField(&b, "PRIORITY", strconv.Itoa(severity(alert)))
+	journalField(&b, "SYSLOG_FACILITY", strconv.Itoa(m.facility))
+	journalField(&b, "SYSLOG_IDENTIFIER", m.appName)
+	journalField(&b, "ALERT_STATUS", alert.Status)
+	journalField(&b, "ALERT_FINGERPRINT", alert.Fingerprint)
+	journalField(&b, "ALERT_STARTS_AT", alert.StartsAt.UTC().Format(time.RFC3339))
+	for _, p := range alert.Labels.SortedPairs() {
+		journalField(&b, journalFieldName("ALERT_LABEL_"+p.Name), p.Value)
+	}
+
+	return b.Bytes(), nil
+}
+
+// journalField writes a field as `NAME=value`. Values with newlines are written
+// as the name, the 64 bit little endian length and the value on separate lines.
+func journalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+
+	b.WriteString(name)
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalFieldName returns a valid field name by upper casing it and replacing
+// the characters other than letters, digits and underscores.
+func journalFieldName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+	if len(s) > maxJournalFieldSize {
+		s = s[:maxJournalFieldSize]
+	}
+	return s
+}
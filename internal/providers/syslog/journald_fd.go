@@ -0,0 +1,56 @@
+//go:build !windows
+
+package syslog
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// journalTmpDir is where the messages too large for a datagram are written.
+const journalTmpDir = "/dev/shm"
+
+// writeJournal writes a message to the journald socket. Messages over the max
+// datagram size are written to an unlinked temporary file instead and its
+// descriptor is sent to journald, the same as sd_journal_send() does.
+// https://systemd.io/JOURNAL_NATIVE_PROTOCOL/
+func writeJournal(conn net.Conn, msg []byte) error {
+	_, err := conn.Write(msg)
+	if err == nil || !(errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)) {
+		return err
+	}
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return err
+	}
+
+	f, err := os.CreateTemp(journalTmpDir, "calert-journal-")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// journald only reads files without links, and it's removed once the
+	// descriptor is closed by both ends.
+	if err := os.Remove(f.Name()); err != nil {
+		return err
+	}
+	if _, err := f.Write(msg); err != nil {
+		return err
+	}
+
+	// WriteMsgUnix can't be used on a connected datagram socket.
+	rc, err := uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := rc.Write(func(fd uintptr) bool {
+		serr = syscall.Sendmsg(int(fd), nil, syscall.UnixRights(int(f.Fd())), nil, 0)
+		return serr != syscall.EAGAIN
+	}); err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,78 @@
+//go:build !windows
+
+package syslog
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournaldLargeMessage(t *testing.T) {
+	if _, err := os.Stat(journalTmpDir); err != nil {
+		t.Skipf("%s isn't available", journalTmpDir)
+	}
+
+	sock := filepath.Join(t.TempDir(), "journal.sock")
+	addr, err := net.ResolveUnixAddr("unixgram", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uc, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uc.Close()
+
+	// A message over the max datagram size is passed as a file descriptor.
+	alert := testAlert
+	alert.Annotations = alertmgrtmpl.KV{"summary": strings.Repeat("a", 1<<20)}
+	s := newTestSyslog(t, NetworkJournald, sock)
+	if err := s.Push([]alertmgrtmpl.Alert{alert}); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		buf = make([]byte, 1024)
+		oob = make([]byte, syscall.CmsgSpace(4))
+	)
+	uc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, oobn, _, _, err := uc.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, n)
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("expected a control message: %v", err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("expected a file descriptor: %v", err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "journal")
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(0), uint64(st.Sys().(*syscall.Stat_t).Nlink), "the file is unlinked")
+
+	// The offset is shared with the sender, like journald which maps the file.
+	b, err := io.ReadAll(io.NewSectionReader(f, 0, st.Size()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasPrefix(string(b), "MESSAGE=TestAlert is firing: "+strings.Repeat("a", 100)))
+	assert.True(t, strings.HasSuffix(string(b), "ALERT_LABEL_SEVERITY=critical\n"))
+}
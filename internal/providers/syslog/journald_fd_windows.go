@@ -0,0 +1,10 @@
+package syslog
+
+import "net"
+
+// writeJournal writes a message to the journald socket. Passing large messages
+// as a file descriptor isn't supported on Windows, which doesn't run journald.
+func writeJournal(conn net.Conn, msg []byte) error {
+	_, err := conn.Write(msg)
+	return err
+}
@@ -0,0 +1,216 @@
+package syslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+)
+
+// Syslog severities.
+// https://www.rfc-editor.org/rfc/rfc5424#section-6.2.1
+const (
+	sevCritical = 2
+	sevError    = 3
+	sevWarning  = 4
+	sevNotice   = 5
+	sevInfo     = 6
+)
+
+const (
+	// Maximum lengths of the header fields.
+	maxHostnameSize = 255
+	maxAppNameSize  = 48
+	maxSDNameSize   = 32
+)
+
+// severities maps the `severity` label to syslog severities.
+var severities = map[string]int{
+	"critical": sevCritical,
+	"high":     sevError,
+	"error":    sevError,
+	"warning":  sevWarning,
+	"low":      sevNotice,
+	"info":     sevInfo,
+}
+
+// severity returns the syslog severity for the alert. Resolved alerts are logged as info.
+func severity(alert alertmgrtmpl.Alert) int {
+	if alert.Status == "resolved" {
+		return sevInfo
+	}
+	if s, ok := severities[strings.ToLower(alert.Labels["severity"])]; ok {
+		return s
+	}
+	return sevNotice
+}
+
+// prepareMessage formats an RFC 5424 message for the alert, with its status and
+// fingerprint in an `alert@<enterprise_id>` structured data element and its labels
+// in a `labels@<enterprise_id>` element.
+// https://www.rfc-editor.org/rfc/rfc5424#section-6
+func (m *SyslogManager) prepareMessage(alert alertmgrtmpl.Alert, ts time.Time) ([]byte, error) {
+	var (
+		b   bytes.Buffer
+		msg bytes.Buffer
+	)
+
+	// Render the template with alert data.
+	if err := m.msgTmpl.Execute(&msg, alert); err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return nil, err
+	}
+
+	// HEADER: <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d %s ",
+		m.facility*8+severity(alert),
+		ts.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerField(m.hostname, maxHostnameSize),
+		headerField(m.appName, maxAppNameSize),
+		os.Getpid(),
+		headerField(alert.Status, maxSDNameSize),
+	)
+
+	// STRUCTURED-DATA
+	fmt.Fprintf(&b, `[alert@%d status="%s" fingerprint="%s" startsAt="%s"]`,
+		m.enterpriseID, escapeParam(alert.Status), escapeParam(alert.Fingerprint), alert.StartsAt.UTC().Format(time.RFC3339))
+	if len(alert.Labels) > 0 {
+		fmt.Fprintf(&b, "[labels@%d", m.enterpriseID)
+		for _, p := range alert.Labels.SortedPairs() {
+			name := sdName(p.Name)
+			if name == "" {
+				continue
+			}
+			fmt.Fprintf(&b, ` %s="%s"`, name, escapeParam(p.Value))
+		}
+		b.WriteByte(']')
+	}
+
+	// MSG
+	if s := strings.TrimSpace(msg.String()); s != "" {
+		b.WriteByte(' ')
+		b.WriteString(s)
+	}
+
+	return b.Bytes(), nil
+}
+
+// headerField returns a header field with non printable characters removed, or the
+// NILVALUE (`-`) if it's empty.
+func headerField(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) > max {
+		s = s[:max]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// sdName returns a valid SD-NAME from a label name by dropping the characters
+// which aren't allowed.
+func sdName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) > maxSDNameSize {
+		s = s[:maxSDNameSize]
+	}
+	return s
+}
+
+var paramEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// escapeParam escapes a PARAM-VALUE.
+func escapeParam(s string) string {
+	return paramEscaper.Replace(s)
+}
+
+// sendMessage writes the message to the server. The connection is redialed
+// once if the write fails, eg if the server closed an idle TCP connection.
+func (m *SyslogManager) sendMessage(msg []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var err error
+	for i := 0; i < 2; i++ {
+		if m.conn == nil {
+			if m.conn, err = m.dial(); err != nil {
+				return err
+			}
+		}
+
+		if err = m.write(msg); err == nil {
+			return nil
+		}
+
+		m.lo.WithError(err).Debug("error writing to syslog, redialing")
+		m.conn.Close()
+		m.conn = nil
+	}
+
+	return err
+}
+
+// dial connects to the server.
+func (m *SyslogManager) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: m.timeout}
+
+	switch m.network {
+	case NetworkTLS:
+		return tls.DialWithDialer(dialer, "tcp", m.address, m.tlsConfig)
+	case NetworkJournald:
+		return dialer.Dial("unixgram", m.address)
+	case NetworkUnix:
+		// The local syslog socket is usually a datagram socket, but try a stream one as well.
+		conn, err := dialer.Dial("unixgram", m.address)
+		if err == nil {
+			return conn, nil
+		}
+		return dialer.Dial("unix", m.address)
+	default:
+		return dialer.Dial(m.network, m.address)
+	}
+}
+
+// write frames and writes the message to the connection. Messages on TCP and TLS
+// use octet counting framing, while datagrams carry one message each.
+// https://www.rfc-editor.org/rfc/rfc6587#section-3.4.1
+func (m *SyslogManager) write(msg []byte) error {
+	if m.timeout > 0 {
+		m.conn.SetWriteDeadline(time.Now().Add(m.timeout))
+	}
+
+	if m.network == NetworkJournald {
+		return writeJournal(m.conn, msg)
+	}
+
+	var out []byte
+	switch {
+	case m.network == NetworkTCP || m.network == NetworkTLS:
+		out = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	case m.conn.RemoteAddr() != nil && m.conn.RemoteAddr().Network() == "unix":
+		// Messages on a stream unix socket are delimited by newlines.
+		out = append(msg, '\n')
+	default:
+		out = msg
+	}
+
+	_, err := m.conn.Write(out)
+	return err
+}
@@ -0,0 +1,236 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+// Networks for connecting to the syslog server.
+const (
+	NetworkUDP  = "udp"
+	NetworkTCP  = "tcp"
+	NetworkTLS  = "tls"
+	NetworkUnix = "unix"
+	// NetworkJournald writes to the journald socket in its native protocol.
+	NetworkJournald = "journald"
+)
+
+const (
+	defaultFacility = "local0"
+	defaultAppName  = "calert"
+	// defaultEnterpriseID is the private enterprise number used in structured data IDs.
+	// 32473 is reserved for documentation by RFC 5612.
+	defaultEnterpriseID  = 32473
+	defaultSocket        = "/dev/log"
+	defaultJournalSocket = "/run/systemd/journal/socket"
+)
+
+// facilities maps the facility names to their codes.
+// https://www.rfc-editor.org/rfc/rfc5424#section-6.2.1
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+type SyslogManager struct {
+	lo           *logrus.Logger
+	metrics      *metrics.Manager
+	network      string
+	address      string
+	tlsConfig    *tls.Config
+	timeout      time.Duration
+	facility     int
+	hostname     string
+	appName      string
+	enterpriseID int
+	name         string
+	room         string
+	msgTmpl      *template.Template
+	dryRun       bool
+
+	// conn is the connection to the server. It's dialed on the first message and
+	// redialed if a write fails.
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+type SyslogOpts struct {
+	Log     *logrus.Logger
+	Metrics *metrics.Manager
+	DryRun  bool
+	Timeout time.Duration
+	// Network is one of `udp`, `tcp`, `tls`, `unix` or `journald`. Defaults to `unix`.
+	Network string
+	// Address is the `host:port` of the server, or the path of the socket for `unix`
+	// and `journald`. Defaults to `/dev/log` for `unix` and `/run/systemd/journal/socket`
+	// for `journald`.
+	Address            string
+	CAFile             string
+	InsecureSkipVerify bool
+	Facility           string
+	// Hostname is sent in the HOSTNAME field. Defaults to the hostname of the machine.
+	Hostname string
+	AppName  string
+	// EnterpriseID is the private enterprise number in the structured data IDs (eg `alert@32473`).
+	EnterpriseID int
+	// Name is the unique name of the provider in the config.
+	Name     string
+	Room     string
+	Template string
+}
+
+// NewSyslog initializes a syslog provider object.
+func NewSyslog(opts SyslogOpts) (*SyslogManager, error) {
+	if opts.Network == "" {
+		opts.Network = NetworkUnix
+	}
+	if opts.Network != NetworkUDP && opts.Network != NetworkTCP && opts.Network != NetworkTLS &&
+		opts.Network != NetworkUnix && opts.Network != NetworkJournald {
+		return nil, fmt.Errorf("unknown network: %s", opts.Network)
+	}
+	if opts.Address == "" {
+		switch opts.Network {
+		case NetworkUnix:
+			opts.Address = defaultSocket
+		case NetworkJournald:
+			opts.Address = defaultJournalSocket
+		default:
+			return nil, fmt.Errorf("address is required")
+		}
+	}
+	if opts.Facility == "" {
+		opts.Facility = defaultFacility
+	}
+	facility, ok := facilities[strings.ToLower(opts.Facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown facility: %s", opts.Facility)
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.AppName == "" {
+		opts.AppName = defaultAppName
+	}
+	if opts.EnterpriseID == 0 {
+		opts.EnterpriseID = defaultEnterpriseID
+	}
+
+	var tlsConfig *tls.Config
+	if opts.Network == NetworkTLS {
+		host, _, err := net.SplitHostPort(opts.Address)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing address: %v", err)
+		}
+		tlsConfig = &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: opts.InsecureSkipVerify,
+		}
+
+		// Use a custom CA to verify the server, eg for an internal syslog pipeline.
+		if opts.CAFile != "" {
+			ca, err := os.ReadFile(opts.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("error reading ca file: %v", err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("no certificates found in ca file %s", opts.CAFile)
+			}
+		}
+	}
+
+	// Load the template.
+	tmpl, err := providers.LoadTemplate(opts.Template, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SyslogManager{
+		lo:           opts.Log,
+		metrics:      opts.Metrics,
+		network:      opts.Network,
+		address:      opts.Address,
+		tlsConfig:    tlsConfig,
+		timeout:      opts.Timeout,
+		facility:     facility,
+		hostname:     opts.Hostname,
+		appName:      opts.AppName,
+		enterpriseID: opts.EnterpriseID,
+		name:         opts.Name,
+		room:         opts.Room,
+		msgTmpl:      tmpl,
+		dryRun:       opts.DryRun,
+	}, nil
+}
+
+// Push accepts the list of alerts and writes a syslog message for each of them.
+func (m *SyslogManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to syslog")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		var (
+			msg []byte
+			err error
+		)
+		if m.network == NetworkJournald {
+			msg, err = m.prepareJournalMessage(a)
+		} else {
+			msg, err = m.prepareMessage(a, time.Now())
+		}
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Write message to the server.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			if err := m.sendMessage(msg); err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				perr.Add(a, string(msg), err)
+				continue
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *SyslogManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *SyslogManager) ID() string {
+	return "syslog"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *SyslogManager) Name() string {
+	return m.name
+}
@@ -0,0 +1,201 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+var testAlert = alertmgrtmpl.Alert{
+	Status: "firing",
+	Labels: alertmgrtmpl.KV(map[string]string{
+		"severity": "critical", "alertname": "TestAlert", "path": `C:\data "x"]`,
+	}),
+	Annotations: alertmgrtmpl.KV(map[string]string{
+		"summary": "disk is full",
+	}),
+	StartsAt:    time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+	Fingerprint: "1a956348d0570965",
+}
+
+func TestSyslogFormat(t *testing.T) {
+	s, err := NewSyslog(SyslogOpts{
+		Log:      logrus.New(),
+		Network:  NetworkUDP,
+		Address:  "127.0.0.1:514",
+		Hostname: "calert-01",
+		Template: "../../../static/syslog.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := s.prepareMessage(testAlert, time.Date(2023, 1, 2, 3, 4, 6, 500000000, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// local0 (16) * 8 + crit (2) = 130
+	assert.Equal(t, fmt.Sprintf(`<130>1 2023-01-02T03:04:06.500000Z calert-01 calert %d firing `+
+		`[alert@32473 status="firing" fingerprint="1a956348d0570965" startsAt="2023-01-02T03:04:05Z"]`+
+		`[labels@32473 alertname="TestAlert" path="C:\\data \"x\"\]" severity="critical"] `+
+		`TestAlert is firing: disk is full`, os.Getpid()), string(msg))
+
+	resolved := testAlert
+	resolved.Status = "resolved"
+	msg, err = s.prepareMessage(resolved, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasPrefix(string(msg), "<134>1 "))
+}
+
+func TestSyslogNetworks(t *testing.T) {
+	// UDP
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	s := newTestSyslog(t, NetworkUDP, pc.LocalAddr().String())
+	if err := s.Push([]alertmgrtmpl.Alert{testAlert}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasPrefix(string(buf[:n]), "<130>1 "))
+
+	// TCP uses octet counting framing.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	s = newTestSyslog(t, NetworkTCP, ln.Addr().String())
+	if err := s.Push([]alertmgrtmpl.Alert{testAlert, testAlert}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := make([]byte, l)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, strings.HasSuffix(string(msg), "TestAlert is firing: disk is full"))
+	}
+
+	// Unix datagram socket.
+	sock := filepath.Join(t.TempDir(), "log.sock")
+	uc, err := net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uc.Close()
+
+	s = newTestSyslog(t, NetworkUnix, sock)
+	if err := s.Push([]alertmgrtmpl.Alert{testAlert}); err != nil {
+		t.Fatal(err)
+	}
+
+	uc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err = uc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasSuffix(string(buf[:n]), "disk is full"))
+}
+
+func TestJournald(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "journal.sock")
+	uc, err := net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uc.Close()
+
+	s := newTestSyslog(t, NetworkJournald, sock)
+	if err := s.Push([]alertmgrtmpl.Alert{testAlert}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 2048)
+	uc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := uc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// local0 is 16 and critical is 2.
+	assert.Equal(t, "MESSAGE=TestAlert is firing: disk is full\n"+
+		"PRIORITY=2\n"+
+		"SYSLOG_FACILITY=16\n"+
+		"SYSLOG_IDENTIFIER=calert\n"+
+		"ALERT_STATUS=firing\n"+
+		"ALERT_FINGERPRINT=1a956348d0570965\n"+
+		"ALERT_STARTS_AT=2023-01-02T03:04:05Z\n"+
+		"ALERT_LABEL_ALERTNAME=TestAlert\n"+
+		`ALERT_LABEL_PATH=C:\data "x"]`+"\n"+
+		"ALERT_LABEL_SEVERITY=critical\n", string(buf[:n]))
+
+	// Values with newlines are prefixed with their length.
+	var b bytes.Buffer
+	journalField(&b, "MESSAGE", "disk\nis full")
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, 12)
+	assert.Equal(t, "MESSAGE\n"+string(size)+"disk\nis full\n", b.String())
+
+	assert.Equal(t, "ALERT_LABEL_K8S_IO_APP", journalFieldName("ALERT_LABEL_k8s.io/app"))
+}
+
+func newTestSyslog(t *testing.T, network, address string) *SyslogManager {
+	s, err := NewSyslog(SyslogOpts{
+		Log:      logrus.New(),
+		Metrics:  metrics.New("calert"),
+		Timeout:  5 * time.Second,
+		Network:  network,
+		Address:  address,
+		Room:     "audit",
+		Template: "../../../static/syslog.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
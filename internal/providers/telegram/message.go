@@ -0,0 +1,199 @@
+package telegram
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+)
+
+const (
+	// maxMsgSize is the maximum number of characters in a message.
+	maxMsgSize = 4096
+)
+
+var (
+	markdownV2Replacer = strings.NewReplacer(
+		`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+		"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+		"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+	)
+	htmlReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	htmlTag      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Message represents the payload for the `sendMessage` method.
+// https://core.telegram.org/bots/api#sendmessage
+type Message struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode,omitempty"`
+	ReplyToMessageID      int64  `json:"reply_to_message_id,omitempty"`
+	AllowSendingNoReply   bool   `json:"allow_sending_without_reply"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+type sendMessageResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Result      struct {
+		MessageID int64 `json:"message_id"`
+	} `json:"result"`
+	Parameters struct {
+		// RetryAfter is the number of seconds to wait when the rate limit is exceeded.
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// prepareMessage accepts an Alert object and templates out with the user provided template.
+func (m *TelegramManager) prepareMessage(alert alertmgrtmpl.Alert, replyTo string) (Message, error) {
+	var to bytes.Buffer
+
+	// Render a template with alert data.
+	if err := m.msgTmpl.Execute(&to, alert); err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return Message{}, err
+	}
+
+	msg := Message{
+		ChatID:    m.chatID,
+		Text:      to.String(),
+		ParseMode: m.parseMode,
+		// If the original message was deleted, send it as a normal message.
+		AllowSendingNoReply:   true,
+		DisableWebPagePreview: true,
+	}
+
+	// Truncating formatted text can break the markup, so send it as plain text instead.
+	// The markup is removed and the escaped values are unescaped, so neither shows up as is.
+	if utf8.RuneCountInString(msg.Text) > maxMsgSize {
+		msg.Text = stripMarkup(msg.Text, m.parseMode)
+		if utf8.RuneCountInString(msg.Text) > maxMsgSize {
+			msg.Text = string([]rune(msg.Text)[:maxMsgSize])
+		}
+		msg.ParseMode = ""
+	}
+
+	if replyTo != "" {
+		id, err := strconv.ParseInt(replyTo, 10, 64)
+		if err != nil {
+			return msg, err
+		}
+		msg.ReplyToMessageID = id
+	}
+
+	return msg, nil
+}
+
+// sendMessage sends the message to the chat and returns its ID.
+func (m *TelegramManager) sendMessage(msg Message) (int64, error) {
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+
+	// Prepare the request.
+	req, err := http.NewRequest("POST", m.endpoint, bytes.NewBuffer(out))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Send the request. The endpoint isn't logged since it contains the bot token.
+	m.lo.WithField("msg", msg).Debug("sending alert")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		// The error from the client contains the URL, which in turn contains the token.
+		// Only the underlying error is kept, so network errors can still be retried.
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			return 0, fmt.Errorf("error sending request to telegram: %w", ue.Err)
+		}
+		return 0, errors.New("error sending request to telegram")
+	}
+	defer resp.Body.Close()
+
+	// If response is non 200, log and throw the error.
+	if resp.StatusCode != http.StatusOK {
+		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from Telegram Bot API")
+		err := providers.NewStatusError(m.ID(), resp)
+
+		// The Bot API sends the wait for 429 responses in the body instead of a `Retry-After` header.
+		var se *providers.StatusError
+		if errors.As(err, &se) && se.RetryAfter == 0 {
+			var r sendMessageResponse
+			if json.Unmarshal([]byte(se.Body), &r) == nil && r.Parameters.RetryAfter > 0 {
+				se.RetryAfter = time.Duration(r.Parameters.RetryAfter) * time.Second
+			}
+		}
+		return 0, err
+	}
+
+	var r sendMessageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return 0, err
+	}
+	if !r.OK {
+		return 0, errors.New("error from telegram: " + r.Description)
+	}
+
+	return r.Result.MessageID, nil
+}
+
+// stripMarkup converts a message formatted as per `parseMode` to plain text.
+func stripMarkup(s, parseMode string) string {
+	switch parseMode {
+	case ParseModeHTML:
+		return html.UnescapeString(htmlTag.ReplaceAllString(s, ""))
+	case ParseModeMarkdownV2:
+		return stripMarkdownV2(s)
+	}
+	return s
+}
+
+// stripMarkdownV2 removes the formatting entities and unescapes the escaped
+// characters of a MarkdownV2 message. Links are kept as `text (url)`.
+func stripMarkdownV2(s string) string {
+	var (
+		b = strings.Builder{}
+		r = []rune(s)
+	)
+	for i := 0; i < len(r); i++ {
+		switch c := r[i]; c {
+		case '\\':
+			if i+1 < len(r) {
+				i++
+				b.WriteRune(r[i])
+			}
+		case '*', '_', '~', '`', '|', '[', '>':
+		case ']':
+			if i+1 < len(r) && r[i+1] == '(' {
+				b.WriteRune(' ')
+			}
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// escapeMarkdownV2 escapes all the special characters in MarkdownV2 mode.
+func escapeMarkdownV2(s string) string {
+	return markdownV2Replacer.Replace(s)
+}
+
+// escapeHTML escapes the characters which must be replaced with entities in HTML mode.
+func escapeHTML(s string) string {
+	return htmlReplacer.Replace(s)
+}
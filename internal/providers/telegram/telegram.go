@@ -0,0 +1,185 @@
+package telegram
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+// Parse modes supported by the Bot API.
+// https://core.telegram.org/bots/api#formatting-options
+const (
+	ParseModeMarkdownV2 = "MarkdownV2"
+	ParseModeHTML       = "HTML"
+
+	defaultAPIURL = "https://api.telegram.org"
+)
+
+type TelegramManager struct {
+	lo           *logrus.Logger
+	metrics      *metrics.Manager
+	activeAlerts *providers.ActiveAlerts
+	endpoint     string
+	chatID       string
+	parseMode    string
+	name         string
+	room         string
+	client       *http.Client
+	retry        *providers.Retrier
+	msgTmpl      *template.Template
+	dryRun       bool
+}
+
+type TelegramOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	// APIURL is the Bot API server. Defaults to https://api.telegram.org.
+	APIURL string
+	Token  string
+	ChatID string
+	// ParseMode is one of `MarkdownV2`, `HTML` or empty for plain text.
+	ParseMode string
+	// Name is the unique name of the provider in the config.
+	Name      string
+	Room      string
+	Template  string
+	ThreadTTL time.Duration
+}
+
+// NewTelegram initializes a Telegram provider object.
+func NewTelegram(opts TelegramOpts) (*TelegramManager, error) {
+	if opts.Token == "" || opts.ChatID == "" {
+		return nil, fmt.Errorf("token and chat_id are required")
+	}
+	if opts.APIURL == "" {
+		opts.APIURL = defaultAPIURL
+	}
+
+	var escape func(string) string
+	switch opts.ParseMode {
+	case ParseModeMarkdownV2:
+		escape = escapeMarkdownV2
+	case ParseModeHTML:
+		escape = escapeHTML
+	case "":
+		escape = func(s string) string { return s }
+	default:
+		return nil, fmt.Errorf("unknown parse mode: %s", opts.ParseMode)
+	}
+
+	// Initialise a generic HTTP Client for communicating with the Bot API.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the template. `escape` escapes a value as per the configured parse mode.
+	tmpl, err := providers.LoadTemplate(opts.Template, template.FuncMap{
+		"escape": escape,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &TelegramManager{
+		lo:           opts.Log,
+		metrics:      opts.Metrics,
+		retry:        providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "telegram", opts.Name, opts.Room),
+		client:       client,
+		endpoint:     fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimSuffix(opts.APIURL, "/"), opts.Token),
+		chatID:       opts.ChatID,
+		parseMode:    opts.ParseMode,
+		name:         opts.Name,
+		room:         opts.Room,
+		activeAlerts: providers.NewActiveAlerts(opts.Log, opts.Metrics),
+		msgTmpl:      tmpl,
+		dryRun:       opts.DryRun,
+	}
+	// Start a background worker to cleanup alerts based on TTL mechanism.
+	go mgr.activeAlerts.StartPruneWorker(1*time.Hour, opts.ThreadTTL)
+
+	return mgr, nil
+}
+
+// Push accepts the list of alerts and sends them to the chat. Updates for an alert
+// are sent as replies to the first message posted for its fingerprint.
+func (m *TelegramManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to telegram")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		// If it's a new alert whose fingerprint isn't in the active alerts map, add it first.
+		details, err := m.activeAlerts.GetOrAdd(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error adding active alert")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		msg, err := m.prepareMessage(a, details.MessageID)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Send message to API.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			var id int64
+			err := m.retry.Do(func() (err error) {
+				id, err = m.sendMessage(msg)
+				return err
+			})
+			if err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				perr.Add(a, msg, err)
+				continue
+			}
+
+			// Store the ID of the first message so that future updates reply to it.
+			if details.MessageID == "" {
+				m.activeAlerts.SetMessageID(a.Fingerprint, strconv.FormatInt(id, 10))
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *TelegramManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *TelegramManager) ID() string {
+	return "telegram"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *TelegramManager) Name() string {
+	return m.name
+}
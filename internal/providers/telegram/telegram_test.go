@@ -0,0 +1,143 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelegramReplyThreading(t *testing.T) {
+	var (
+		received []Message
+		nextID   = 100
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/bottest-token/sendMessage", r.URL.Path)
+
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, msg)
+
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d}}`, nextID)
+		nextID++
+	}))
+	defer srv.Close()
+
+	tg, err := NewTelegram(TelegramOpts{
+		Log:       logrus.New(),
+		Metrics:   metrics.New("calert"),
+		APIURL:    srv.URL,
+		Token:     "test-token",
+		ChatID:    "-1001234",
+		ParseMode: ParseModeHTML,
+		Room:      "qa",
+		Template:  "../../../static/telegram.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "high", "alertname": "TestAlert",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"summary": "latency > 5s & rising",
+		}),
+		Fingerprint: "1a956348d0570965",
+	}
+	resolved := alert
+	resolved.Status = "resolved"
+
+	if err := tg.Push([]alertmgrtmpl.Alert{alert, resolved}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, received, 2)
+	assert.Equal(t, "-1001234", received[0].ChatID)
+	assert.Equal(t, "HTML", received[0].ParseMode)
+	assert.Equal(t, "<b>(HIGH) TestAlert - Firing</b>\n<b>Summary</b>: latency &gt; 5s &amp; rising\n", received[0].Text)
+	assert.Zero(t, received[0].ReplyToMessageID)
+	assert.Equal(t, int64(100), received[1].ReplyToMessageID)
+}
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	assert.Equal(t, `disk\_usage \> 90% on host\-1\.prod \(sda\)`, escapeMarkdownV2("disk_usage > 90% on host-1.prod (sda)"))
+}
+
+func TestTelegramTruncate(t *testing.T) {
+	tg, err := NewTelegram(TelegramOpts{
+		Log:       logrus.New(),
+		Metrics:   metrics.New("calert"),
+		Token:     "test-token",
+		ChatID:    "-1001234",
+		ParseMode: ParseModeHTML,
+		Room:      "qa",
+		Template:  "../../../static/telegram.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Messages over the limit are sent as plain text, without the markup or the escaped values.
+	msg, err := tg.prepareMessage(alertmgrtmpl.Alert{
+		Status:      "firing",
+		Labels:      alertmgrtmpl.KV{"alertname": "TestAlert", "severity": "high"},
+		Annotations: alertmgrtmpl.KV{"summary": strings.Repeat("a & <b> ", maxMsgSize)},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, msg.ParseMode)
+	assert.Equal(t, maxMsgSize, utf8.RuneCountInString(msg.Text))
+	assert.True(t, strings.HasPrefix(msg.Text, "(HIGH) TestAlert - Firing\nSummary: a & <b> a & <b>"), msg.Text[:64])
+	assert.NotContains(t, msg.Text, "&amp;")
+	assert.NotContains(t, msg.Text, "</b>")
+}
+
+func TestStripMarkdownV2(t *testing.T) {
+	assert.Equal(t, "(HIGH) disk_usage > 90% - see runbook (https://example.com/runbook)",
+		stripMarkup(`*\(HIGH\) disk\_usage \> 90%* \- see [runbook](https://example.com/runbook)`, ParseModeMarkdownV2))
+}
+
+func TestTelegramRetryAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 7","parameters":{"retry_after":7}}`))
+	}))
+	defer srv.Close()
+
+	tg, err := NewTelegram(TelegramOpts{
+		Log:      logrus.New(),
+		Metrics:  metrics.New("calert"),
+		APIURL:   srv.URL,
+		Token:    "test-token",
+		ChatID:   "-1001234",
+		Room:     "qa",
+		Template: "../../../static/telegram.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The wait in the body is used as the `Retry-After` of the response.
+	_, err = tg.sendMessage(Message{ChatID: "-1001234", Text: "test"})
+	ok, wait := providers.Retryable(err)
+	assert.True(t, ok)
+	assert.Equal(t, 7*time.Second, wait)
+}
@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"encoding/json"
+	htmltemplate "html/template"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+)
+
+// TemplateFuncs returns the functions available in all the message templates.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"Title":      strings.Title,
+		"toUpper":    strings.ToUpper,
+		"Contains":   strings.Contains,
+		"escapeJSON": EscapeJSON,
+		"Text":       replaceNewLines,
+		"isEmpty":    isEmpty,
+	}
+}
+
+// LoadTemplate parses the template file at `path`. Functions in `funcs` are
+// added to (or override) the default template functions.
+func LoadTemplate(path string, funcs template.FuncMap) (*template.Template, error) {
+	fm := TemplateFuncs()
+	for k, f := range funcs {
+		fm[k] = f
+	}
+
+	return template.New(filepath.Base(path)).Funcs(fm).ParseFiles(path)
+}
+
+// LoadHTMLTemplate parses the HTML template file at `path` with html/template, so
+// the alert data is escaped based on where it's used in the HTML. Functions in
+// `funcs` are added to (or override) the default template functions.
+func LoadHTMLTemplate(path string, funcs template.FuncMap) (*htmltemplate.Template, error) {
+	fm := TemplateFuncs()
+	for k, f := range funcs {
+		fm[k] = f
+	}
+
+	return htmltemplate.New(filepath.Base(path)).Funcs(htmltemplate.FuncMap(fm)).ParseFiles(path)
+}
+
+// NewTemplate parses a template string, such as a title or a payload field from
+// the config. Missing labels and annotations are rendered as empty strings
+// instead of `<no value>`.
+func NewTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(TemplateFuncs()).Option("missingkey=zero").Parse(text)
+}
+
+// Render executes a template with the alert data and returns the trimmed output.
+func Render(t *template.Template, alert alertmgrtmpl.Alert) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, alert); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// Truncate trims a string to at most `n` bytes without splitting a UTF-8 character.
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// EscapeJSON escapes a string so that it can be embedded inside a JSON string literal.
+func EscapeJSON(s string) string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return ""
+	}
+	// Trim the leading and trailing quotes added by json.Marshal
+	return string(b[1 : len(b)-1])
+}
+
+func replaceNewLines(s string) string {
+	return strings.ReplaceAll(s, "\n", "\\n")
+}
+
+func isEmpty(input interface{}) bool {
+	if str, ok := input.(string); ok {
+		if len(str) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,195 @@
+package webex
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+)
+
+const (
+	contentTypeCard = "application/vnd.microsoft.card.adaptive"
+	// Messages with more than 7439 bytes of markdown are rejected.
+	maxMarkdownSize = 7439
+	// maxCardSize is the maximum size of a card accepted by Webex (~28 KB)
+	// with some room left for the rest of the message.
+	maxCardSize = 27 * 1024
+
+	truncatedSuffix     = "… (truncated)"
+	maxTruncateAttempts = 50
+)
+
+var errInvalidCard = errors.New("invalid adaptive card")
+
+type Attachment struct {
+	ContentType string          `json:"contentType"`
+	Content     json.RawMessage `json:"content"`
+}
+
+// Message represents the payload for creating a message.
+// https://developer.webex.com/docs/api/v1/messages/create-a-message
+type Message struct {
+	RoomID      string       `json:"roomId"`
+	ParentID    string       `json:"parentId,omitempty"`
+	Markdown    string       `json:"markdown"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// prepareMessage renders the templates and sets the parent as `parentID` if it's non empty.
+func (m *WebexManager) prepareMessage(alert alertmgrtmpl.Alert, parentID string) (Message, error) {
+	var (
+		to  bytes.Buffer
+		msg = Message{RoomID: m.roomID, ParentID: parentID}
+	)
+
+	// Render the template with alert data.
+	if err := m.msgTmpl.Execute(&to, alert); err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return msg, err
+	}
+	msg.Markdown = to.String()
+	if len(msg.Markdown) > maxMarkdownSize {
+		msg.Markdown = strings.ToValidUTF8(msg.Markdown[:maxMarkdownSize], "")
+	}
+
+	if m.cardTmpl != nil {
+		var card bytes.Buffer
+		if err := m.cardTmpl.Execute(&card, alert); err != nil {
+			m.lo.WithError(err).Error("Error parsing values in card template")
+			return msg, err
+		}
+
+		// Validate the rendered card as the API only returns a generic error for invalid ones.
+		if !json.Valid(card.Bytes()) {
+			m.lo.WithField("card", card.String()).Error("card template did not render valid JSON")
+			return msg, errInvalidCard
+		}
+		msg.Attachments = []Attachment{{ContentType: contentTypeCard, Content: truncateCard(card.Bytes())}}
+	}
+
+	return msg, nil
+}
+
+// truncateCard trims the longest text values of a card until it fits within
+// maxCardSize. If that isn't possible, the body is replaced with a TextBlock
+// saying that the content was truncated.
+func truncateCard(card json.RawMessage) json.RawMessage {
+	// The size is measured as it's sent, compacted and with HTML characters escaped.
+	if out, err := json.Marshal(card); err != nil || len(out) <= maxCardSize {
+		return card
+	}
+
+	var v map[string]interface{}
+	if err := json.Unmarshal(card, &v); err != nil {
+		return card
+	}
+	for i := 0; i < maxTruncateAttempts; i++ {
+		out, err := json.Marshal(v)
+		if err != nil {
+			break
+		}
+		if len(out) <= maxCardSize {
+			return out
+		}
+		if !truncateLongest(v, len(out)-maxCardSize+len(truncatedSuffix)) {
+			break
+		}
+	}
+
+	version, ok := v["version"].(string)
+	if !ok {
+		version = "1.3"
+	}
+	out, _ := json.Marshal(map[string]interface{}{
+		"type":    "AdaptiveCard",
+		"version": version,
+		"body": []interface{}{
+			map[string]interface{}{"type": "TextBlock", "text": truncatedSuffix, "wrap": true},
+		},
+	})
+	return out
+}
+
+// truncateLongest finds the longest text value nested in `v` and trims `n` bytes
+// off it, or all of it if it's shorter. It returns false if there's nothing left
+// to trim. Only the values of the `text`, `title` and `value` fields are trimmed,
+// so the structure of the card is left intact.
+func truncateLongest(v interface{}, n int) bool {
+	var (
+		longest string
+		set     func(string)
+		walk    func(v interface{})
+	)
+
+	walk = func(v interface{}) {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for k, val := range t {
+				s, ok := val.(string)
+				if ok && (k == "text" || k == "title" || k == "value") && len(s) > len(longest) && !strings.HasSuffix(s, truncatedSuffix) {
+					k := k
+					longest, set = s, func(s string) { t[k] = s }
+				}
+				walk(val)
+			}
+		case []interface{}:
+			for _, val := range t {
+				walk(val)
+			}
+		}
+	}
+	walk(v)
+
+	if set == nil {
+		return false
+	}
+	if n > len(longest) {
+		n = len(longest)
+	}
+	set(strings.ToValidUTF8(longest[:len(longest)-n], "") + truncatedSuffix)
+
+	return true
+}
+
+// sendMessage sends the message to the room and returns its ID.
+func (m *WebexManager) sendMessage(msg Message) (string, error) {
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+
+	// Prepare the request.
+	req, err := http.NewRequest("POST", m.endpoint, bytes.NewBuffer(out))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.token)
+
+	// Send the request.
+	m.lo.WithField("msg", msg).Debug("sending alert")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// If response is non 200, log and throw the error.
+	if resp.StatusCode != http.StatusOK {
+		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from Webex API")
+		return "", providers.NewStatusError(m.ID(), resp)
+	}
+
+	var r struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return "", err
+	}
+
+	return r.ID, nil
+}
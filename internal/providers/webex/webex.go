@@ -0,0 +1,176 @@
+package webex
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAPIURL = "https://webexapis.com"
+)
+
+type WebexManager struct {
+	lo           *logrus.Logger
+	metrics      *metrics.Manager
+	activeAlerts *providers.ActiveAlerts
+	endpoint     string
+	token        string
+	roomID       string
+	name         string
+	room         string
+	client       *http.Client
+	retry        *providers.Retrier
+	msgTmpl      *template.Template
+	cardTmpl     *template.Template
+	dryRun       bool
+}
+
+type WebexOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	APIURL      string
+	// Token is the access token of the bot.
+	Token string
+	// RoomID is the ID of the Webex room (space) to post to.
+	RoomID string
+	// Name is the unique name of the provider in the config.
+	Name string
+	Room string
+	// Template renders the markdown message and CardTemplate (optional) renders
+	// an adaptive card which is attached to it. Clients which can't render cards
+	// show the markdown instead.
+	Template     string
+	CardTemplate string
+	ThreadTTL    time.Duration
+}
+
+// NewWebex initializes a Webex provider object.
+func NewWebex(opts WebexOpts) (*WebexManager, error) {
+	if opts.Token == "" || opts.RoomID == "" {
+		return nil, fmt.Errorf("token and room_id are required")
+	}
+	if opts.APIURL == "" {
+		opts.APIURL = defaultAPIURL
+	}
+
+	// Initialise a generic HTTP Client for communicating with the Webex API.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the templates.
+	tmpl, err := providers.LoadTemplate(opts.Template, nil)
+	if err != nil {
+		return nil, err
+	}
+	var cardTmpl *template.Template
+	if opts.CardTemplate != "" {
+		if cardTmpl, err = providers.LoadTemplate(opts.CardTemplate, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	mgr := &WebexManager{
+		lo:           opts.Log,
+		metrics:      opts.Metrics,
+		retry:        providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "webex", opts.Name, opts.Room),
+		client:       client,
+		endpoint:     strings.TrimSuffix(opts.APIURL, "/") + "/v1/messages",
+		token:        opts.Token,
+		roomID:       opts.RoomID,
+		name:         opts.Name,
+		room:         opts.Room,
+		activeAlerts: providers.NewActiveAlerts(opts.Log, opts.Metrics),
+		msgTmpl:      tmpl,
+		cardTmpl:     cardTmpl,
+		dryRun:       opts.DryRun,
+	}
+	// Start a background worker to cleanup alerts based on TTL mechanism.
+	go mgr.activeAlerts.StartPruneWorker(1*time.Hour, opts.ThreadTTL)
+
+	return mgr, nil
+}
+
+// Push accepts the list of alerts and sends them to the room. Updates for an alert
+// are posted as replies to the first message sent for its fingerprint.
+func (m *WebexManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to webex")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		// If it's a new alert whose fingerprint isn't in the active alerts map, add it first.
+		details, err := m.activeAlerts.GetOrAdd(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error adding active alert")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		msg, err := m.prepareMessage(a, details.MessageID)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Send message to API.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			var id string
+			err := m.retry.Do(func() (err error) {
+				id, err = m.sendMessage(msg)
+				return err
+			})
+			if err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				perr.Add(a, msg, err)
+				continue
+			}
+
+			// Store the ID of the first message as the parent for the replies.
+			if details.MessageID == "" {
+				m.activeAlerts.SetMessageID(a.Fingerprint, id)
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *WebexManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *WebexManager) ID() string {
+	return "webex"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *WebexManager) Name() string {
+	return m.name
+}
@@ -0,0 +1,149 @@
+package webex
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebexThreading(t *testing.T) {
+	var received []Message
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, msg)
+
+		fmt.Fprintf(w, `{"id":"msg-%d","roomId":"%s"}`, len(received), msg.RoomID)
+	}))
+	defer srv.Close()
+
+	wx, err := NewWebex(WebexOpts{
+		Log:          logrus.New(),
+		Metrics:      metrics.New("calert"),
+		APIURL:       srv.URL,
+		Token:        "test-token",
+		RoomID:       "room-1",
+		Room:         "qa",
+		Template:     "../../../static/message.tmpl",
+		CardTemplate: "../../../static/webex_card.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "high", "alertname": "TestAlert",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"summary": `disk "/" is full`,
+		}),
+		Fingerprint: "1a956348d0570965",
+	}
+	resolved := alert
+	resolved.Status = "resolved"
+
+	if err := wx.Push([]alertmgrtmpl.Alert{alert}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wx.Push([]alertmgrtmpl.Alert{resolved}); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, received, 2) {
+		assert.Equal(t, "room-1", received[0].RoomID)
+		assert.Empty(t, received[0].ParentID)
+		assert.Contains(t, received[0].Markdown, "TestAlert")
+
+		if assert.Len(t, received[0].Attachments, 1) {
+			assert.Equal(t, contentTypeCard, received[0].Attachments[0].ContentType)
+
+			var card map[string]interface{}
+			if err := json.Unmarshal(received[0].Attachments[0].Content, &card); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "AdaptiveCard", card["type"])
+		}
+
+		// The resolved message is a reply to the first one.
+		assert.Equal(t, "msg-1", received[1].ParentID)
+	}
+}
+
+func TestTruncateCard(t *testing.T) {
+	newCard := func(texts ...string) json.RawMessage {
+		body := make([]map[string]interface{}, 0, len(texts))
+		for _, text := range texts {
+			body = append(body, map[string]interface{}{"type": "TextBlock", "text": text, "wrap": true})
+		}
+		out, err := json.Marshal(map[string]interface{}{"type": "AdaptiveCard", "version": "1.3", "body": body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	decode := func(card json.RawMessage) []string {
+		var c struct {
+			Version string `json:"version"`
+			Body    []struct {
+				Text string `json:"text"`
+			} `json:"body"`
+		}
+		if err := json.Unmarshal(card, &c); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "1.3", c.Version)
+		var out []string
+		for _, b := range c.Body {
+			out = append(out, b.Text)
+		}
+		return out
+	}
+
+	// Cards within the limit are left as is.
+	card := newCard("disk is full")
+	assert.Equal(t, card, truncateCard(card))
+
+	// The longest text is trimmed, and the HTML characters escaped when it's sent are counted.
+	out := truncateCard(newCard("disk is full", strings.Repeat("<", 10*1024)))
+	assert.LessOrEqual(t, len(out), maxCardSize)
+	if texts := decode(out); assert.Len(t, texts, 2) {
+		assert.Equal(t, "disk is full", texts[0])
+		assert.True(t, strings.HasSuffix(texts[1], truncatedSuffix))
+	}
+
+	// Texts shorter than the excess are trimmed one after the other.
+	long := strings.Repeat("a", 10*1024)
+	out = truncateCard(newCard(long, long, long, long))
+	assert.LessOrEqual(t, len(out), maxCardSize)
+	if texts := decode(out); assert.Len(t, texts, 4) {
+		assert.Equal(t, truncatedSuffix, texts[0])
+		assert.True(t, strings.HasSuffix(texts[1], truncatedSuffix))
+		assert.Greater(t, len(texts[1]), len(truncatedSuffix))
+		assert.Equal(t, long, texts[2])
+		assert.Equal(t, long, texts[3])
+	}
+
+	// The body is replaced if there are too many texts to trim.
+	texts := make([]string, 2000)
+	for i := range texts {
+		texts[i] = strings.Repeat("x", 20)
+	}
+	out = truncateCard(newCard(texts...))
+	assert.Equal(t, []string{truncatedSuffix}, decode(out))
+}
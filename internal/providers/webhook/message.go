@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+)
+
+// Message represents a rendered request to the webhook.
+type Message struct {
+	Body    []byte
+	Headers map[string]string
+}
+
+// prepareMessage renders the body and header templates with the alert data.
+func (m *WebhookManager) prepareMessage(alert alertmgrtmpl.Alert) (Message, error) {
+	var (
+		to  bytes.Buffer
+		msg = Message{Headers: make(map[string]string, len(m.headerTmpls))}
+	)
+
+	// Render a template with alert data.
+	if err := m.msgTmpl.Execute(&to, alert); err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return msg, err
+	}
+
+	// Catch broken JSON templates here instead of sending them upstream.
+	if m.format == FormatJSON && !json.Valid(to.Bytes()) {
+		return msg, fmt.Errorf("template did not render valid json")
+	}
+	msg.Body = to.Bytes()
+
+	for k, t := range m.headerTmpls {
+		h, err := providers.Render(t, alert)
+		if err != nil {
+			m.lo.WithError(err).WithField("header", k).Error("Error parsing values in header template")
+			return msg, err
+		}
+		msg.Headers[k] = h
+	}
+
+	return msg, nil
+}
+
+// sendMessage sends the rendered message to the webhook.
+func (m *WebhookManager) sendMessage(msg Message) error {
+	// Prepare the request.
+	req, err := http.NewRequest(m.method, m.endpoint, bytes.NewReader(msg.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypes[m.format])
+	for k, v := range msg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if m.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+m.bearerToken)
+	} else if m.username != "" {
+		req.SetBasicAuth(m.username, m.password)
+	}
+
+	// Send the request.
+	m.lo.WithField("url", m.endpoint).WithField("method", m.method).Debug("sending alert")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Any 2xx response is considered a success.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from webhook endpoint")
+		return providers.NewStatusError(m.ID(), resp)
+	}
+
+	return nil
+}
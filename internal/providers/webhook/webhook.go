@@ -0,0 +1,178 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+// Body formats supported by the webhook provider.
+const (
+	FormatJSON = "json"
+	FormatForm = "form"
+	FormatText = "text"
+)
+
+var contentTypes = map[string]string{
+	FormatJSON: "application/json",
+	FormatForm: "application/x-www-form-urlencoded",
+	FormatText: "text/plain; charset=utf-8",
+}
+
+type WebhookManager struct {
+	lo          *logrus.Logger
+	metrics     *metrics.Manager
+	endpoint    string
+	method      string
+	format      string
+	name        string
+	room        string
+	client      *http.Client
+	retry       *providers.Retrier
+	msgTmpl     *template.Template
+	headerTmpls map[string]*template.Template
+	username    string
+	password    string
+	bearerToken string
+	dryRun      bool
+}
+
+type WebhookOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	Endpoint    string
+	// Method is the HTTP method used for the request. Defaults to POST.
+	Method string
+	// Format is one of `json`, `form` or `text`. Defaults to `json`.
+	Format string
+	// Name is the unique name of the provider in the config.
+	Name     string
+	Room     string
+	Template string
+	// Headers are added to each request. The values are rendered
+	// as templates with the alert data.
+	Headers           map[string]string
+	BasicAuthUsername string
+	BasicAuthPassword string
+	BearerToken       string
+}
+
+// NewWebhook initializes a generic webhook provider object.
+func NewWebhook(opts WebhookOpts) (*WebhookManager, error) {
+	if opts.Method == "" {
+		opts.Method = http.MethodPost
+	}
+	if opts.Format == "" {
+		opts.Format = FormatJSON
+	}
+	if _, ok := contentTypes[opts.Format]; !ok {
+		return nil, fmt.Errorf("unknown body format: %s", opts.Format)
+	}
+	if opts.BearerToken != "" && opts.BasicAuthUsername != "" {
+		return nil, fmt.Errorf("only one of basic auth and bearer token can be set")
+	}
+
+	// Initialise a generic HTTP Client for communicating with the webhook.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the body template.
+	tmpl, err := providers.LoadTemplate(opts.Template, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the header value templates.
+	headers := make(map[string]*template.Template, len(opts.Headers))
+	for k, v := range opts.Headers {
+		t, err := providers.NewTemplate(k, v)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing header template %s: %v", k, err)
+		}
+		headers[k] = t
+	}
+
+	return &WebhookManager{
+		lo:          opts.Log,
+		metrics:     opts.Metrics,
+		retry:       providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "webhook", opts.Name, opts.Room),
+		client:      client,
+		endpoint:    opts.Endpoint,
+		method:      strings.ToUpper(opts.Method),
+		format:      opts.Format,
+		name:        opts.Name,
+		room:        opts.Room,
+		msgTmpl:     tmpl,
+		headerTmpls: headers,
+		username:    opts.BasicAuthUsername,
+		password:    opts.BasicAuthPassword,
+		bearerToken: opts.BearerToken,
+		dryRun:      opts.DryRun,
+	}, nil
+}
+
+// Push accepts the list of alerts and sends a request for each of them to the webhook.
+func (m *WebhookManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to webhook")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		msg, err := m.prepareMessage(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Send message to API.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			if err := m.retry.Do(func() error { return m.sendMessage(msg) }); err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				// Only the body is kept since the headers may have credentials.
+				perr.Add(a, string(msg.Body), err)
+				continue
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *WebhookManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *WebhookManager) ID() string {
+	return "webhook"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *WebhookManager) Name() string {
+	return m.name
+}
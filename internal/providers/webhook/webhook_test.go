@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookPush(t *testing.T) {
+	var (
+		method  string
+		headers http.Header
+		body    []byte
+		fails   int
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		headers = r.Header
+		body, _ = io.ReadAll(r.Body)
+
+		if r.URL.Path == "/fail" {
+			fails++
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	m := metrics.New("calert")
+	hook, err := NewWebhook(WebhookOpts{
+		Log:      logrus.New(),
+		Metrics:  m,
+		Endpoint: srv.URL,
+		Method:   "put",
+		Name:     "qa_hook",
+		Room:     "qa",
+		Template: "../../../static/webhook.tmpl",
+		Headers: map[string]string{
+			"X-Static":   "calert",
+			"X-Severity": "{{ .Labels.severity }}",
+			"X-Team":     "team-{{ .Labels.team }}",
+		},
+		BearerToken: "secret",
+		Retry:       providers.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "high", "alertname": "TestAlert",
+		}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"summary": `disk "/" is full`,
+		}),
+		Fingerprint: "1a956348d0570965",
+	}
+
+	if err := hook.Push([]alertmgrtmpl.Alert{alert}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "application/json", headers.Get("Content-Type"))
+	assert.Equal(t, "calert", headers.Get("X-Static"))
+	assert.Equal(t, "high", headers.Get("X-Severity"))
+	// Missing labels are rendered as empty strings.
+	assert.Equal(t, "team-", headers.Get("X-Team"))
+	assert.Equal(t, "Bearer secret", headers.Get("Authorization"))
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1a956348d0570965", out["fingerprint"])
+	assert.Equal(t, `disk "/" is full`, out["annotations"].(map[string]interface{})["summary"])
+
+	// Failed requests are retried, counted and returned as errors.
+	hook.endpoint = srv.URL + "/fail"
+	err = hook.Push([]alertmgrtmpl.Alert{alert})
+	var perr *providers.PushError
+	if assert.ErrorAs(t, err, &perr) {
+		assert.Equal(t, 1, perr.Failed)
+		// The failed alert is kept with the rendered body and the number of attempts.
+		if assert.Len(t, perr.Failures, 1) {
+			assert.Equal(t, "1a956348d0570965", perr.Failures[0].Alert.Fingerprint)
+			assert.Contains(t, perr.Failures[0].Message, `"fingerprint": "1a956348d0570965"`)
+			assert.Equal(t, 3, providers.Attempts(perr.Failures[0].Err))
+		}
+	}
+	assert.Equal(t, 3, fails)
+
+	var buf bytes.Buffer
+	m.FlushMetrics(&buf)
+	assert.Contains(t, buf.String(), `calert_alerts_dispatched_total{provider="webhook", name="qa_hook", room="qa"} 2`)
+	assert.Contains(t, buf.String(), `calert_alerts_dispatched_errors_total{provider="webhook", name="qa_hook", room="qa"} 1`)
+	assert.Contains(t, buf.String(), `calert_alerts_dispatch_retries_total{provider="webhook", name="qa_hook", room="qa"} 2`)
+	assert.Contains(t, buf.String(), `calert_alerts_dispatch_retries_exhausted_total{provider="webhook", name="qa_hook", room="qa"} 1`)
+}
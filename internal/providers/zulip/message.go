@@ -0,0 +1,155 @@
+package zulip
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/providers"
+)
+
+const (
+	// Topics longer than this are rejected by Zulip.
+	maxTopicSize = 60
+	// threadIDSize is the number of characters of the thread UUID used in topics.
+	threadIDSize = 8
+)
+
+// topicData is passed to the topic template.
+type topicData struct {
+	alertmgrtmpl.Alert
+	// ThreadID is a short prefix of the UUID of the alert in the active alerts map.
+	ThreadID string
+}
+
+// Message represents the parameters for sending a stream message.
+// https://zulip.com/api/send-message
+type Message struct {
+	Stream  string
+	Topic   string
+	Content string
+}
+
+// prepareMessage renders the topic for the thread `uuid` and the message content.
+func (m *ZulipManager) prepareMessage(alert alertmgrtmpl.Alert, uuid string) (Message, error) {
+	var (
+		topic, content bytes.Buffer
+		msg            = Message{Stream: m.stream}
+	)
+
+	if len(uuid) > threadIDSize {
+		uuid = uuid[:threadIDSize]
+	}
+	if err := m.topicTmpl.Execute(&topic, topicData{Alert: alert, ThreadID: uuid}); err != nil {
+		m.lo.WithError(err).Error("Error parsing values in topic template")
+		return msg, err
+	}
+	msg.Topic = strings.TrimSpace(topic.String())
+	if msg.Topic == "" {
+		return msg, errors.New("topic is empty")
+	}
+	msg.Topic = truncateTopic(msg.Topic, uuid)
+
+	// Render the template with alert data.
+	if err := m.msgTmpl.Execute(&content, alert); err != nil {
+		m.lo.WithError(err).Error("Error parsing values in template")
+		return msg, err
+	}
+	msg.Content = content.String()
+
+	return msg, nil
+}
+
+// truncateTopic trims the topic to the size accepted by Zulip. If the topic
+// contains the thread ID, the word with it is kept at the end and the text
+// before it is trimmed instead, so that different alert instances don't end up
+// in the same topic. If the word doesn't fit, it's cut just before the ID and
+// the separator preceding it (eg `#`).
+func truncateTopic(topic, threadID string) string {
+	r := []rune(topic)
+	if len(r) <= maxTopicSize {
+		return topic
+	}
+
+	if i := strings.LastIndex(topic, threadID); threadID != "" && i >= 0 {
+		var (
+			start = strings.LastIndexAny(topic[:i], " \t") + 1
+			sep   = " "
+		)
+		if len([]rune(topic[start:])) >= maxTopicSize {
+			start, sep = i, ""
+			for start > 0 {
+				c, size := utf8.DecodeLastRuneInString(topic[:start])
+				if unicode.IsLetter(c) || unicode.IsDigit(c) || unicode.IsSpace(c) {
+					break
+				}
+				start -= size
+			}
+		}
+
+		head, suffix := []rune(strings.TrimSpace(topic[:start])), []rune(topic[start:])
+		if len(suffix) > maxTopicSize {
+			// The ID is at the start of the topic, so the text after it is cut.
+			return string(suffix[:maxTopicSize])
+		}
+		if n := maxTopicSize - len(suffix) - len(sep); len(head) > n {
+			head = head[:n]
+		}
+		if head := strings.TrimSpace(string(head)); head != "" {
+			return head + sep + string(suffix)
+		}
+		return string(suffix)
+	}
+
+	return string(r[:maxTopicSize])
+}
+
+// sendMessage sends the message to the stream.
+func (m *ZulipManager) sendMessage(msg Message) error {
+	form := url.Values{}
+	form.Set("type", "stream")
+	form.Set("to", msg.Stream)
+	form.Set("topic", msg.Topic)
+	form.Set("content", msg.Content)
+
+	// Prepare the request.
+	req, err := http.NewRequest("POST", m.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(m.botEmail, m.apiKey)
+
+	// Send the request.
+	m.lo.WithField("msg", msg).Debug("sending alert")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// If response is non 200, log and throw the error.
+	if resp.StatusCode != http.StatusOK {
+		m.lo.WithField("status", resp.StatusCode).Error("Non OK HTTP Response received from Zulip API")
+		return providers.NewStatusError(m.ID(), resp)
+	}
+
+	var r struct {
+		Result string `json:"result"`
+		Msg    string `json:"msg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	if r.Result != "success" {
+		return errors.New("error from zulip: " + r.Msg)
+	}
+
+	return nil
+}
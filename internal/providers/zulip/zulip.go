@@ -0,0 +1,168 @@
+package zulip
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/shpeliving/calert/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultTopic puts each alert instance in its own topic, so that the
+	// resolved notification lands in the same topic as the firing one.
+	defaultTopic = `{{ .Labels.alertname }} #{{ .ThreadID }}`
+)
+
+type ZulipManager struct {
+	lo           *logrus.Logger
+	metrics      *metrics.Manager
+	activeAlerts *providers.ActiveAlerts
+	endpoint     string
+	botEmail     string
+	apiKey       string
+	stream       string
+	name         string
+	room         string
+	client       *http.Client
+	retry        *providers.Retrier
+	topicTmpl    *template.Template
+	msgTmpl      *template.Template
+	dryRun       bool
+}
+
+type ZulipOpts struct {
+	Log         *logrus.Logger
+	Metrics     *metrics.Manager
+	DryRun      bool
+	MaxIdleConn int
+	Timeout     time.Duration
+	ProxyURL    string
+	Retry       providers.RetryPolicy
+	// Site is the base URL of the Zulip organization, eg https://example.zulipchat.com.
+	Site string
+	// BotEmail and APIKey are the credentials of the bot posting the messages.
+	BotEmail string
+	APIKey   string
+	Stream   string
+	// Name is the unique name of the provider in the config.
+	Name string
+	Room string
+	// Topic is a template string for the topic. `.ThreadID` is available along
+	// with the alert fields.
+	Topic     string
+	Template  string
+	ThreadTTL time.Duration
+}
+
+// NewZulip initializes a Zulip provider object.
+func NewZulip(opts ZulipOpts) (*ZulipManager, error) {
+	if opts.Site == "" || opts.BotEmail == "" || opts.APIKey == "" || opts.Stream == "" {
+		return nil, fmt.Errorf("site, bot_email, api_key and stream are required")
+	}
+	if opts.Topic == "" {
+		opts.Topic = defaultTopic
+	}
+
+	// Initialise a generic HTTP Client for communicating with the Zulip API.
+	client, err := providers.NewHTTPClient(opts.Timeout, opts.MaxIdleConn, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the templates.
+	topicTmpl, err := providers.NewTemplate("topic", opts.Topic)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing topic template: %v", err)
+	}
+	tmpl, err := providers.LoadTemplate(opts.Template, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := &ZulipManager{
+		lo:           opts.Log,
+		metrics:      opts.Metrics,
+		retry:        providers.NewRetrier(opts.Retry, opts.Log, opts.Metrics, "zulip", opts.Name, opts.Room),
+		client:       client,
+		endpoint:     strings.TrimSuffix(opts.Site, "/") + "/api/v1/messages",
+		botEmail:     opts.BotEmail,
+		apiKey:       opts.APIKey,
+		stream:       opts.Stream,
+		name:         opts.Name,
+		room:         opts.Room,
+		activeAlerts: providers.NewActiveAlerts(opts.Log, opts.Metrics),
+		topicTmpl:    topicTmpl,
+		msgTmpl:      tmpl,
+		dryRun:       opts.DryRun,
+	}
+	// Start a background worker to cleanup alerts based on TTL mechanism.
+	go mgr.activeAlerts.StartPruneWorker(1*time.Hour, opts.ThreadTTL)
+
+	return mgr, nil
+}
+
+// Push accepts the list of alerts and sends them to the stream. All the messages
+// for an alert are posted to the same topic until its thread TTL expires.
+func (m *ZulipManager) Push(alerts []alertmgrtmpl.Alert) error {
+	m.lo.WithField("count", len(alerts)).Info("dispatching alerts to zulip")
+
+	perr := &providers.PushError{Provider: m.ID()}
+
+	for _, a := range alerts {
+		// If it's a new alert whose fingerprint isn't in the active alerts map, add it first.
+		details, err := m.activeAlerts.GetOrAdd(a)
+		if err != nil {
+			m.lo.WithError(err).Error("error adding active alert")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		msg, err := m.prepareMessage(a, details.UUID.String())
+		if err != nil {
+			m.lo.WithError(err).Error("error preparing message")
+			perr.Add(a, nil, err)
+			continue
+		}
+
+		now := time.Now()
+
+		m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+
+		// Send message to API.
+		if m.dryRun {
+			m.lo.WithField("room", m.Room()).Info("dry_run is enabled for this room. skipping pushing notification")
+		} else {
+			if err := m.retry.Do(func() error { return m.sendMessage(msg) }); err != nil {
+				m.metrics.Increment(fmt.Sprintf(`alerts_dispatched_errors_total{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()))
+				m.lo.WithError(err).Error("error sending message")
+				perr.Add(a, msg, err)
+				continue
+			}
+		}
+
+		m.metrics.Duration(fmt.Sprintf(`alerts_dispatched_duration_seconds{provider="%s", name="%s", room="%s"}`, m.ID(), m.Name(), m.Room()), now)
+	}
+
+	return perr.OrNil()
+}
+
+// Room returns the name of room for which this provider is configured.
+func (m *ZulipManager) Room() string {
+	return m.room
+}
+
+// ID returns the provider name.
+func (m *ZulipManager) ID() string {
+	return "zulip"
+}
+
+// Name returns the unique name of the provider in the config.
+func (m *ZulipManager) Name() string {
+	return m.name
+}
@@ -0,0 +1,165 @@
+package zulip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZulipTopicThreading(t *testing.T) {
+	var received []url.Values
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/messages", r.URL.Path)
+
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "calert-bot@example.zulipchat.com", user)
+		assert.Equal(t, "test-key", pass)
+
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, r.PostForm)
+
+		w.Write([]byte(`{"result":"success","msg":"","id":42}`))
+	}))
+	defer srv.Close()
+
+	z, err := NewZulip(ZulipOpts{
+		Log:      logrus.New(),
+		Metrics:  metrics.New("calert"),
+		Site:     srv.URL,
+		BotEmail: "calert-bot@example.zulipchat.com",
+		APIKey:   "test-key",
+		Stream:   "alerts",
+		Room:     "qa",
+		Template: "../../../static/message.tmpl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "high", "alertname": "TestAlert",
+		}),
+		Annotations: alertmgrtmpl.KV{},
+		Fingerprint: "1a956348d0570965",
+	}
+	other := alert
+	other.Fingerprint = "c0ffee"
+	resolved := alert
+	resolved.Status = "resolved"
+
+	if err := z.Push([]alertmgrtmpl.Alert{alert, other, resolved}); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, received, 3) {
+		threadID := z.activeAlerts.Lookup(alert.Fingerprint)[:threadIDSize]
+
+		assert.Equal(t, "stream", received[0].Get("type"))
+		assert.Equal(t, "alerts", received[0].Get("to"))
+		assert.Equal(t, "TestAlert #"+threadID, received[0].Get("topic"))
+		assert.NotEqual(t, received[0].Get("topic"), received[1].Get("topic"))
+		// The resolved message lands in the same topic.
+		assert.Equal(t, received[0].Get("topic"), received[2].Get("topic"))
+		assert.Contains(t, received[2].Get("content"), "Resolved")
+	}
+}
+
+func TestZulipTopicTemplate(t *testing.T) {
+	z, err := NewZulip(ZulipOpts{
+		Log:      logrus.New(),
+		Site:     "https://example.zulipchat.com",
+		BotEmail: "calert-bot@example.zulipchat.com",
+		APIKey:   "test-key",
+		Stream:   "alerts",
+		Topic:    "{{ .Labels.env }} / {{ .Labels.alertname }} / {{ .Annotations.summary }}",
+		Template: "../../../static/message.tmpl",
+		DryRun:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{"severity": "high", "alertname": "TestAlert"}),
+		Annotations: alertmgrtmpl.KV(map[string]string{
+			"summary": "a very long summary which doesn't fit in the topic of a zulip message",
+		}),
+	}
+
+	msg, err := z.prepareMessage(alert, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Missing labels are rendered as empty and the topic is truncated.
+	assert.Equal(t, "/ TestAlert / a very long summary which doesn't fit in the t", msg.Topic)
+}
+
+func TestZulipTopicLongAlertname(t *testing.T) {
+	z, err := NewZulip(ZulipOpts{
+		Log:      logrus.New(),
+		Site:     "https://example.zulipchat.com",
+		BotEmail: "calert-bot@example.zulipchat.com",
+		APIKey:   "test-key",
+		Stream:   "alerts",
+		Template: "../../../static/message.tmpl",
+		DryRun:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := alertmgrtmpl.Alert{
+		Status: "firing",
+		Labels: alertmgrtmpl.KV(map[string]string{
+			"severity": "high", "alertname": "KubernetesPersistentVolumeFillingUpInTheNextFourDaysOnProductionCluster",
+		}),
+		Annotations: alertmgrtmpl.KV{},
+	}
+
+	first, err := z.prepareMessage(alert, "1a956348-d057-0965-0000-000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := z.prepareMessage(alert, "c0ffee00-d057-0965-0000-000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The alertname is truncated and the thread ID is kept at the end.
+	assert.Equal(t, "KubernetesPersistentVolumeFillingUpInTheNextFourDa #1a956348", first.Topic)
+	assert.Len(t, []rune(first.Topic), maxTopicSize)
+	assert.Equal(t, "KubernetesPersistentVolumeFillingUpInTheNextFourDa #c0ffee00", second.Topic)
+}
+
+func TestTruncateTopic(t *testing.T) {
+	long := "KubernetesPersistentVolumeFillingUpInTheNextFourDaysOnProductionCluster"
+	for _, c := range []struct {
+		topic, want string
+	}{
+		{"TestAlert #1a956348", "TestAlert #1a956348"},
+		{long + " #1a956348", "KubernetesPersistentVolumeFillingUpInTheNextFourDa #1a956348"},
+		// The word with the ID doesn't fit, so the ID and its separator are kept.
+		{long + "#1a956348", "KubernetesPersistentVolumeFillingUpInTheNextFourDay#1a956348"},
+		{"prod / " + long + "/#1a956348", "prod / KubernetesPersistentVolumeFillingUpInTheNex/#1a956348"},
+		{long + "1a956348", "KubernetesPersistentVolumeFillingUpInTheNextFourDays1a956348"},
+		// The ID is at the start.
+		{"1a956348 " + long, "1a956348 KubernetesPersistentVolumeFillingUpInTheNextFourDay"},
+		{"1a956348" + long, "1a956348KubernetesPersistentVolumeFillingUpInTheNextFourDays"},
+	} {
+		got := truncateTopic(c.topic, "1a956348")
+		assert.Equal(t, c.want, got, c.topic)
+		assert.LessOrEqual(t, len([]rune(got)), maxTopicSize)
+	}
+}
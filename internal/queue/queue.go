@@ -0,0 +1,486 @@
+// Package queue is a file backed write-ahead queue for the payloads accepted on
+// `/dispatch`. Each entry is written to its own file in the queue directory before
+// the request is acknowledged and the file is removed once the entry is dispatched.
+// Entries which are left in the directory (eg if calert restarted mid-send) are
+// replayed on startup.
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	entrySuffix   = ".json"
+	corruptSuffix = ".corrupt"
+
+	// DefaultMaxSize is the max number of entries if it isn't configured.
+	DefaultMaxSize = 1000
+	// DefaultRetryDelay is the wait before an entry is dispatched again if the
+	// handler asks to retry it later.
+	DefaultRetryDelay = 1 * time.Minute
+)
+
+// ErrFull is returned by Enqueue when the queue has MaxSize entries.
+var ErrFull = errors.New("queue is full")
+
+// Entry is a payload accepted for dispatch.
+type Entry struct {
+	// ID is ordered by the time the entry was queued.
+	ID       string            `json:"id"`
+	Room     string            `json:"room"`
+	Payload  alertmgrtmpl.Data `json:"payload"`
+	QueuedAt time.Time         `json:"queued_at"`
+	// Targets are the providers and alerts left to send when the entry is retried.
+	// The payload is dispatched to the providers of the room if it's empty.
+	Targets []Target `json:"targets,omitempty"`
+	// Attempts is the number of times the entry was retried after a failure.
+	Attempts int `json:"attempts,omitempty"`
+	// RetryAfter is the wait before the entry is retried. The retry delay of the
+	// queue is used if it's 0.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// Target is a provider and the alerts to send to it.
+type Target struct {
+	// Name is the unique name of the provider in the config.
+	Name   string               `json:"name"`
+	Room   string               `json:"room"`
+	Alerts []alertmgrtmpl.Alert `json:"alerts"`
+}
+
+// Outcome is the result of dispatching an entry.
+type Outcome int
+
+const (
+	// Sent means the entry was dispatched. It's removed from the queue.
+	Sent Outcome = iota
+	// Failed means the entry can't be dispatched and isn't retried. It's removed
+	// from the queue.
+	Failed
+	// Retry means the entry couldn't be dispatched yet. It's kept on disk and
+	// dispatched again after its RetryAfter.
+	Retry
+)
+
+// Handler dispatches an entry and returns the outcome. Before returning Retry,
+// it can update the Targets, Attempts and RetryAfter of the entry.
+type Handler func(e *Entry) Outcome
+
+// Queue holds the entries which haven't been acknowledged yet.
+type Queue struct {
+	dir        string
+	maxSize    int
+	retryDelay time.Duration
+	lo         *logrus.Logger
+	metrics    *metrics.Manager
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []Entry
+	// unacked is the number of entries on disk, including the ones being dispatched.
+	unacked  int
+	inFlight int
+	seq      uint64
+	closed   bool
+	// busy has the fingerprints of the alerts being dispatched or waiting to be
+	// retried. An entry isn't dispatched while another one with the same alerts is,
+	// so the notifications for an alert are sent in the order they were queued.
+	busy map[string]bool
+
+	wg sync.WaitGroup
+}
+
+type Opts struct {
+	Dir string
+	// MaxSize is the max number of unacknowledged entries. 0 means no limit.
+	MaxSize int
+	// RetryDelay is the wait before retrying an entry which doesn't have a RetryAfter.
+	// Defaults to DefaultRetryDelay.
+	RetryDelay time.Duration
+	Log        *logrus.Logger
+	Metrics    *metrics.Manager
+}
+
+// New initialises a queue in `opts.Dir` and loads the entries left over from a
+// previous run so they're replayed once the workers are started.
+func New(opts Opts) (*Queue, error) {
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("queue dir is required")
+	}
+	if err := os.MkdirAll(opts.Dir, 0750); err != nil {
+		return nil, err
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultRetryDelay
+	}
+
+	q := &Queue{
+		dir:        opts.Dir,
+		maxSize:    opts.MaxSize,
+		retryDelay: opts.RetryDelay,
+		lo:         opts.Log,
+		metrics:    opts.Metrics,
+		busy:       make(map[string]bool),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Enqueue writes the payload to disk and queues it for dispatch. The entry is
+// durable once this returns without an error. It returns ErrFull if the queue
+// has MaxSize entries.
+func (q *Queue) Enqueue(room string, payload alertmgrtmpl.Data) (Entry, error) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return Entry{}, fmt.Errorf("queue is closed")
+	}
+	if q.maxSize > 0 && q.unacked >= q.maxSize {
+		q.mu.Unlock()
+		q.metrics.Increment(`dispatch_queue_rejected_total`)
+		return Entry{}, ErrFull
+	}
+	// Reserve the place in the queue while the entry is written.
+	q.unacked++
+	q.seq++
+	e := Entry{
+		ID:       fmt.Sprintf("%019d-%06d", time.Now().UnixNano(), q.seq%1000000),
+		Room:     room,
+		Payload:  payload,
+		QueuedAt: time.Now(),
+	}
+	q.mu.Unlock()
+
+	if err := q.write(e); err != nil {
+		// The entry isn't durable if the directory couldn't be synced. It's removed
+		// since the request fails and Alertmanager sends the alerts again.
+		os.Remove(q.path(e.ID))
+		q.mu.Lock()
+		q.unacked--
+		q.mu.Unlock()
+		return Entry{}, err
+	}
+
+	q.mu.Lock()
+	q.pending = append(q.pending, e)
+	q.setDepth()
+	q.mu.Unlock()
+	q.cond.Signal()
+
+	return e, nil
+}
+
+// InFlight returns the number of entries being dispatched.
+func (q *Queue) InFlight() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.inFlight
+}
+
+// Len returns the number of entries which haven't been acknowledged.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.unacked
+}
+
+// Start starts `workers` goroutines which dispatch the entries with `h` in the
+// order they were queued. Entries with alerts in common are dispatched one at a
+// time, by a single worker. Entries are removed once they're sent or failed,
+// and dispatched again later if the handler returns Retry.
+func (q *Queue) Start(workers int, h Handler) {
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work(h)
+	}
+}
+
+// Close stops accepting new entries and waits for the workers to finish the
+// entries they're dispatching. The entries still in the queue, including the
+// ones waiting to be retried, stay on disk and are replayed on the next start.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+
+	q.wg.Wait()
+}
+
+// work dispatches entries until the queue is closed.
+func (q *Queue) work(h Handler) {
+	defer q.wg.Done()
+
+	for {
+		e, ok := q.next()
+		if !ok {
+			return
+		}
+
+		if h(&e) == Retry {
+			q.retry(e)
+			continue
+		}
+
+		if err := q.ack(e); err != nil {
+			q.lo.WithError(err).WithField("id", e.ID).Error("error acknowledging queue entry")
+		}
+	}
+}
+
+// next blocks until there's an entry to dispatch. It returns false
+// once the queue is closed.
+func (q *Queue) next() (Entry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := -1
+	for !q.closed {
+		if i = q.ready(); i >= 0 {
+			break
+		}
+		q.cond.Wait()
+	}
+	if q.closed {
+		return Entry{}, false
+	}
+
+	e := q.pending[i]
+	q.pending = append(q.pending[:i], q.pending[i+1:]...)
+	for _, fp := range fingerprints(e) {
+		q.busy[fp] = true
+	}
+	q.inFlight++
+	q.metrics.Set(`dispatch_queue_in_flight`, float64(q.inFlight))
+	return e, true
+}
+
+// ready returns the index of the oldest pending entry which has no alerts in
+// common with the entries being dispatched, or with the older pending entries
+// which have to wait for them. It returns -1 if there's no such entry. It must be
+// called with the lock held.
+func (q *Queue) ready() int {
+	var blocked map[string]bool
+	for i, e := range q.pending {
+		fps := fingerprints(e)
+
+		ok := true
+		for _, fp := range fps {
+			if q.busy[fp] || blocked[fp] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return i
+		}
+
+		if blocked == nil {
+			blocked = make(map[string]bool)
+		}
+		for _, fp := range fps {
+			blocked[fp] = true
+		}
+	}
+
+	return -1
+}
+
+// ack removes a dispatched entry from disk.
+func (q *Queue) ack(e Entry) error {
+	err := os.Remove(q.path(e.ID))
+	if os.IsNotExist(err) {
+		err = nil
+	}
+
+	q.mu.Lock()
+	q.unacked--
+	q.inFlight--
+	for _, fp := range fingerprints(e) {
+		delete(q.busy, fp)
+	}
+	q.setDepth()
+	q.metrics.Set(`dispatch_queue_in_flight`, float64(q.inFlight))
+	q.mu.Unlock()
+	// Wake up the workers waiting for the entries with the same alerts.
+	q.cond.Broadcast()
+
+	return err
+}
+
+// retry writes the updated entry to disk and queues it again after its RetryAfter.
+// Its alerts stay busy in the meantime, so the entries queued after it with the
+// same alerts wait for it. If the queue is closed first, the entry is left on
+// disk to be replayed on the next start.
+func (q *Queue) retry(e Entry) {
+	delay := e.RetryAfter
+	if delay <= 0 {
+		delay = q.retryDelay
+	}
+	e.RetryAfter = 0
+
+	// The previous version of the entry stays on disk if it can't be written.
+	if err := q.write(e); err != nil {
+		q.lo.WithError(err).WithField("id", e.ID).Error("error updating queue entry")
+	}
+
+	q.mu.Lock()
+	q.inFlight--
+	q.metrics.Set(`dispatch_queue_in_flight`, float64(q.inFlight))
+	q.mu.Unlock()
+	q.metrics.Increment(`dispatch_queue_retried_total`)
+
+	time.AfterFunc(delay, func() {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		for _, fp := range fingerprints(e) {
+			delete(q.busy, fp)
+		}
+		// Keep the pending entries in the order they were queued.
+		i := sort.Search(len(q.pending), func(i int) bool { return q.pending[i].ID > e.ID })
+		q.pending = append(q.pending, Entry{})
+		copy(q.pending[i+1:], q.pending[i:])
+		q.pending[i] = e
+		q.mu.Unlock()
+		q.cond.Broadcast()
+	})
+}
+
+// write writes the entry to a temporary file and renames it once it's synced to
+// disk, so a crash never leaves a partially written entry behind.
+func (q *Queue) write(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(q.dir, "."+e.ID+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, q.path(e.ID)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return syncDir(q.dir)
+}
+
+// load reads the entries in the queue directory in the order they were queued.
+// Temporary files from interrupted writes are removed and entries which can't
+// be decoded are renamed with a `.corrupt` suffix.
+func (q *Queue) load() error {
+	files, err := os.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+
+	// ReadDir returns the files sorted by name, which is the order of the IDs.
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".tmp") {
+			os.Remove(filepath.Join(q.dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, entrySuffix) {
+			continue
+		}
+
+		path := filepath.Join(q.dir, name)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var e Entry
+		if err := json.Unmarshal(b, &e); err != nil {
+			q.lo.WithError(err).WithField("file", name).Error("error decoding queue entry, skipping")
+			os.Rename(path, path+corruptSuffix)
+			continue
+		}
+		q.pending = append(q.pending, e)
+	}
+
+	q.unacked = len(q.pending)
+	q.setDepth()
+	if len(q.pending) > 0 {
+		q.lo.WithField("count", len(q.pending)).Info("replaying unacknowledged alerts from queue")
+		q.metrics.Set(`dispatch_queue_replayed`, float64(len(q.pending)))
+	}
+
+	return nil
+}
+
+// setDepth exports the number of unacknowledged entries. It must be called
+// with the lock held.
+func (q *Queue) setDepth() {
+	q.metrics.Set(`dispatch_queue_depth`, float64(q.unacked))
+}
+
+// fingerprints returns the fingerprints of the alerts in the entry.
+func fingerprints(e Entry) []string {
+	out := make([]string, 0, len(e.Payload.Alerts))
+	for _, a := range e.Payload.Alerts {
+		if a.Fingerprint != "" {
+			out = append(out, a.Fingerprint)
+		}
+	}
+	return out
+}
+
+func (q *Queue) path(id string) string {
+	return filepath.Join(q.dir, id+entrySuffix)
+}
+
+// syncDir flushes the directory entry of a renamed file to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
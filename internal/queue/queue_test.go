@@ -0,0 +1,283 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	alertmgrtmpl "github.com/prometheus/alertmanager/template"
+	"github.com/shpeliving/calert/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newQueue(t *testing.T, dir string) *Queue {
+	t.Helper()
+
+	q, err := New(Opts{Dir: dir, Log: logrus.New(), Metrics: metrics.New("calert")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestDispatch(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		q    = newQueue(t, dir)
+		mu   sync.Mutex
+		got  []string
+		done = make(chan struct{})
+	)
+
+	q.Start(1, func(e *Entry) Outcome {
+		mu.Lock()
+		got = append(got, e.Room)
+		n := len(got)
+		mu.Unlock()
+		if n == 2 {
+			close(done)
+		}
+		return Sent
+	})
+
+	for _, room := range []string{"prod", "dev"} {
+		if _, err := q.Enqueue(room, alertmgrtmpl.Data{Receiver: room}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for entries to be dispatched")
+	}
+	q.Close()
+
+	assert.Equal(t, []string{"prod", "dev"}, got)
+	assert.Equal(t, 0, q.Len())
+
+	files, _ := os.ReadDir(dir)
+	assert.Empty(t, files, "dispatched entries are removed from disk")
+}
+
+func TestDispatchOrder(t *testing.T) {
+	var (
+		q       = newQueue(t, t.TempDir())
+		started = make(chan string, 3)
+		release = make(chan struct{})
+	)
+
+	q.Start(3, func(e *Entry) Outcome {
+		started <- e.Payload.Receiver
+		if e.Payload.Receiver == "firing" {
+			<-release
+		}
+		return Sent
+	})
+
+	for _, p := range []struct{ receiver, fingerprint string }{
+		{"firing", "1a956348d0570965"},
+		{"other", "c0ffee"},
+		{"resolved", "1a956348d0570965"},
+	} {
+		payload := alertmgrtmpl.Data{
+			Receiver: p.receiver,
+			Alerts:   alertmgrtmpl.Alerts{{Fingerprint: p.fingerprint}},
+		}
+		if _, err := q.Enqueue("prod", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wait := func() string {
+		select {
+		case r := <-started:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for entries to be dispatched")
+		}
+		return ""
+	}
+
+	// Entries for other alerts are dispatched by the other workers in the meantime,
+	// but the resolved notification waits for the firing one to be sent.
+	assert.ElementsMatch(t, []string{"firing", "other"}, []string{wait(), wait()})
+	select {
+	case r := <-started:
+		t.Fatalf("%s dispatched before the firing notification was sent", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	assert.Equal(t, "resolved", wait())
+	q.Close()
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestRetry(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		started = make(chan Entry, 3)
+	)
+	q, err := New(Opts{Dir: dir, RetryDelay: 50 * time.Millisecond, Log: logrus.New(), Metrics: metrics.New("calert")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first entry is retried once with the alerts left to send, and the entry
+	// for the same alert queued after it waits for it.
+	target := Target{Name: "prod_slack", Room: "prod", Alerts: alertmgrtmpl.Alerts{{Fingerprint: "1a956348d0570965"}}}
+	q.Start(2, func(e *Entry) Outcome {
+		started <- *e
+		if e.Payload.Receiver == "firing" && e.Attempts == 0 {
+			e.Targets = []Target{target}
+			e.Attempts++
+			return Retry
+		}
+		return Sent
+	})
+
+	for _, receiver := range []string{"firing", "resolved"} {
+		payload := alertmgrtmpl.Data{
+			Receiver: receiver,
+			Alerts:   alertmgrtmpl.Alerts{{Fingerprint: "1a956348d0570965"}},
+		}
+		if _, err := q.Enqueue("prod", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []Entry
+	for i := 0; i < 3; i++ {
+		select {
+		case e := <-started:
+			got = append(got, e)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for entries to be dispatched")
+		}
+	}
+	q.Close()
+
+	assert.Equal(t, "firing", got[0].Payload.Receiver)
+	assert.Equal(t, "firing", got[1].Payload.Receiver)
+	assert.Equal(t, 1, got[1].Attempts)
+	assert.Equal(t, []Target{target}, got[1].Targets)
+	assert.Equal(t, "resolved", got[2].Payload.Receiver)
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestRetryAfterClose(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		q       = newQueue(t, dir)
+		started = make(chan struct{})
+	)
+
+	q.Start(1, func(e *Entry) Outcome {
+		close(started)
+		e.Attempts++
+		return Retry
+	})
+	if _, err := q.Enqueue("prod", alertmgrtmpl.Data{Receiver: "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	q.Close()
+
+	// The entry is kept on disk with the updates and replayed on the next start.
+	q = newQueue(t, dir)
+	assert.Equal(t, 1, q.Len())
+	assert.Equal(t, 1, q.pending[0].Attempts)
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	// Queue entries without any workers, like a restart before they're dispatched.
+	q := newQueue(t, dir)
+	for _, room := range []string{"a", "b", "c"} {
+		if _, err := q.Enqueue(room, alertmgrtmpl.Data{Receiver: room}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Close()
+
+	_, err := q.Enqueue("d", alertmgrtmpl.Data{})
+	assert.Error(t, err, "closed queue rejects entries")
+
+	// Leftovers from an interrupted write and corrupt entries are skipped.
+	os.WriteFile(filepath.Join(dir, ".0000000000000000001-000001.tmp"), []byte(`{"id":`), 0640)
+	os.WriteFile(filepath.Join(dir, "0000000000000000001-000002.json"), []byte(`{"id":`), 0640)
+
+	q = newQueue(t, dir)
+	assert.Equal(t, 3, q.Len())
+
+	var (
+		got  []Entry
+		done = make(chan struct{})
+	)
+	q.Start(1, func(e *Entry) Outcome {
+		got = append(got, *e)
+		if len(got) == 3 {
+			close(done)
+		}
+		return Failed
+	})
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for entries to be replayed")
+	}
+	q.Close()
+
+	for i, room := range []string{"a", "b", "c"} {
+		assert.Equal(t, room, got[i].Room)
+		assert.Equal(t, room, got[i].Payload.Receiver)
+	}
+
+	files, _ := os.ReadDir(dir)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, "0000000000000000001-000002.json"+corruptSuffix, files[0].Name())
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	q, err := New(Opts{Dir: t.TempDir(), MaxSize: 2, Log: logrus.New(), Metrics: metrics.New("calert")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := q.Enqueue("prod", alertmgrtmpl.Data{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = q.Enqueue("prod", alertmgrtmpl.Data{})
+	assert.ErrorIs(t, err, ErrFull)
+
+	// The place in the queue is freed once an entry is dispatched.
+	var (
+		release = make(chan struct{})
+		started = make(chan struct{}, 2)
+	)
+	q.Start(1, func(e *Entry) Outcome {
+		started <- struct{}{}
+		<-release
+		return Sent
+	})
+	<-started
+	assert.Equal(t, 1, q.InFlight())
+	assert.Equal(t, 2, q.Len())
+
+	release <- struct{}{}
+	<-started
+	_, err = q.Enqueue("prod", alertmgrtmpl.Data{})
+	assert.NoError(t, err)
+
+	close(release)
+	q.Close()
+	assert.Equal(t, 0, q.InFlight())
+}
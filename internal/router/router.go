@@ -0,0 +1,120 @@
+// Package router picks the rooms to send alerts to based on an ordered list of
+// routes with Alertmanager style label and annotation matchers.
+package router
+
+import (
+	"fmt"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+)
+
+// Route sends the alerts matching all of its matchers to a room.
+type Route struct {
+	Room string
+	// Matchers are evaluated against the labels and AnnotationMatchers
+	// against the annotations. Missing labels and annotations are matched as
+	// empty strings, like in Alertmanager.
+	Matchers           []*labels.Matcher
+	AnnotationMatchers []*labels.Matcher
+	// Continue evaluates the routes after this one even if it matches.
+	Continue bool
+}
+
+// Router holds the list of routes in the order they're evaluated.
+type Router struct {
+	routes      []Route
+	defaultRoom string
+}
+
+// NewRoute parses the matchers (eg `severity=~"critical|high"`) and returns a route.
+func NewRoute(room string, matchers, annotationMatchers []string, cont bool) (Route, error) {
+	if room == "" {
+		return Route{}, fmt.Errorf("room is required")
+	}
+
+	r := Route{Room: room, Continue: cont}
+	for _, s := range matchers {
+		m, err := labels.ParseMatcher(s)
+		if err != nil {
+			return r, fmt.Errorf("error parsing matcher %q: %v", s, err)
+		}
+		r.Matchers = append(r.Matchers, m)
+	}
+	for _, s := range annotationMatchers {
+		m, err := labels.ParseMatcher(s)
+		if err != nil {
+			return r, fmt.Errorf("error parsing annotation matcher %q: %v", s, err)
+		}
+		r.AnnotationMatchers = append(r.AnnotationMatchers, m)
+	}
+
+	return r, nil
+}
+
+// Matches returns true if all the matchers of the route match. A route
+// without matchers matches everything.
+func (r Route) Matches(lbls, annotations map[string]string) bool {
+	for _, m := range r.Matchers {
+		if !m.Matches(lbls[m.Name]) {
+			return false
+		}
+	}
+	for _, m := range r.AnnotationMatchers {
+		if !m.Matches(annotations[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// New returns a router. `defaultRoom` is used if none of the routes match.
+func New(routes []Route, defaultRoom string) *Router {
+	return &Router{
+		routes:      routes,
+		defaultRoom: defaultRoom,
+	}
+}
+
+// Rooms returns the rooms referred to by the routes and the default room.
+func (r *Router) Rooms() []string {
+	var out []string
+	for _, rt := range r.routes {
+		out = append(out, rt.Room)
+	}
+	if r.defaultRoom != "" {
+		out = append(out, r.defaultRoom)
+	}
+	return out
+}
+
+// Match evaluates the routes in order and returns the rooms of the matching routes.
+// Evaluation stops at the first matching route, unless it has `continue` set. If no
+// route matches, the default room is returned, or `fallback` (the room from the
+// request) if there's no default room.
+func (r *Router) Match(lbls, annotations map[string]string, fallback string) []string {
+	var (
+		rooms []string
+		seen  = make(map[string]bool)
+	)
+	for _, rt := range r.routes {
+		if !rt.Matches(lbls, annotations) {
+			continue
+		}
+
+		if !seen[rt.Room] {
+			rooms = append(rooms, rt.Room)
+			seen[rt.Room] = true
+		}
+		if !rt.Continue {
+			break
+		}
+	}
+
+	if len(rooms) > 0 {
+		return rooms
+	}
+	if r.defaultRoom != "" {
+		return []string{r.defaultRoom}
+	}
+	return []string{fallback}
+}
@@ -0,0 +1,57 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterMatch(t *testing.T) {
+	routes := []struct {
+		room        string
+		matchers    []string
+		annotations []string
+		cont        bool
+	}{
+		{"audit", nil, nil, true},
+		{"db", []string{`team="db"`, `severity=~"critical|high"`}, nil, false},
+		{"runbooks", []string{`team!="db"`}, []string{`runbook_url!=""`}, true},
+		{"infra", []string{`team=~"infra|sre"`, `env!~"dev|staging"`}, nil, false},
+	}
+
+	var rts []Route
+	for _, r := range routes {
+		rt, err := NewRoute(r.room, r.matchers, r.annotations, r.cont)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rts = append(rts, rt)
+	}
+
+	r := New(rts, "")
+	assert.Equal(t, []string{"audit", "db", "runbooks", "infra"}, r.Rooms())
+
+	cases := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		want        []string
+	}{
+		{"stops at first match", map[string]string{"team": "db", "severity": "critical"}, nil, []string{"audit", "db"}},
+		{"regex doesn't match", map[string]string{"team": "db", "severity": "warning"}, nil, []string{"audit"}},
+		{"continue", map[string]string{"team": "sre", "env": "prod"}, map[string]string{"runbook_url": "https://runbooks"}, []string{"audit", "runbooks", "infra"}},
+		{"negative regex", map[string]string{"team": "infra", "env": "staging"}, nil, []string{"audit"}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, r.Match(c.labels, c.annotations, "receiver"), c.name)
+	}
+
+	// The default room, or the fallback, is used if no route matches.
+	r = New(rts[1:], "")
+	assert.Equal(t, []string{"receiver"}, r.Match(map[string]string{"team": "web"}, nil, "receiver"))
+	r = New(rts[1:], "catch_all")
+	assert.Equal(t, []string{"catch_all"}, r.Match(map[string]string{"team": "web"}, nil, "receiver"))
+
+	_, err := NewRoute("db", []string{`team=="db"`}, nil, false)
+	assert.Error(t, err)
+}